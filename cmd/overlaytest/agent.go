@@ -0,0 +1,34 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/eumel8/overlaytest/pkg/overlaytest"
+)
+
+// runAgent runs the probe agent inside a DaemonSet pod
+func runAgent(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("agent", flag.ExitOnError)
+	port := fs.Int("port", overlaytest.DefaultAgentPort, "listen port of the agent HTTP API")
+	interval := fs.Duration("interval", 30*time.Second, "time between probe rounds")
+	peers := fs.String("peers", os.Getenv("PEER_SERVICE"), "headless service resolving to all agent pods")
+	fs.Parse(args)
+
+	if *peers == "" {
+		return fmt.Errorf("no peer service given, set -peers or PEER_SERVICE")
+	}
+
+	agent := overlaytest.NewAgent(overlaytest.AgentConfig{
+		Port:        *port,
+		Interval:    *interval,
+		PeerService: *peers,
+		NodeName:    os.Getenv("NODE_NAME"),
+		PodIP:       os.Getenv("POD_IP"),
+	})
+	fmt.Printf("overlaytest agent %s on node %s, peers %s\n", overlaytest.GetVersion(), os.Getenv("NODE_NAME"), *peers)
+	return agent.Run(ctx)
+}
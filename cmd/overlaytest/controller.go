@@ -0,0 +1,45 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/eumel8/overlaytest/pkg/overlaytest"
+	"k8s.io/client-go/dynamic"
+)
+
+// runController reconciles OverlayTest resources until ctx is cancelled
+func runController(ctx context.Context, args []string) error {
+	defaults := overlaytest.DefaultConfig()
+
+	fs := flag.NewFlagSet("controller", flag.ExitOnError)
+	kubeconfig := fs.String("kubeconfig", overlaytest.DefaultKubeconfigPath(), "(optional) absolute path to the kubeconfig file, empty for in-cluster config")
+	kubeContext := fs.String("context", "", "kubeconfig context to use (default the current context)")
+	namespace := fs.String("namespace", "", "only reconcile OverlayTests in this namespace (default all namespaces)")
+	image := fs.String("image", defaults.Image, "default image for OverlayTests without an image")
+	resync := fs.Duration("resync", 30*time.Second, "time between reconciliations of all OverlayTests")
+	events := fs.Bool("events", false, "record Kubernetes Events for failed probes on the affected nodes")
+	fs.Parse(args)
+
+	clientset, restConfig, err := overlaytest.NewClient(overlaytest.ClientOptions{Kubeconfig: *kubeconfig, Context: *kubeContext})
+	if err != nil {
+		return fmt.Errorf("failed to create kubernetes client: %w", err)
+	}
+	dynamicClient, err := dynamic.NewForConfig(restConfig)
+	if err != nil {
+		return fmt.Errorf("failed to create dynamic client: %w", err)
+	}
+
+	controller := overlaytest.NewController(clientset, dynamicClient, restConfig, *namespace)
+	controller.Image = *image
+	controller.Resync = *resync
+	if *events {
+		controller.Events = overlaytest.NewEventNotifier(clientset)
+		defer controller.Events.Shutdown(10 * time.Second)
+	}
+
+	fmt.Printf("overlaytest controller %s started\n", overlaytest.GetVersion())
+	return controller.Run(ctx)
+}
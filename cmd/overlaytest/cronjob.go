@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/eumel8/overlaytest/pkg/overlaytest"
+)
+
+// runCronJob prints or installs a ServiceAccount, its RBAC rules and a CronJob running the test
+// with the flags after "--"
+func runCronJob(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("cronjob", flag.ExitOnError)
+	schedule := fs.String("schedule", overlaytest.DefaultSchedule, "cron schedule of the test runs")
+	install := fs.Bool("install", false, "apply the resources to the cluster instead of printing them")
+	kubeconfig := fs.String("kubeconfig", overlaytest.DefaultKubeconfigPath(), "(optional) absolute path to the kubeconfig file used with -install")
+	kubeContext := fs.String("context", "", "kubeconfig context used with -install (default the current context)")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: overlaytest cronjob [flags] [-- test flags]\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	// The flags of the run decide its permissions, the names and the image
+	config, _, err := loadConfig(append(fs.Args(), overlaytest.CronJobArgs...))
+	if err != nil {
+		return err
+	}
+	var errs []error
+	if config.Monitor {
+		errs = append(errs, errors.New("monitor mode does not fit a scheduled run"))
+	}
+	if config.CreateNamespace {
+		errs = append(errs, errors.New("create-namespace would delete the namespace of the CronJob"))
+	}
+	if len(config.Contexts) > 0 {
+		errs = append(errs, errors.New("a scheduled run tests its own cluster only, remove -contexts"))
+	}
+	if err := errors.Join(errs...); err != nil {
+		return err
+	}
+
+	// Names and image are set explicitly, the environment of the pod does not know local settings
+	runArgs := append([]string{"-namespace=" + config.Namespace, "-app-name=" + config.AppName, "-image=" + config.Image}, fs.Args()...)
+	resources := overlaytest.NewCronJobResources(overlaytest.CronJobOptions{
+		Namespace:   config.Namespace,
+		Name:        config.AppName,
+		Image:       config.Image,
+		Schedule:    *schedule,
+		Args:        append(runArgs, overlaytest.CronJobArgs...),
+		Permissions: overlaytest.RequiredPermissions(config),
+	})
+
+	if !*install {
+		manifest, err := resources.Manifest()
+		if err != nil {
+			return err
+		}
+		_, err = os.Stdout.Write(manifest)
+		return err
+	}
+
+	clientset, _, err := overlaytest.NewClient(overlaytest.ClientOptions{Kubeconfig: *kubeconfig, Context: *kubeContext})
+	if err != nil {
+		return fmt.Errorf("failed to create kubernetes client: %w", err)
+	}
+	if err := resources.Install(ctx, clientset); err != nil {
+		return err
+	}
+	fmt.Printf("scheduled %s in namespace %s with %q, results are kept in the ConfigMap %s-history\n",
+		config.AppName, config.Namespace, *schedule, config.AppName)
+	return nil
+}
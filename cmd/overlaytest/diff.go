@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/eumel8/overlaytest/pkg/overlaytest"
+)
+
+// runDiff compares two saved results and fails if the second one has regressions
+func runDiff(ctx context.Context, args []string) error {
+	defaults := overlaytest.DefaultDiffOptions()
+
+	fs := flag.NewFlagSet("diff", flag.ExitOnError)
+	format := fs.String("format", overlaytest.OutputText, "output format: text or json")
+	minIncrease := fs.Duration("latency-threshold", defaults.MinLatencyIncrease, "minimum RTT increase of a pair to count as regression")
+	percent := fs.Int("latency-percent", defaults.LatencyIncreasePercent, "minimum relative RTT increase of a pair in percent to count as regression")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: overlaytest diff [flags] before.json after.json\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return fmt.Errorf("expected two result files")
+	}
+
+	before, err := overlaytest.LoadReport(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	after, err := overlaytest.LoadReport(fs.Arg(1))
+	if err != nil {
+		return err
+	}
+
+	diff := overlaytest.DiffReports(before, after, overlaytest.DiffOptions{
+		MinLatencyIncrease:     *minIncrease,
+		LatencyIncreasePercent: *percent,
+	})
+	switch *format {
+	case overlaytest.OutputJSON:
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(diff); err != nil {
+			return err
+		}
+	case overlaytest.OutputText:
+		overlaytest.PrintDiff(os.Stdout, diff)
+	default:
+		return fmt.Errorf("unsupported format %q", *format)
+	}
+
+	if regressions := diff.Regressions(); regressions > 0 {
+		return fmt.Errorf("%d regressions found", regressions)
+	}
+	return nil
+}
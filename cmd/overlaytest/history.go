@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/eumel8/overlaytest/pkg/overlaytest"
+)
+
+// runHistory shows the success rate and latency trends of stored results
+func runHistory(ctx context.Context, args []string) error {
+	defaults := overlaytest.DefaultConfig()
+
+	fs := flag.NewFlagSet("history", flag.ExitOnError)
+	dir := fs.String("dir", "", "history directory written with -history-dir")
+	configmap := fs.Bool("configmap", false, "read the history ConfigMap written with -history-configmap")
+	cluster := fs.String("cluster", "", "cluster of the history directory (default the only one, or the kubeconfig cluster)")
+	last := fs.Int("last", 0, "only analyze the last N runs (default all)")
+	format := fs.String("format", overlaytest.OutputText, "output format: text or json")
+	kubeconfig := fs.String("kubeconfig", overlaytest.DefaultKubeconfigPath(), "absolute path to the kubeconfig file")
+	kubeContext := fs.String("context", "", "kubeconfig context to use (default the current context)")
+	namespace := fs.String("namespace", defaults.Namespace, "namespace of the history ConfigMap")
+	appName := fs.String("app-name", defaults.AppName, "application name of the history ConfigMap")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: overlaytest history [flags] (-dir path | -configmap)\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if (*dir == "") == !*configmap {
+		fs.Usage()
+		return fmt.Errorf("expected either -dir or -configmap")
+	}
+
+	var store overlaytest.HistoryStore
+	if *configmap {
+		clientset, restConfig, err := overlaytest.NewClient(overlaytest.ClientOptions{Kubeconfig: *kubeconfig, Context: *kubeContext})
+		if err != nil {
+			return fmt.Errorf("failed to create kubernetes client: %w", err)
+		}
+		store = overlaytest.NewConfigMapHistoryStore(clientset, *namespace, *appName)
+		if *cluster == "" {
+			*cluster = overlaytest.ClusterName(restConfig.Host)
+		}
+	} else {
+		dirStore := &overlaytest.DirHistoryStore{Dir: *dir}
+		store = dirStore
+		if *cluster == "" {
+			clusters, err := dirStore.Clusters()
+			if err != nil {
+				return err
+			}
+			if len(clusters) != 1 {
+				return fmt.Errorf("history directory contains %d clusters %v, select one with -cluster", len(clusters), clusters)
+			}
+			*cluster = clusters[0]
+		}
+	}
+
+	reports, err := store.List(ctx, *cluster)
+	if err != nil {
+		return err
+	}
+	if *last > 0 && len(reports) > *last {
+		reports = reports[len(reports)-*last:]
+	}
+
+	trends := overlaytest.AnalyzeHistory(reports)
+	switch *format {
+	case overlaytest.OutputJSON:
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(trends)
+	case overlaytest.OutputText:
+		fmt.Printf("history of cluster %s\n\n", *cluster)
+		overlaytest.PrintHistory(os.Stdout, trends)
+	default:
+		return fmt.Errorf("unsupported format %q", *format)
+	}
+	return nil
+}
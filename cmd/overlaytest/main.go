@@ -4,88 +4,702 @@
   a workable state. The state will be print out.
   Requires a working .kube/config file or a param -kubeconfig with a
   working kube-config file.
+  With -monitor the test is repeated every -interval and the results
+  are exposed as Prometheus metrics on -metrics-addr.
+  With -agent the pods probe each other directly with an agent
+  ("overlaytest agent") and the results are collected over the API
+  server proxy instead of one exec per node pair.
+  With -batch each pod pings all targets within a single exec.
+  With -contexts the test runs against several kubeconfig contexts
+  in parallel, followed by a fleet summary.
+  "overlaytest controller" reconciles OverlayTest custom resources.
+  "overlaytest report" renders a result saved with -output json,
+  e.g. as self-contained HTML page, "overlaytest diff" compares two
+  saved results and exits non-zero on regressions.
+  With -history-dir or -history-configmap every result is stored and
+  "overlaytest history" shows the trends per node pair.
+  "overlaytest cronjob" prints or installs a CronJob running the test
+  inside the cluster on a schedule, without kubeconfig the in-cluster
+  config is used.
+  With -events failed probes are recorded as Kubernetes Events on the
+  affected nodes and the DaemonSet.
+  All settings can be read from a YAML file (-config) and overridden
+  by OVERLAYTEST_* environment variables and command line flags.
 */
 
 package main
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
+	"log/slog"
+	"math/rand/v2"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"sync"
+	"syscall"
+	"time"
 
 	"github.com/eumel8/overlaytest/pkg/overlaytest"
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/term"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
 )
 
+// subcommands are run with the remaining arguments instead of the overlay test
+var subcommands = map[string]func(ctx context.Context, args []string) error{
+	"agent":      runAgent,
+	"controller": runController,
+	"report":     runReport,
+	"diff":       runDiff,
+	"history":    runHistory,
+	"cronjob":    runCronJob,
+}
+
 func main() {
-	// Parse flags
-	config := overlaytest.DefaultConfig()
-	defaultPath := overlaytest.GetKubeconfigPath()
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-	kubeconfig := flag.String("kubeconfig", defaultPath, "(optional) absolute path to the kubeconfig file")
-	version := flag.Bool("version", false, "app version")
-	reuse := flag.Bool("reuse", false, "reuse existing deployment")
+	// Subcommands
+	if len(os.Args) > 1 {
+		if subcommand, ok := subcommands[os.Args[1]]; ok {
+			if err := subcommand(ctx, os.Args[2:]); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				stop()
+				os.Exit(1)
+			}
+			return
+		}
+	}
 
-	flag.Parse()
+	config, options, err := loadConfig(os.Args[1:])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		stop()
+		os.Exit(2)
+	}
 
 	// Handle version flag
-	if *version {
+	if options.version {
 		fmt.Println("version", overlaytest.GetVersion())
 		os.Exit(0)
 	}
 
-	// Update config
-	config.Kubeconfig = *kubeconfig
-	config.Reuse = *reuse
+	// Print the RBAC rules the run needs
+	if options.printRBAC {
+		manifest, err := overlaytest.RBACManifest(config.AppName, overlaytest.RequiredPermissions(config))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			stop()
+			os.Exit(1)
+		}
+		os.Stdout.Write(manifest)
+		return
+	}
+
+	// Keep progress messages out of JSON results written to stdout
+	var results io.Writer = os.Stdout
+	if config.Output == overlaytest.OutputJSON && config.OutputFile == "" {
+		os.Stdout = os.Stderr
+	}
+
+	// Log progress messages, warnings and text results as JSON records
+	var logger *slog.Logger
+	restore := func() {}
+	if config.LogFormat == overlaytest.LogFormatJSON {
+		logger, results, restore, err = redirectToJSONLogs()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			stop()
+			os.Exit(1)
+		}
+	}
 
 	// Run the overlay test
-	ctx := context.Background()
-	if err := runOverlayTest(ctx, config); err != nil {
-		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+	err = runOverlayTest(ctx, config, results)
+	restore()
+	if err != nil {
+		if logger != nil {
+			logger.Error(err.Error())
+		} else {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		}
+		stop()
 		os.Exit(1)
 	}
 }
 
-func runOverlayTest(ctx context.Context, config *overlaytest.Config) error {
+// redirectToJSONLogs turns every line printed to stdout and stderr into a JSON log record on
+// stdout, warnings on stderr are logged with level WARN. It returns a writer logging the results
+// and a function which flushes the pending lines and restores stdout and stderr.
+func redirectToJSONLogs() (*slog.Logger, io.Writer, func(), error) {
+	stdout, stderr := os.Stdout, os.Stderr
+	logger := overlaytest.NewJSONLogger(stdout)
+
+	var wg sync.WaitGroup
+	var pipes []*os.File
+	redirect := func(level slog.Level) (*os.File, error) {
+		r, w, err := os.Pipe()
+		if err != nil {
+			return nil, fmt.Errorf("error redirecting output to logs: %w", err)
+		}
+		pipes = append(pipes, w)
+		lines := overlaytest.NewLineLogger(logger, level)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			io.Copy(lines, r)
+			lines.Flush()
+			r.Close()
+		}()
+		return w, nil
+	}
+	out, err := redirect(slog.LevelInfo)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	errOut, err := redirect(slog.LevelWarn)
+	if err != nil {
+		out.Close()
+		return nil, nil, nil, err
+	}
+	os.Stdout, os.Stderr = out, errOut
+
+	results := overlaytest.NewLineLogger(logger, slog.LevelInfo)
+	restore := func() {
+		results.Flush()
+		for _, pipe := range pipes {
+			pipe.Close()
+		}
+		wg.Wait()
+		os.Stdout, os.Stderr = stdout, stderr
+	}
+	return logger, results, restore, nil
+}
+
+// cliOptions are command line flags which are not part of the configuration
+type cliOptions struct {
+	version   bool
+	printRBAC bool
+}
+
+// loadConfig builds the configuration from defaults, the -config file, OVERLAYTEST_* environment
+// variables and command line flags, each overriding the previous
+func loadConfig(args []string) (*overlaytest.Config, cliOptions, error) {
+	config := overlaytest.DefaultConfig()
+	config.Kubeconfig = overlaytest.DefaultKubeconfigPath()
+
+	var options cliOptions
+	fs := flag.NewFlagSet("overlaytest", flag.ExitOnError)
+	configFile := fs.String("config", os.Getenv("OVERLAYTEST_CONFIG"), "YAML configuration file")
+	fs.BoolVar(&options.version, "version", false, "app version")
+	fs.BoolVar(&options.printRBAC, "print-rbac", false, "print a Role/ClusterRole manifest with the permissions the run needs and exit")
+
+	// Flags are applied after the config file and environment
+	var overrides []func(*overlaytest.Config) error
+	for _, field := range overlaytest.ConfigFields {
+		set := func(value string) error {
+			// Check the value right away to report it as flag error
+			if err := field.Set(overlaytest.DefaultConfig(), value); err != nil {
+				return err
+			}
+			overrides = append(overrides, func(c *overlaytest.Config) error { return field.Set(c, value) })
+			return nil
+		}
+		if field.Bool {
+			fs.BoolFunc(field.Name, field.Usage, set)
+		} else {
+			fs.Func(field.Name, field.Usage, set)
+		}
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, options, err
+	}
+	if options.version {
+		return config, options, nil
+	}
+
+	if *configFile != "" {
+		if err := config.LoadConfigFile(*configFile); err != nil {
+			return nil, options, err
+		}
+	}
+	if err := config.ApplyEnv(os.LookupEnv); err != nil {
+		return nil, options, err
+	}
+	for _, override := range overrides {
+		if err := override(config); err != nil {
+			return nil, options, err
+		}
+	}
+
+	if err := config.Validate(); err != nil {
+		return nil, options, fmt.Errorf("invalid configuration:\n%w", err)
+	}
+	return config, options, nil
+}
+
+func runOverlayTest(ctx context.Context, config *overlaytest.Config, results io.Writer) error {
+	if len(config.Contexts) > 0 {
+		return runFleet(ctx, config, results)
+	}
+
 	// Create Kubernetes client
-	clientset, restConfig, err := overlaytest.NewKubernetesClient(config.Kubeconfig)
+	clientset, restConfig, err := overlaytest.NewClient(config.ClientOptions())
 	if err != nil {
 		return fmt.Errorf("failed to create kubernetes client: %w", err)
 	}
 
 	fmt.Printf("Welcome to the overlaytest.\n\n")
 
-	// Create or reuse DaemonSet
-	if err := overlaytest.CreateOrReuseDaemonSet(ctx, clientset, config, config.Reuse); err != nil {
+	if config.Cleanup {
+		defer cleanupRun(ctx, clientset, config)
+	}
+	coverage, err := deploy(ctx, clientset, config)
+	if err != nil {
 		return err
 	}
 
-	// Wait for DaemonSet ready
-	if !config.Reuse {
-		if err := overlaytest.WaitForDaemonSetReady(ctx, clientset, config.Namespace, config.AppName); err != nil {
-			return err
-		}
+	if config.Monitor {
+		return runMonitor(ctx, clientset, restConfig, config)
 	}
 
-	// Get pods
-	pods, err := overlaytest.GetOverlayTestPods(ctx, clientset, config.Namespace)
+	// Run network test
+	fmt.Printf("\n=> Start network overlay test\n")
+	report, err := runNetworkTest(ctx, clientset, restConfig, config)
 	if err != nil {
 		return err
 	}
-	fmt.Printf("There are %d nodes in the cluster\n", len(pods.Items))
+	report.Uncovered = coverage.Uncovered
+	if err := writeReport(results, config, report); err != nil {
+		return err
+	}
+	finishRun(ctx, clientset, restConfig, config, config.DiagnosticsDir, report)
+	fmt.Printf("=> End network overlay test\n")
 
-	// Wait for pod network
-	if err := overlaytest.WaitForPodNetwork(ctx, clientset, config.Namespace, pods.Items); err != nil {
+	if !config.Cleanup {
+		fmt.Printf("\nCall me again to remove installed cluster resources\n")
+	}
+	return nil
+}
+
+// runFleet tests the selected kubeconfig contexts in parallel and writes the results of every
+// cluster followed by a fleet summary
+func runFleet(ctx context.Context, config *overlaytest.Config, results io.Writer) error {
+	available, err := overlaytest.KubeconfigContexts(config.Kubeconfig)
+	if err != nil {
+		return err
+	}
+	contexts, err := overlaytest.SelectContexts(available, config.Contexts)
+	if err != nil {
 		return err
 	}
 
-	// Run network test
-	fmt.Printf("\n=> Start network overlay test\n")
-	if err := overlaytest.RunNetworkTest(ctx, clientset, restConfig, config.Namespace); err != nil {
+	fmt.Printf("Welcome to the overlaytest.\n\n")
+	fmt.Printf("=> Testing %d clusters, %d at once\n", len(contexts), config.Parallel)
+	fleet := overlaytest.RunFleet(ctx, contexts, config.Parallel, func(ctx context.Context, kubeContext string) (*overlaytest.Report, error) {
+		return testCluster(ctx, config, kubeContext)
+	})
+
+	if err := writeOutput(results, config.OutputFile, func(w io.Writer) error {
+		if config.Output == overlaytest.OutputJSON {
+			return overlaytest.WriteFleetJSON(w, fleet)
+		}
+		for _, cluster := range fleet.Clusters {
+			fmt.Fprintf(w, "\n=== %s ===\n", cluster.Context)
+			if cluster.Error != "" {
+				fmt.Fprintf(w, "error: %s\n", cluster.Error)
+				continue
+			}
+			printReport(w, config.Output, config.NodePoolLabel, cluster.Report)
+		}
+		overlaytest.PrintFleetSummary(w, fleet)
+		return nil
+	}); err != nil {
 		return err
 	}
-	fmt.Printf("=> End network overlay test\n")
 
-	fmt.Printf("\nCall me again to remove installed cluster resources\n")
+	if failed := fleet.Failed(); len(failed) > 0 {
+		return fmt.Errorf("%d of %d clusters could not be tested", len(failed), len(fleet.Clusters))
+	}
+	if !config.Cleanup {
+		fmt.Printf("\nCall me again to remove installed cluster resources\n")
+	}
 	return nil
 }
+
+// testCluster runs a single test against a kubeconfig context, diagnostics bundles are written
+// into a subdirectory per context
+func testCluster(ctx context.Context, config *overlaytest.Config, kubeContext string) (*overlaytest.Report, error) {
+	options := config.ClientOptions()
+	options.Context = kubeContext
+	clientset, restConfig, err := overlaytest.NewClient(options)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create kubernetes client: %w", err)
+	}
+
+	// Every line of a cluster tested in parallel to others starts with its context
+	stdout := overlaytest.NewPrefixWriter(os.Stdout, "["+kubeContext+"] ")
+	stderr := overlaytest.NewPrefixWriter(os.Stderr, "["+kubeContext+"] ")
+	defer stdout.Flush()
+	defer stderr.Flush()
+	ctx = overlaytest.WithOutput(ctx, stdout, stderr)
+	fmt.Fprintf(stdout, "starting test against %s\n", restConfig.Host)
+
+	if config.Cleanup {
+		defer cleanupRun(ctx, clientset, config)
+	}
+	coverage, err := deploy(ctx, clientset, config)
+	if err != nil {
+		return nil, err
+	}
+	report, err := runNetworkTest(ctx, clientset, restConfig, config)
+	if err != nil {
+		return nil, err
+	}
+	report.Uncovered = coverage.Uncovered
+
+	diagnosticsDir := config.DiagnosticsDir
+	if diagnosticsDir != "" {
+		diagnosticsDir = filepath.Join(diagnosticsDir, kubeContext)
+	}
+	finishRun(ctx, clientset, restConfig, config, diagnosticsDir, report)
+	fmt.Fprintf(stdout, "%d probes, %d failed\n", len(report.Results), len(report.Failures()))
+	return report, nil
+}
+
+// deploy checks the permissions, creates or reuses the DaemonSet and waits for its pods
+func deploy(ctx context.Context, clientset kubernetes.Interface, config *overlaytest.Config) (*overlaytest.Coverage, error) {
+	if err := checkPermissions(ctx, clientset, config); err != nil {
+		return nil, err
+	}
+
+	// Create or reuse DaemonSet
+	if err := overlaytest.CreateOrReuseDaemonSet(ctx, clientset, config, config.Reuse); err != nil {
+		return nil, err
+	}
+
+	return waitForPods(ctx, clientset, config)
+}
+
+// cleanupRun removes the test resources, also after a cancelled or failed run
+func cleanupRun(ctx context.Context, clientset kubernetes.Interface, config *overlaytest.Config) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), time.Minute)
+	defer cancel()
+	if err := overlaytest.Cleanup(ctx, clientset, config); err != nil {
+		fmt.Fprintf(overlaytest.Stderr(ctx), "error removing test resources: %v\n", err)
+		return
+	}
+	fmt.Fprintf(overlaytest.Stdout(ctx), "removed test resources\n")
+}
+
+// finishRun stores the report in the history, writes the diagnostics bundle of failed runs
+// into diagnosticsDir and records the Events
+func finishRun(ctx context.Context, clientset kubernetes.Interface, restConfig *rest.Config, config *overlaytest.Config, diagnosticsDir string, report *overlaytest.Report) {
+	saveHistory(ctx, overlaytest.NewHistoryStore(clientset, config), restConfig, report)
+	if len(report.Failures()) > 0 && diagnosticsDir != "" && canWriteDiagnostics(ctx, clientset, config) {
+		writeDiagnostics(ctx, overlaytest.NewDiagnosticsCollector(clientset, restConfig, config), diagnosticsDir, report)
+	}
+
+	if config.Events {
+		notifier := overlaytest.NewEventNotifier(clientset)
+		recordEvents(ctx, clientset, notifier, config, report)
+		notifier.Shutdown(10 * time.Second)
+	}
+}
+
+// checkPermissions verifies all permissions of the run before anything is deployed. The permissions
+// of the diagnostics bundle are checked when it is written.
+func checkPermissions(ctx context.Context, clientset kubernetes.Interface, config *overlaytest.Config) error {
+	diagnostics := overlaytest.DiagnosticsPermissions(config)
+	required := slices.DeleteFunc(overlaytest.RequiredPermissions(config), func(permission overlaytest.Permission) bool {
+		return slices.Contains(diagnostics, permission)
+	})
+	missing, err := overlaytest.CheckPermissions(ctx, clientset, required)
+	if err != nil {
+		fmt.Fprintf(overlaytest.Stderr(ctx), "skipping permission check: %v\n", err)
+		return nil
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+
+	fmt.Fprintf(overlaytest.Stderr(ctx), "missing permissions:\n")
+	for _, permission := range missing {
+		fmt.Fprintf(overlaytest.Stderr(ctx), "  %s\n", permission)
+	}
+	return fmt.Errorf("%d missing permissions, run with -print-rbac for a Role/ClusterRole granting them", len(missing))
+}
+
+// canWriteDiagnostics checks the permissions of the diagnostics bundle, without them the bundle is skipped
+func canWriteDiagnostics(ctx context.Context, clientset kubernetes.Interface, config *overlaytest.Config) bool {
+	missing, err := overlaytest.CheckPermissions(ctx, clientset, overlaytest.DiagnosticsPermissions(config))
+	if err != nil {
+		fmt.Fprintf(overlaytest.Stderr(ctx), "skipping diagnostics permission check: %v\n", err)
+		return true
+	}
+	if len(missing) == 0 {
+		return true
+	}
+
+	fmt.Fprintf(overlaytest.Stderr(ctx), "skipping diagnostics bundle, missing permissions:\n")
+	for _, permission := range missing {
+		fmt.Fprintf(overlaytest.Stderr(ctx), "  %s\n", permission)
+	}
+	return false
+}
+
+// waitForPods waits for the DaemonSet and the pod network, limited by the ready timeout,
+// and returns the node coverage. When the timeout expires with some pods ready, the test
+// goes on with them and the other nodes are reported as uncovered.
+func waitForPods(ctx context.Context, clientset kubernetes.Interface, config *overlaytest.Config) (*overlaytest.Coverage, error) {
+	readyCtx := ctx
+	if config.ReadyTimeout > 0 {
+		var cancel context.CancelFunc
+		readyCtx, cancel = context.WithTimeout(ctx, config.ReadyTimeout)
+		defer cancel()
+	}
+
+	// Wait for DaemonSet ready
+	timedOut := false
+	if !config.Reuse {
+		if err := overlaytest.WaitForDaemonSetReady(readyCtx, clientset, config.Namespace, config.AppName); err != nil {
+			if !errors.Is(err, context.DeadlineExceeded) || ctx.Err() != nil {
+				return nil, err
+			}
+			fmt.Fprintf(overlaytest.Stderr(ctx), "ready timeout of %s expired: %v\n", config.ReadyTimeout, err)
+			timedOut = true
+		}
+	}
+
+	// Compare the nodes with the running pods
+	coverage, err := overlaytest.CheckNodeCoverage(ctx, clientset, config)
+	if err != nil {
+		return nil, err
+	}
+	overlaytest.PrintCoverage(overlaytest.Stdout(ctx), coverage)
+	if !timedOut {
+		return coverage, overlaytest.WaitForPodNetwork(readyCtx, clientset, config.Namespace, coverage.Pods)
+	}
+	if len(coverage.Pods) == 0 {
+		return nil, fmt.Errorf("no test pod running after %s", config.ReadyTimeout)
+	}
+
+	// Wait for pod network, the running pods got their IP already
+	return coverage, overlaytest.WaitForPodNetwork(ctx, clientset, config.Namespace, coverage.Pods)
+}
+
+// runNetworkTest probes all selected node pairs through the agents, by batched exec or by exec per pair
+func runNetworkTest(ctx context.Context, clientset kubernetes.Interface, restConfig *rest.Config, config *overlaytest.Config) (*overlaytest.Report, error) {
+	if config.RunTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, config.RunTimeout)
+		defer cancel()
+	}
+
+	pods, err := overlaytest.SelectTestPods(ctx, clientset, config)
+	if err != nil {
+		return nil, err
+	}
+	var report *overlaytest.Report
+	if config.Agent {
+		report, err = overlaytest.CollectAgentResults(ctx, clientset, config.Namespace, pods)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		report = overlaytest.ProbePods(ctx, clientset, restConfig, config.Namespace, pods, config.Batch)
+	}
+	if config.Throughput != "" {
+		pairs := overlaytest.SelectThroughputPairs(report.Nodes, config.Throughput, config.ThroughputPairs, rand.New(rand.NewPCG(rand.Uint64(), rand.Uint64())))
+		fmt.Fprintf(overlaytest.Stdout(ctx), "measuring throughput of %d node pairs for %s each\n", len(pairs), config.ThroughputDuration)
+		report.Throughput = overlaytest.MeasureThroughput(ctx, clientset, config.Namespace, pairs, config.ThroughputDuration)
+	}
+	if config.LatencySamples > 0 {
+		fmt.Fprintf(overlaytest.Stdout(ctx), "measuring latency with %d samples per node pair\n", config.LatencySamples)
+		report.Latency = overlaytest.MeasureLatency(ctx, clientset, restConfig, config.Namespace, report, config.LatencySamples)
+		// validated with the config
+		slos, _ := overlaytest.ParseLatencySLOs(config.LatencySLO)
+		overlaytest.CheckLatencySLOs(report, report.Latency, slos)
+	}
+	if config.Traceroute != "" {
+		overlaytest.TraceFailures(ctx, clientset, restConfig, config.Namespace, report, config.Traceroute)
+	}
+	report.Metadata = overlaytest.NewReportMetadata(clientset, restConfig.Host, config)
+	if !config.SkipCNI {
+		inspectCNI(ctx, clientset, report)
+	}
+	return report, nil
+}
+
+// inspectCNI adds the CNI plugin and, on failures, the state of its agents to the report.
+// Both are best effort, errors are only reported.
+func inspectCNI(ctx context.Context, clientset kubernetes.Interface, report *overlaytest.Report) {
+	cni, err := overlaytest.DetectCNI(ctx, clientset)
+	if err != nil {
+		fmt.Fprintf(overlaytest.Stderr(ctx), "skipping CNI detection: %v\n", err)
+	}
+	if cni == nil {
+		return
+	}
+	report.Metadata.CNI = cni
+
+	agents, err := overlaytest.CheckCNIAgents(ctx, clientset, cni, overlaytest.FailingNodes(report))
+	if err != nil {
+		fmt.Fprintf(overlaytest.Stderr(ctx), "skipping CNI agent check: %v\n", err)
+	}
+	report.CNIAgents = agents
+}
+
+// writeReport writes the report in the configured format to the output file or stdout
+func writeReport(stdout io.Writer, config *overlaytest.Config, report *overlaytest.Report) error {
+	return writeOutput(stdout, config.OutputFile, func(w io.Writer) error {
+		if config.Output == overlaytest.OutputJSON {
+			if err := overlaytest.WriteReportJSON(w, report); err != nil {
+				return fmt.Errorf("error writing report: %w", err)
+			}
+			return nil
+		}
+		printReport(w, config.Output, config.NodePoolLabel, report)
+		return nil
+	})
+}
+
+// writeOutput calls write with the output file or stdout if no file is set
+func writeOutput(stdout io.Writer, outputFile string, write func(w io.Writer) error) (err error) {
+	if outputFile == "" {
+		return write(stdout)
+	}
+	f, err := os.Create(outputFile)
+	if err != nil {
+		return fmt.Errorf("error creating output file: %w", err)
+	}
+	defer func() {
+		if closeErr := f.Close(); err == nil && closeErr != nil {
+			err = fmt.Errorf("error writing output file: %w", closeErr)
+		}
+	}()
+	defer fmt.Printf("results written to %s\n", outputFile)
+	return write(f)
+}
+
+// printReport writes the report as text or matrix with the derived summaries, grouped by the node pool label
+func printReport(w io.Writer, format, nodePoolLabel string, report *overlaytest.Report) {
+	if format == overlaytest.OutputMatrix {
+		overlaytest.RenderMatrix(w, report, terminalWidth(w))
+	} else {
+		overlaytest.PrintResults(w, report)
+	}
+	overlaytest.PrintDiagnosis(w, overlaytest.Diagnose(report))
+	overlaytest.PrintCNIAgents(w, report)
+	overlaytest.PrintThroughput(w, report.Throughput)
+	overlaytest.PrintLatency(w, report.Latency)
+	overlaytest.PrintTopology(w, overlaytest.TopologySummaries(report, nodePoolLabel))
+}
+
+// saveHistory stores the report in the history, failures are only reported
+func saveHistory(ctx context.Context, store overlaytest.HistoryStore, restConfig *rest.Config, report *overlaytest.Report) {
+	if store == nil {
+		return
+	}
+	if err := store.Save(ctx, overlaytest.ClusterName(restConfig.Host), report); err != nil {
+		fmt.Fprintf(overlaytest.Stderr(ctx), "error saving history: %v\n", err)
+	}
+}
+
+// writeDiagnostics writes the diagnostics bundle of a failed run into dir, failures are only reported
+func writeDiagnostics(ctx context.Context, collector *overlaytest.DiagnosticsCollector, dir string, report *overlaytest.Report) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		fmt.Fprintf(overlaytest.Stderr(ctx), "error creating diagnostics directory: %v\n", err)
+		return
+	}
+	path := filepath.Join(dir, overlaytest.DiagnosticsBundleName(report))
+	f, err := os.Create(path)
+	if err != nil {
+		fmt.Fprintf(overlaytest.Stderr(ctx), "error creating diagnostics bundle: %v\n", err)
+		return
+	}
+	err = collector.WriteBundle(ctx, f, report)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		fmt.Fprintf(overlaytest.Stderr(ctx), "error writing diagnostics bundle: %v\n", err)
+		return
+	}
+	fmt.Fprintf(overlaytest.Stdout(ctx), "diagnostics written to %s\n", path)
+}
+
+// terminalWidth returns the width of the terminal w writes to, 0 if it is no terminal
+func terminalWidth(w io.Writer) int {
+	f, ok := w.(*os.File)
+	if !ok || !term.IsTerminal(int(f.Fd())) {
+		return 0
+	}
+	width, _, err := term.GetSize(int(f.Fd()))
+	if err != nil {
+		return 0
+	}
+	return width
+}
+
+// recordEvents emits the Events of a test run against the nodes and the DaemonSet
+func recordEvents(ctx context.Context, clientset kubernetes.Interface, notifier *overlaytest.EventNotifier, config *overlaytest.Config, report *overlaytest.Report) {
+	daemonset, err := clientset.AppsV1().DaemonSets(config.Namespace).Get(ctx, config.AppName, meta.GetOptions{})
+	if err != nil {
+		fmt.Fprintf(overlaytest.Stderr(ctx), "error getting daemonset for events: %v\n", err)
+		daemonset = nil
+	}
+	notifier.RecordReport(report, daemonset)
+}
+
+func runMonitor(ctx context.Context, clientset kubernetes.Interface, restConfig *rest.Config, config *overlaytest.Config) error {
+	registry := prometheus.NewRegistry()
+	metrics := overlaytest.NewMetrics(registry)
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- overlaytest.ServeMetrics(ctx, config.MetricsAddr, registry)
+	}()
+	fmt.Printf("serving metrics on %s/metrics, running test every %s\n", config.MetricsAddr, config.Interval)
+
+	var notifier *overlaytest.EventNotifier
+	if config.Events {
+		notifier = overlaytest.NewEventNotifier(clientset)
+		defer notifier.Shutdown(10 * time.Second)
+	}
+
+	history := overlaytest.NewHistoryStore(clientset, config)
+
+	ticker := time.NewTicker(config.Interval)
+	defer ticker.Stop()
+	for {
+		report, err := runNetworkTest(ctx, clientset, restConfig, config)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "test run failed: %v\n", err)
+		} else {
+			metrics.Observe(report)
+			if notifier != nil {
+				recordEvents(ctx, clientset, notifier, config, report)
+			}
+			saveHistory(ctx, history, restConfig, report)
+			fmt.Printf("%s: %d probes, %d failed, took %s\n", report.StartTime.Format(time.RFC3339),
+				len(report.Results), len(report.Failures()), report.Duration.Round(time.Millisecond))
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case err := <-errCh:
+			return fmt.Errorf("metrics server failed: %w", err)
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/eumel8/overlaytest/pkg/overlaytest"
+)
+
+// runReport renders a result saved with -output json in another format
+func runReport(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("report", flag.ExitOnError)
+	format := fs.String("format", "html", "output format: html, matrix, text or json")
+	output := fs.String("output", "", "output file (default stdout)")
+	nodePoolLabel := fs.String("node-pool-label", "", "node label grouping the results by node pool (default the one of the run)")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: overlaytest report [flags] result.json\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return fmt.Errorf("expected one result file")
+	}
+
+	switch *format {
+	case "html", overlaytest.OutputMatrix, overlaytest.OutputText, overlaytest.OutputJSON:
+	default:
+		return fmt.Errorf("unsupported format %q", *format)
+	}
+
+	report, err := overlaytest.LoadReport(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	if *nodePoolLabel != "" {
+		report.Metadata.NodePoolLabel = *nodePoolLabel
+	}
+
+	return writeOutput(os.Stdout, *output, func(w io.Writer) error {
+		var err error
+		switch *format {
+		case "html":
+			err = overlaytest.RenderHTML(w, report)
+		case overlaytest.OutputJSON:
+			err = overlaytest.WriteReportJSON(w, report)
+		default:
+			printReport(w, *format, report.Metadata.NodePoolLabel, report)
+		}
+		if err != nil {
+			return fmt.Errorf("error writing report: %w", err)
+		}
+		return nil
+	})
+}
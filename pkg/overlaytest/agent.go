@@ -0,0 +1,289 @@
+package overlaytest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os/exec"
+	"slices"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	core "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+	utilexec "k8s.io/client-go/util/exec"
+)
+
+// DefaultAgentPort is the port the agent serves its HTTP API on
+const DefaultAgentPort = 8080
+
+// agentWorkers limits the number of concurrent probes of an agent
+const agentWorkers = 16
+
+// AgentConfig holds the configuration of the in-pod probe agent
+type AgentConfig struct {
+	Port        int
+	Interval    time.Duration
+	PeerService string // headless service resolving to all agent pod IPs
+	NodeName    string
+	PodIP       string
+}
+
+// AgentResults is the response of the agent /results endpoint
+type AgentResults struct {
+	Node    string        `json:"node"`
+	PodIP   string        `json:"podIP"`
+	Time    time.Time     `json:"time"`
+	Results []ProbeResult `json:"results"`
+}
+
+// Agent probes all peers from inside a DaemonSet pod and publishes the results over HTTP
+type Agent struct {
+	config AgentConfig
+
+	// probe executes a ping against the target IP, replaced in tests
+	probe func(ctx context.Context, targetIP string) ProbeResult
+	// lookup resolves the peer service, replaced in tests
+	lookup func(ctx context.Context, host string) ([]string, error)
+	// client and sinkURL send throughput streams to peers, replaced in tests
+	client  *http.Client
+	sinkURL func(targetIP string) string
+
+	mu      sync.Mutex
+	round   sync.Mutex
+	results *AgentResults
+
+	// stream and sink allow a single throughput stream in each direction
+	stream sync.Mutex
+	sink   sync.Mutex
+}
+
+// NewAgent creates an agent with the given configuration
+func NewAgent(config AgentConfig) *Agent {
+	agent := &Agent{
+		config: config,
+		probe:  PingLocal,
+		lookup: net.DefaultResolver.LookupHost,
+		client: &http.Client{},
+	}
+	agent.sinkURL = agent.defaultSinkURL
+	return agent
+}
+
+// PingLocal pings the target IP from the local network namespace
+func PingLocal(ctx context.Context, targetIP string) ProbeResult {
+	result := ProbeResult{TargetIP: targetIP}
+
+	cmd := CreatePingProbeCommand(targetIP)
+	output, err := exec.CommandContext(ctx, cmd[0], cmd[1:]...).Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			err = utilexec.CodeExitError{Err: exitErr, Code: exitErr.ExitCode()}
+		}
+		result.ErrorClass = ClassifyProbeError(err)
+		result.Error = err.Error()
+		return result
+	}
+
+	result.Reachable = true
+	if rtt, ok := ParsePingRTT(string(output)); ok {
+		result.RTT = rtt
+	}
+	return result
+}
+
+// Peers returns the sorted pod IPs of all agents, including the local one
+func (a *Agent) Peers(ctx context.Context) ([]string, error) {
+	peers, err := a.lookup(ctx, a.config.PeerService)
+	if err != nil {
+		return nil, fmt.Errorf("error resolving peers: %w", err)
+	}
+	sort.Strings(peers)
+	return peers, nil
+}
+
+// isPeer tells if the IP belongs to an agent of the peer service
+func (a *Agent) isPeer(ctx context.Context, ip string) (bool, error) {
+	peers, err := a.Peers(ctx)
+	if err != nil {
+		return false, err
+	}
+	return slices.Contains(peers, ip), nil
+}
+
+// RunRound probes all peers once and stores the results
+func (a *Agent) RunRound(ctx context.Context) (*AgentResults, error) {
+	// Serialize rounds, a refresh request may overlap with the periodic run
+	a.round.Lock()
+	defer a.round.Unlock()
+
+	peers, err := a.Peers(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]ProbeResult, len(peers))
+	sem := make(chan struct{}, agentWorkers)
+	var wg sync.WaitGroup
+	for i, peer := range peers {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, peer string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			result := a.probe(ctx, peer)
+			result.SourceNode = a.config.NodeName
+			results[i] = result
+		}(i, peer)
+	}
+	wg.Wait()
+
+	round := &AgentResults{
+		Node:    a.config.NodeName,
+		PodIP:   a.config.PodIP,
+		Time:    time.Now(),
+		Results: results,
+	}
+
+	a.mu.Lock()
+	a.results = round
+	a.mu.Unlock()
+	return round, nil
+}
+
+// Results returns the results of the last round, nil if no round has finished yet
+func (a *Agent) Results() *AgentResults {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.results
+}
+
+// Handler returns the HTTP API of the agent
+//
+//	GET /healthz            liveness
+//	GET /results            results of the last round
+//	GET /results?refresh=1  run a new round and return its results
+//	POST /sink              discard the body of a peer and return its size
+//	GET /throughput?target=<ip>&duration=5s  stream to the sink of the target peer
+func (a *Agent) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok\n"))
+	})
+	mux.HandleFunc("/results", func(w http.ResponseWriter, r *http.Request) {
+		results := a.Results()
+		if refresh, _ := strconv.ParseBool(r.URL.Query().Get("refresh")); refresh {
+			var err error
+			if results, err = a.RunRound(r.Context()); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+		}
+		if results == nil {
+			http.Error(w, "no results yet", http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(results)
+	})
+	mux.HandleFunc("/sink", a.handleSink)
+	mux.HandleFunc("/throughput", a.handleThroughput)
+	return mux
+}
+
+// Run serves the HTTP API and probes all peers every interval until ctx is cancelled
+func (a *Agent) Run(ctx context.Context) error {
+	server := &http.Server{
+		Addr:              fmt.Sprintf(":%d", a.config.Port),
+		Handler:           a.Handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	errCh := make(chan error, 1)
+	go func() {
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			errCh <- err
+		}
+	}()
+	defer server.Close()
+
+	ticker := time.NewTicker(a.config.Interval)
+	defer ticker.Stop()
+	for {
+		if round, err := a.RunRound(ctx); err != nil {
+			fmt.Printf("probe round failed: %v\n", err)
+		} else {
+			fmt.Printf("probed %d peers\n", len(round.Results))
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case err := <-errCh:
+			return err
+		case <-ticker.C:
+		}
+	}
+}
+
+// CollectAgentResults fetches fresh results from every agent pod through the API server proxy
+// and assembles them into a report of the given pods. Probes of peers outside the pods are dropped,
+// targets an agent did not probe and all targets of agents without results count as failed.
+func CollectAgentResults(ctx context.Context, clientset kubernetes.Interface, namespace string, pods []core.Pod) (*Report, error) {
+	report := &Report{
+		StartTime: time.Now(),
+		Nodes:     GetNodeInfo(ctx, clientset, pods),
+		Results:   []ProbeResult{},
+	}
+
+	for _, pod := range pods {
+		byIP := map[string]ProbeResult{}
+		results, err := fetchAgentResults(ctx, clientset, namespace, pod)
+		if err == nil {
+			for _, result := range results.Results {
+				byIP[result.TargetIP] = result
+			}
+		}
+
+		for _, target := range pods {
+			result, ok := byIP[target.Status.PodIP]
+			switch {
+			case err != nil:
+				// A dead agent fails all its probes instead of vanishing from the report
+				result = ProbeResult{ErrorClass: ErrorClassExec, Error: fmt.Sprintf("error collecting results from %s: %v", pod.ObjectMeta.Name, err)}
+			case !ok:
+				result = ProbeResult{ErrorClass: ErrorClassExec, Error: fmt.Sprintf("agent %s did not probe the target, it is missing from its peers", pod.ObjectMeta.Name)}
+			}
+			if result.SourceNode == "" {
+				result.SourceNode = pod.Spec.NodeName
+			}
+			result.TargetNode = target.Spec.NodeName
+			result.TargetIP = target.Status.PodIP
+			report.Results = append(report.Results, result)
+		}
+	}
+
+	report.Duration = time.Since(report.StartTime)
+	return report, nil
+}
+
+// fetchAgentResults runs a new round of the agent in the pod and returns its results
+func fetchAgentResults(ctx context.Context, clientset kubernetes.Interface, namespace string, pod core.Pod) (*AgentResults, error) {
+	raw, err := clientset.CoreV1().Pods(namespace).
+		ProxyGet("http", pod.ObjectMeta.Name, strconv.Itoa(DefaultAgentPort), "/results", map[string]string{"refresh": "true"}).
+		DoRaw(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var results AgentResults
+	if err := json.Unmarshal(raw, &results); err != nil {
+		return nil, fmt.Errorf("invalid results: %w", err)
+	}
+	return &results, nil
+}
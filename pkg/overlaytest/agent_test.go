@@ -0,0 +1,247 @@
+package overlaytest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	core "k8s.io/api/core/v1"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	restclient "k8s.io/client-go/rest"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func testAgent(peers []string, unreachable string) *Agent {
+	agent := NewAgent(AgentConfig{
+		Port:        DefaultAgentPort,
+		Interval:    time.Minute,
+		PeerService: "overlaytest.test.svc",
+		NodeName:    "node-1",
+		PodIP:       "10.244.0.1",
+	})
+	agent.lookup = func(ctx context.Context, host string) ([]string, error) {
+		if host != "overlaytest.test.svc" {
+			return nil, errors.New("no such host")
+		}
+		return peers, nil
+	}
+	agent.probe = func(ctx context.Context, targetIP string) ProbeResult {
+		if targetIP == unreachable {
+			return ProbeResult{TargetIP: targetIP, ErrorClass: ErrorClassUnreachable}
+		}
+		return ProbeResult{TargetIP: targetIP, Reachable: true, RTT: time.Millisecond}
+	}
+	return agent
+}
+
+func TestAgentRunRound(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Probes all peers", func(t *testing.T) {
+		agent := testAgent([]string{"10.244.2.1", "10.244.0.1", "10.244.1.1"}, "10.244.2.1")
+
+		round, err := agent.RunRound(ctx)
+		if err != nil {
+			t.Fatalf("Expected no error, got: %v", err)
+		}
+		if len(round.Results) != 3 {
+			t.Fatalf("Expected 3 results, got %d", len(round.Results))
+		}
+
+		// Results are sorted by peer IP
+		if round.Results[0].TargetIP != "10.244.0.1" || round.Results[2].TargetIP != "10.244.2.1" {
+			t.Errorf("Expected results sorted by target IP, got %+v", round.Results)
+		}
+		for _, result := range round.Results {
+			if result.SourceNode != "node-1" {
+				t.Errorf("Expected source node node-1, got %s", result.SourceNode)
+			}
+		}
+		if round.Results[2].Reachable {
+			t.Error("Expected 10.244.2.1 to be unreachable")
+		}
+		if agent.Results() != round {
+			t.Error("Expected round to be stored as latest results")
+		}
+	})
+
+	t.Run("Peer lookup fails", func(t *testing.T) {
+		agent := testAgent(nil, "")
+		agent.config.PeerService = "unknown"
+
+		if _, err := agent.RunRound(ctx); err == nil {
+			t.Error("Expected error when peers cannot be resolved")
+		}
+		if agent.Results() != nil {
+			t.Error("Expected no results after failed round")
+		}
+	})
+}
+
+func TestAgentHandler(t *testing.T) {
+	agent := testAgent([]string{"10.244.0.1", "10.244.1.1"}, "")
+	handler := agent.Handler()
+
+	t.Run("Healthz", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+		if rec.Code != http.StatusOK {
+			t.Errorf("Expected status 200, got %d", rec.Code)
+		}
+	})
+
+	t.Run("No results yet", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/results", nil))
+		if rec.Code != http.StatusServiceUnavailable {
+			t.Errorf("Expected status 503, got %d", rec.Code)
+		}
+	})
+
+	t.Run("Refresh runs a round", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/results?refresh=true", nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d", rec.Code)
+		}
+
+		var results AgentResults
+		if err := json.Unmarshal(rec.Body.Bytes(), &results); err != nil {
+			t.Fatalf("Expected valid JSON, got: %v", err)
+		}
+		if results.Node != "node-1" || results.PodIP != "10.244.0.1" {
+			t.Errorf("Unexpected agent identity %s/%s", results.Node, results.PodIP)
+		}
+		if len(results.Results) != 2 {
+			t.Errorf("Expected 2 results, got %d", len(results.Results))
+		}
+	})
+
+	t.Run("Latest results", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/results", nil))
+		if rec.Code != http.StatusOK {
+			t.Errorf("Expected status 200, got %d", rec.Code)
+		}
+	})
+}
+
+func TestPingLocalInvalidTarget(t *testing.T) {
+	// Works without network access: ping either is missing or rejects the address
+	result := PingLocal(context.Background(), "invalid-ip")
+	if result.Reachable {
+		t.Error("Expected invalid target to be unreachable")
+	}
+	if result.ErrorClass == "" {
+		t.Error("Expected error class to be set")
+	}
+}
+
+// fakeProxyResponse serves a fixed body for API server proxy requests
+type fakeProxyResponse struct {
+	body []byte
+	err  error
+}
+
+func (f fakeProxyResponse) DoRaw(context.Context) ([]byte, error) {
+	return f.body, f.err
+}
+
+func (f fakeProxyResponse) Stream(context.Context) (io.ReadCloser, error) {
+	return io.NopCloser(bytes.NewReader(f.body)), f.err
+}
+
+func TestCollectAgentResults(t *testing.T) {
+	ctx := context.Background()
+	namespace := "test-namespace"
+
+	pods := []core.Pod{
+		{
+			ObjectMeta: meta.ObjectMeta{Name: "overlaytest-a", Namespace: namespace, Labels: map[string]string{"app": "overlaytest"}},
+			Spec:       core.PodSpec{NodeName: "node-1"},
+			Status:     core.PodStatus{PodIP: "10.244.0.1"},
+		},
+		{
+			ObjectMeta: meta.ObjectMeta{Name: "overlaytest-b", Namespace: namespace, Labels: map[string]string{"app": "overlaytest"}},
+			Spec:       core.PodSpec{NodeName: "node-2"},
+			Status:     core.PodStatus{PodIP: "10.244.1.1"},
+		},
+		{
+			ObjectMeta: meta.ObjectMeta{Name: "overlaytest-c", Namespace: namespace, Labels: map[string]string{"app": "overlaytest"}},
+			Spec:       core.PodSpec{NodeName: "node-3"},
+			Status:     core.PodStatus{PodIP: "10.244.2.1"},
+		},
+	}
+
+	clientset := fake.NewSimpleClientset(&pods[0], &pods[1], &pods[2])
+	clientset.PrependProxyReactor("pods", func(action k8stesting.Action) (bool, restclient.ResponseWrapper, error) {
+		proxy := action.(k8stesting.ProxyGetAction)
+		switch proxy.GetName() {
+		case "overlaytest-b":
+			return true, fakeProxyResponse{err: errors.New("proxy error")}, nil
+		case "overlaytest-c":
+			return true, fakeProxyResponse{body: []byte("<html>bad gateway</html>")}, nil
+		}
+		if proxy.GetParams()["refresh"] != "true" {
+			t.Errorf("Expected refresh of agent results, got params %v", proxy.GetParams())
+		}
+		// 10.244.2.1 is missing from the peers, 10.244.9.9 was not selected
+		body, _ := json.Marshal(AgentResults{
+			Node: "node-1",
+			Results: []ProbeResult{
+				{SourceNode: "node-1", TargetIP: "10.244.0.1", Reachable: true},
+				{SourceNode: "node-1", TargetIP: "10.244.1.1", ErrorClass: ErrorClassUnreachable},
+				{SourceNode: "node-1", TargetIP: "10.244.9.9", Reachable: true},
+			},
+		})
+		return true, fakeProxyResponse{body: body}, nil
+	})
+
+	report, err := CollectAgentResults(ctx, clientset, namespace, pods)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	// One result per selected pair, in the order of the pods
+	if len(report.Results) != 9 {
+		t.Fatalf("Expected 9 results, got %d: %+v", len(report.Results), report.Results)
+	}
+	for i, result := range report.Results {
+		if source, target := pods[i/3].Spec.NodeName, pods[i%3].Spec.NodeName; result.SourceNode != source || result.TargetNode != target {
+			t.Errorf("Expected %s -> %s, got %+v", source, target, result)
+		}
+	}
+	if !report.Results[0].Reachable {
+		t.Errorf("Expected node-1 -> node-1 to be reachable, got %+v", report.Results[0])
+	}
+	if report.Results[1].Reachable || report.Results[1].ErrorClass != ErrorClassUnreachable {
+		t.Errorf("Expected node-1 -> node-2 to be unreachable, got %+v", report.Results[1])
+	}
+	if result := report.Results[2]; result.Reachable || result.ErrorClass != ErrorClassExec || !strings.Contains(result.Error, "missing from its peers") {
+		t.Errorf("Expected node-1 -> node-3 to fail as missing peer, got %+v", result)
+	}
+
+	// Agents on overlaytest-b and overlaytest-c could not be reached or sent invalid results
+	for _, result := range report.Results[3:] {
+		if result.Reachable || result.ErrorClass != ErrorClassExec || result.Error == "" {
+			t.Errorf("Expected failed probe from agent without results, got %+v", result)
+		}
+	}
+	if !strings.Contains(report.Results[6].Error, "invalid results") {
+		t.Errorf("Expected the decode error, got %s", report.Results[6].Error)
+	}
+	if failures := report.Failures(); len(failures) != 8 {
+		t.Errorf("Expected 8 failures, got %d", len(failures))
+	}
+	if len(report.Nodes) != 3 {
+		t.Errorf("Expected 3 nodes in report, got %d", len(report.Nodes))
+	}
+}
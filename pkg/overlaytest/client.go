@@ -1,14 +1,57 @@
 package overlaytest
 
 import (
+	"path/filepath"
+	"time"
+
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
 )
 
-// NewKubernetesClient creates a new Kubernetes clientset
-func NewKubernetesClient(kubeconfig string) (kubernetes.Interface, *rest.Config, error) {
-	config, err := clientcmd.BuildConfigFromFlags("", kubeconfig)
+// ClientOptions select and override the kubeconfig settings like the kubectl connection flags
+type ClientOptions struct {
+	// Kubeconfig is a path or a list of paths separated like in KUBECONFIG, merged in order
+	Kubeconfig string
+	Context    string
+	Cluster    string
+	User       string
+	Server     string
+	Token      string
+	// As and AsGroups impersonate a user or service account and its groups
+	As             string
+	AsGroups       []string
+	RequestTimeout time.Duration
+}
+
+// loadingRules reads a single kubeconfig strictly and merges lists like kubectl, missing
+// files of a list are skipped
+func (o ClientOptions) loadingRules() *clientcmd.ClientConfigLoadingRules {
+	paths := filepath.SplitList(o.Kubeconfig)
+	if len(paths) == 1 {
+		return &clientcmd.ClientConfigLoadingRules{ExplicitPath: paths[0]}
+	}
+	return &clientcmd.ClientConfigLoadingRules{Precedence: paths}
+}
+
+func (o ClientOptions) overrides() *clientcmd.ConfigOverrides {
+	overrides := &clientcmd.ConfigOverrides{CurrentContext: o.Context}
+	overrides.Context.Cluster = o.Cluster
+	overrides.Context.AuthInfo = o.User
+	overrides.ClusterInfo.Server = o.Server
+	overrides.AuthInfo.Token = o.Token
+	overrides.AuthInfo.Impersonate = o.As
+	overrides.AuthInfo.ImpersonateGroups = o.AsGroups
+	if o.RequestTimeout > 0 {
+		overrides.Timeout = o.RequestTimeout.String()
+	}
+	return overrides
+}
+
+// NewClient creates a Kubernetes clientset from the kubeconfig and the overrides of the options.
+// Without any kubeconfig the in-cluster config is used.
+func NewClient(options ClientOptions) (kubernetes.Interface, *rest.Config, error) {
+	config, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(options.loadingRules(), options.overrides()).ClientConfig()
 	if err != nil {
 		return nil, nil, err
 	}
@@ -20,3 +63,8 @@ func NewKubernetesClient(kubeconfig string) (kubernetes.Interface, *rest.Config,
 
 	return clientset, config, nil
 }
+
+// NewKubernetesClient creates a new Kubernetes clientset for the current context of the kubeconfig
+func NewKubernetesClient(kubeconfig string) (kubernetes.Interface, *rest.Config, error) {
+	return NewClient(ClientOptions{Kubeconfig: kubeconfig})
+}
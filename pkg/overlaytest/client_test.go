@@ -3,7 +3,12 @@ package overlaytest
 import (
 	"os"
 	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
+
+	"k8s.io/client-go/rest"
 )
 
 func TestNewKubernetesClient(t *testing.T) {
@@ -84,3 +89,73 @@ func TestNewKubernetesClientErrorHandling(t *testing.T) {
 		})
 	}
 }
+
+func TestNewClient(t *testing.T) {
+	path := writeFleetKubeconfig(t)
+	other := filepath.Join(t.TempDir(), "other")
+	if err := os.WriteFile(other, []byte(`apiVersion: v1
+kind: Config
+clusters:
+- name: dev
+  cluster:
+    server: https://dev.example.com
+contexts:
+- name: dev
+  context: {cluster: dev}
+`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		options ClientOptions
+		check   func(t *testing.T, config *rest.Config)
+	}{
+		{"Current context", ClientOptions{Kubeconfig: path}, func(t *testing.T, config *rest.Config) {
+			if config.Host != "https://staging.example.com" {
+				t.Errorf("Expected the current context, got %s", config.Host)
+			}
+		}},
+		{"Context", ClientOptions{Kubeconfig: path, Context: "prod-eu"}, func(t *testing.T, config *rest.Config) {
+			if config.Host != "https://prod-eu.example.com" {
+				t.Errorf("Expected the prod-eu server, got %s", config.Host)
+			}
+		}},
+		{"Cluster of another context", ClientOptions{Kubeconfig: path, Cluster: "prod-us"}, func(t *testing.T, config *rest.Config) {
+			if config.Host != "https://prod-us.example.com" || config.BearerToken != "secret" {
+				t.Errorf("Expected the prod-us server with the admin token, got %s", config.Host)
+			}
+		}},
+		{"Server, token and timeout", ClientOptions{Kubeconfig: path, Server: "https://10.0.0.1:6443", Token: "override", RequestTimeout: 30 * time.Second}, func(t *testing.T, config *rest.Config) {
+			if config.Host != "https://10.0.0.1:6443" || config.BearerToken != "override" || config.Timeout != 30*time.Second {
+				t.Errorf("Expected the overrides, got host %s, timeout %s", config.Host, config.Timeout)
+			}
+		}},
+		{"Impersonation", ClientOptions{Kubeconfig: path, As: "system:serviceaccount:kube-system:overlaytest", AsGroups: []string{"system:serviceaccounts"}}, func(t *testing.T, config *rest.Config) {
+			if config.Impersonate.UserName != "system:serviceaccount:kube-system:overlaytest" ||
+				!reflect.DeepEqual(config.Impersonate.Groups, []string{"system:serviceaccounts"}) {
+				t.Errorf("Expected impersonation, got %+v", config.Impersonate)
+			}
+		}},
+		{"Merged kubeconfig list", ClientOptions{Kubeconfig: strings.Join([]string{path, filepath.Join(t.TempDir(), "missing"), other}, string(filepath.ListSeparator)), Context: "dev"}, func(t *testing.T, config *rest.Config) {
+			if config.Host != "https://dev.example.com" {
+				t.Errorf("Expected the dev context of the second file, got %s", config.Host)
+			}
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, config, err := NewClient(tt.options)
+			if err != nil {
+				t.Fatalf("Expected no error, got: %v", err)
+			}
+			tt.check(t, config)
+		})
+	}
+
+	t.Run("Unknown context", func(t *testing.T) {
+		if _, _, err := NewClient(ClientOptions{Kubeconfig: path, Context: "missing"}); err == nil {
+			t.Error("Expected error for an unknown context")
+		}
+	})
+}
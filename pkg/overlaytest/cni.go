@@ -0,0 +1,215 @@
+package overlaytest
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	apps "k8s.io/api/apps/v1"
+	core "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// cniSignature identifies a CNI plugin by the name of its agent DaemonSet or its ConfigMap
+type cniSignature struct {
+	name       string
+	daemonSets []string
+	configMaps []string
+}
+
+// cniSignatures are checked in order, Canal before Calico and Flannel as it bundles both
+var cniSignatures = []cniSignature{
+	{name: "canal", daemonSets: []string{"canal"}, configMaps: []string{"canal-config"}},
+	{name: "cilium", daemonSets: []string{"cilium"}, configMaps: []string{"cilium-config"}},
+	{name: "calico", daemonSets: []string{"calico-node"}, configMaps: []string{"calico-config"}},
+	{name: "flannel", daemonSets: []string{"kube-flannel-ds", "kube-flannel"}, configMaps: []string{"kube-flannel-cfg"}},
+	{name: "weave", daemonSets: []string{"weave-net"}},
+	{name: "kube-router", daemonSets: []string{"kube-router"}, configMaps: []string{"kube-router-cfg"}},
+	{name: "antrea", daemonSets: []string{"antrea-agent"}, configMaps: []string{"antrea-config"}},
+	{name: "kube-ovn", daemonSets: []string{"kube-ovn-cni"}},
+	{name: "ovn-kubernetes", daemonSets: []string{"ovnkube-node"}},
+	{name: "aws-vpc-cni", daemonSets: []string{"aws-node"}},
+	{name: "azure-cni", daemonSets: []string{"azure-cns", "azure-cni"}},
+}
+
+// cniNamespaces are searched for CNI agents, operators install them outside of kube-system
+var cniNamespaces = []string{meta.NamespaceSystem, "calico-system", "kube-flannel", "cilium", "antrea-system", "kube-ovn", "openshift-ovn-kubernetes"}
+
+// CNIInfo describes the detected CNI plugin of the cluster
+type CNIInfo struct {
+	Name      string `json:"name"`
+	Namespace string `json:"namespace,omitempty"`
+	// DaemonSet is the agent DaemonSet, empty if the plugin was only found by its ConfigMap
+	DaemonSet string `json:"daemonSet,omitempty"`
+	Version   string `json:"version,omitempty"`
+
+	selector *meta.LabelSelector
+}
+
+// CNIAgentStatus is the state of the CNI agent pod on a node with failed probes
+type CNIAgentStatus struct {
+	Node     string `json:"node"`
+	Pod      string `json:"pod,omitempty"`
+	Ready    bool   `json:"ready"`
+	Restarts int32  `json:"restarts"`
+	Message  string `json:"message,omitempty"`
+}
+
+// DetectCNI looks for the agent DaemonSets and ConfigMaps of well-known CNI plugins.
+// It returns nil if no known plugin was found.
+func DetectCNI(ctx context.Context, clientset kubernetes.Interface) (*CNIInfo, error) {
+	var lastErr error
+	for _, namespace := range cniNamespaces {
+		daemonsets, err := clientset.AppsV1().DaemonSets(namespace).List(ctx, meta.ListOptions{})
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if cni := matchCNIDaemonSets(daemonsets.Items); cni != nil {
+			return cni, nil
+		}
+	}
+
+	for _, signature := range cniSignatures {
+		for _, name := range signature.configMaps {
+			_, err := clientset.CoreV1().ConfigMaps(meta.NamespaceSystem).Get(ctx, name, meta.GetOptions{})
+			if err == nil {
+				return &CNIInfo{Name: signature.name, Namespace: meta.NamespaceSystem}, nil
+			}
+			if !errors.IsNotFound(err) {
+				lastErr = err
+			}
+		}
+	}
+	if lastErr != nil {
+		return nil, fmt.Errorf("error detecting CNI: %w", lastErr)
+	}
+	return nil, nil
+}
+
+func matchCNIDaemonSets(daemonsets []apps.DaemonSet) *CNIInfo {
+	byName := map[string]*apps.DaemonSet{}
+	for i := range daemonsets {
+		byName[daemonsets[i].Name] = &daemonsets[i]
+	}
+	for _, signature := range cniSignatures {
+		for _, name := range signature.daemonSets {
+			if daemonset, ok := byName[name]; ok {
+				return &CNIInfo{
+					Name:      signature.name,
+					Namespace: daemonset.Namespace,
+					DaemonSet: daemonset.Name,
+					Version:   imageTag(daemonset.Spec.Template.Spec.Containers),
+					selector:  daemonset.Spec.Selector,
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// imageTag returns the tag of the first container image
+func imageTag(containers []core.Container) string {
+	if len(containers) == 0 {
+		return ""
+	}
+	image := containers[0].Image
+	if i := strings.Index(image, "@"); i >= 0 {
+		image = image[:i]
+	}
+	if i := strings.LastIndex(image, ":"); i >= 0 && !strings.Contains(image[i:], "/") {
+		return image[i+1:]
+	}
+	return ""
+}
+
+// FailingNodes returns the nodes involved in failed probes
+func FailingNodes(report *Report) []string {
+	nodes := map[string]bool{}
+	for _, result := range report.Failures() {
+		nodes[result.SourceNode] = true
+		nodes[result.TargetNode] = true
+	}
+	return sortedKeys(nodes)
+}
+
+// CheckCNIAgents reports the CNI agent pod of every given node, e.g. the nodes with failed probes
+func CheckCNIAgents(ctx context.Context, clientset kubernetes.Interface, cni *CNIInfo, nodes []string) ([]CNIAgentStatus, error) {
+	if cni == nil || cni.DaemonSet == "" || len(nodes) == 0 {
+		return nil, nil
+	}
+	selector, err := meta.LabelSelectorAsSelector(cni.selector)
+	if err != nil {
+		return nil, fmt.Errorf("invalid selector of CNI daemonset %s: %w", cni.DaemonSet, err)
+	}
+	pods, err := clientset.CoreV1().Pods(cni.Namespace).List(ctx, meta.ListOptions{LabelSelector: selector.String()})
+	if err != nil {
+		return nil, fmt.Errorf("error listing CNI pods: %w", err)
+	}
+	podsByNode := map[string]*core.Pod{}
+	for i := range pods.Items {
+		podsByNode[pods.Items[i].Spec.NodeName] = &pods.Items[i]
+	}
+
+	statuses := make([]CNIAgentStatus, 0, len(nodes))
+	for _, node := range nodes {
+		pod, ok := podsByNode[node]
+		if !ok {
+			statuses = append(statuses, CNIAgentStatus{Node: node, Message: fmt.Sprintf("no %s agent pod on the node", cni.Name)})
+			continue
+		}
+		statuses = append(statuses, cniAgentStatus(node, pod))
+	}
+	return statuses, nil
+}
+
+func cniAgentStatus(node string, pod *core.Pod) CNIAgentStatus {
+	status := CNIAgentStatus{Node: node, Pod: pod.Name}
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == core.PodReady {
+			status.Ready = condition.Status == core.ConditionTrue
+		}
+	}
+
+	var problems []string
+	for _, container := range pod.Status.ContainerStatuses {
+		status.Restarts += container.RestartCount
+		switch {
+		case container.State.Waiting != nil:
+			problems = append(problems, fmt.Sprintf("%s is waiting: %s", container.Name, container.State.Waiting.Reason))
+		case container.State.Terminated != nil:
+			problems = append(problems, fmt.Sprintf("%s terminated: %s", container.Name, container.State.Terminated.Reason))
+		case !container.Ready:
+			problems = append(problems, fmt.Sprintf("%s is not ready", container.Name))
+		}
+	}
+	if !status.Ready && len(problems) == 0 {
+		problems = append(problems, fmt.Sprintf("pod is %s", pod.Status.Phase))
+	}
+	sort.Strings(problems)
+	status.Message = strings.Join(problems, ", ")
+	return status
+}
+
+// PrintCNIAgents writes the CNI of the report and the state of its agents on nodes with failed probes
+func PrintCNIAgents(w io.Writer, report *Report) {
+	cni := report.Metadata.CNI
+	if cni == nil || len(report.CNIAgents) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "\n%s agents on nodes with failed probes:\n", cni.Name)
+	for _, agent := range report.CNIAgents {
+		switch {
+		case agent.Pod == "":
+			fmt.Fprintf(w, "  ! %s: %s\n", agent.Node, agent.Message)
+		case !agent.Ready:
+			fmt.Fprintf(w, "  ! %s: %s is not ready (%d restarts): %s\n", agent.Node, agent.Pod, agent.Restarts, agent.Message)
+		default:
+			fmt.Fprintf(w, "    %s: %s is ready (%d restarts)\n", agent.Node, agent.Pod, agent.Restarts)
+		}
+	}
+}
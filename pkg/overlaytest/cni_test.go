@@ -0,0 +1,178 @@
+package overlaytest
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	apps "k8s.io/api/apps/v1"
+	core "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func cniDaemonSet(namespace, name, image string) *apps.DaemonSet {
+	labels := map[string]string{"k8s-app": name}
+	return &apps.DaemonSet{
+		ObjectMeta: meta.ObjectMeta{Name: name, Namespace: namespace},
+		Spec: apps.DaemonSetSpec{
+			Selector: &meta.LabelSelector{MatchLabels: labels},
+			Template: core.PodTemplateSpec{
+				ObjectMeta: meta.ObjectMeta{Labels: labels},
+				Spec:       core.PodSpec{Containers: []core.Container{{Name: name, Image: image}}},
+			},
+		},
+	}
+}
+
+func TestDetectCNI(t *testing.T) {
+	tests := []struct {
+		name     string
+		objects  []runtime.Object
+		expected *CNIInfo
+	}{
+		{
+			name:     "Calico",
+			objects:  []runtime.Object{cniDaemonSet("kube-system", "kube-proxy", "kube-proxy:v1.36.0"), cniDaemonSet("kube-system", "calico-node", "docker.io/calico/node:v3.30.1")},
+			expected: &CNIInfo{Name: "calico", Namespace: "kube-system", DaemonSet: "calico-node", Version: "v3.30.1"},
+		},
+		{
+			name:     "Calico operator",
+			objects:  []runtime.Object{cniDaemonSet("calico-system", "calico-node", "calico/node:v3.30.1@sha256:abc")},
+			expected: &CNIInfo{Name: "calico", Namespace: "calico-system", DaemonSet: "calico-node", Version: "v3.30.1"},
+		},
+		{
+			name:     "Canal wins over its calico and flannel parts",
+			objects:  []runtime.Object{cniDaemonSet("kube-system", "canal", "registry:5000/calico/node"), cniDaemonSet("kube-system", "kube-flannel-ds", "flannel:v0.26.0")},
+			expected: &CNIInfo{Name: "canal", Namespace: "kube-system", DaemonSet: "canal"},
+		},
+		{
+			name:     "Flannel",
+			objects:  []runtime.Object{cniDaemonSet("kube-flannel", "kube-flannel-ds", "ghcr.io/flannel-io/flannel:v0.26.0")},
+			expected: &CNIInfo{Name: "flannel", Namespace: "kube-flannel", DaemonSet: "kube-flannel-ds", Version: "v0.26.0"},
+		},
+		{
+			name:     "Cilium by configmap",
+			objects:  []runtime.Object{&core.ConfigMap{ObjectMeta: meta.ObjectMeta{Name: "cilium-config", Namespace: "kube-system"}}},
+			expected: &CNIInfo{Name: "cilium", Namespace: "kube-system"},
+		},
+		{
+			name:     "Unknown",
+			objects:  []runtime.Object{cniDaemonSet("kube-system", "kube-proxy", "kube-proxy:v1.36.0")},
+			expected: nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cni, err := DetectCNI(context.Background(), fake.NewSimpleClientset(tt.objects...))
+			if err != nil {
+				t.Fatalf("Expected no error, got: %v", err)
+			}
+			if cni != nil {
+				cni.selector = nil
+			}
+			if !reflect.DeepEqual(cni, tt.expected) {
+				t.Errorf("Expected %+v, got %+v", tt.expected, cni)
+			}
+		})
+	}
+}
+
+func TestDetectCNIForbidden(t *testing.T) {
+	clientset := fake.NewSimpleClientset()
+	clientset.PrependReactor("list", "daemonsets", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, errors.NewForbidden(schema.GroupResource{Group: "apps", Resource: "daemonsets"}, "", nil)
+	})
+	clientset.PrependReactor("get", "configmaps", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, errors.NewForbidden(schema.GroupResource{Resource: "configmaps"}, "cilium-config", nil)
+	})
+
+	cni, err := DetectCNI(context.Background(), clientset)
+	if err == nil || cni != nil {
+		t.Errorf("Expected an error without permissions, got %+v, %v", cni, err)
+	}
+}
+
+func TestCheckCNIAgents(t *testing.T) {
+	daemonset := cniDaemonSet("kube-system", "calico-node", "calico/node:v3.30.1")
+	labels := daemonset.Spec.Template.Labels
+	ready := &core.Pod{
+		ObjectMeta: meta.ObjectMeta{Name: "calico-node-a", Namespace: "kube-system", Labels: labels},
+		Spec:       core.PodSpec{NodeName: "node-1"},
+		Status: core.PodStatus{
+			Phase:             core.PodRunning,
+			Conditions:        []core.PodCondition{{Type: core.PodReady, Status: core.ConditionTrue}},
+			ContainerStatuses: []core.ContainerStatus{{Name: "calico-node", Ready: true, RestartCount: 1}},
+		},
+	}
+	crashing := &core.Pod{
+		ObjectMeta: meta.ObjectMeta{Name: "calico-node-b", Namespace: "kube-system", Labels: labels},
+		Spec:       core.PodSpec{NodeName: "node-2"},
+		Status: core.PodStatus{
+			Phase:      core.PodRunning,
+			Conditions: []core.PodCondition{{Type: core.PodReady, Status: core.ConditionFalse}},
+			ContainerStatuses: []core.ContainerStatus{{
+				Name:         "calico-node",
+				RestartCount: 7,
+				State:        core.ContainerState{Waiting: &core.ContainerStateWaiting{Reason: "CrashLoopBackOff"}},
+			}},
+		},
+	}
+	clientset := fake.NewSimpleClientset(daemonset, ready, crashing)
+
+	cni, err := DetectCNI(context.Background(), clientset)
+	if err != nil || cni == nil {
+		t.Fatalf("Expected calico to be detected, got %+v, %v", cni, err)
+	}
+	agents, err := CheckCNIAgents(context.Background(), clientset, cni, []string{"node-1", "node-2", "node-3"})
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	expected := []CNIAgentStatus{
+		{Node: "node-1", Pod: "calico-node-a", Ready: true, Restarts: 1},
+		{Node: "node-2", Pod: "calico-node-b", Restarts: 7, Message: "calico-node is waiting: CrashLoopBackOff"},
+		{Node: "node-3", Message: "no calico agent pod on the node"},
+	}
+	if !reflect.DeepEqual(agents, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, agents)
+	}
+
+	if agents, err := CheckCNIAgents(context.Background(), clientset, &CNIInfo{Name: "cilium"}, []string{"node-1"}); err != nil || agents != nil {
+		t.Errorf("Expected no check without agent DaemonSet, got %+v, %v", agents, err)
+	}
+}
+
+func TestFailingNodes(t *testing.T) {
+	if nodes := FailingNodes(testReport()); !reflect.DeepEqual(nodes, []string{"node-1", "node-2"}) {
+		t.Errorf("Expected node-1 and node-2, got %v", nodes)
+	}
+}
+
+func TestPrintCNIAgents(t *testing.T) {
+	report := testReport()
+	report.Metadata.CNI = &CNIInfo{Name: "calico"}
+	report.CNIAgents = []CNIAgentStatus{
+		{Node: "node-1", Pod: "calico-node-a", Ready: true},
+		{Node: "node-2", Pod: "calico-node-b", Restarts: 7, Message: "calico-node is waiting: CrashLoopBackOff"},
+	}
+
+	var buf bytes.Buffer
+	PrintCNIAgents(&buf, report)
+	output := buf.String()
+	for _, expected := range []string{
+		"calico agents on nodes with failed probes:",
+		"node-1: calico-node-a is ready (0 restarts)",
+		"! node-2: calico-node-b is not ready (7 restarts): calico-node is waiting: CrashLoopBackOff",
+	} {
+		if !strings.Contains(output, expected) {
+			t.Errorf("Expected output to contain %q, got:\n%s", expected, output)
+		}
+	}
+}
@@ -1,19 +1,117 @@
 package overlaytest
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
 
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/validation"
 	"k8s.io/client-go/util/homedir"
+	"sigs.k8s.io/yaml"
+)
+
+// Output formats
+const (
+	OutputText   = "text"
+	OutputJSON   = "json"
+	OutputMatrix = "matrix"
 )
 
 // Config holds the application configuration
 type Config struct {
-	Namespace  string
-	AppName    string
-	Image      string
-	Kubeconfig string
-	Reuse      bool
+	Namespace  string `json:"namespace,omitempty"`
+	AppName    string `json:"appName,omitempty"`
+	Image      string `json:"image,omitempty"`
+	Kubeconfig string `json:"kubeconfig,omitempty"`
+	// Context, Cluster, User, Server, Token, As and AsGroups override the kubeconfig like the kubectl flags
+	Context  string   `json:"context,omitempty"`
+	Cluster  string   `json:"cluster,omitempty"`
+	User     string   `json:"user,omitempty"`
+	Server   string   `json:"server,omitempty"`
+	Token    string   `json:"token,omitempty"`
+	As       string   `json:"as,omitempty"`
+	AsGroups []string `json:"asGroups,omitempty"`
+	// RequestTimeout limits a single API request, 0 for no limit
+	RequestTimeout time.Duration `json:"-"`
+	// Contexts are the kubeconfig contexts tested in one run: names, globs or "all", empty tests the current context
+	Contexts []string `json:"contexts,omitempty"`
+	// Parallel is the number of clusters tested at once
+	Parallel int  `json:"parallel,omitempty"`
+	Reuse    bool `json:"reuse,omitempty"`
+	// Cleanup removes the test resources after the run, e.g. for scheduled runs
+	Cleanup bool `json:"cleanup,omitempty"`
+
+	// CreateNamespace creates a dedicated namespace labeled for the security mode and deletes it on cleanup
+	CreateNamespace bool `json:"createNamespace,omitempty"`
+
+	// Events records Kubernetes Events for failed probes on the affected nodes
+	Events bool `json:"events,omitempty"`
+
+	// Batch pings all targets of a source pod with a single exec
+	Batch bool `json:"batch,omitempty"`
+
+	// Agent runs the probes from an agent inside the DaemonSet pods instead of exec
+	Agent bool `json:"agent,omitempty"`
+
+	// Monitor mode keeps running the test and exposes Prometheus metrics
+	Monitor     bool          `json:"monitor,omitempty"`
+	Interval    time.Duration `json:"-"`
+	MetricsAddr string        `json:"metricsAddr,omitempty"`
+
+	// ProbeTypes lists the probes run between each node pair
+	ProbeTypes []string `json:"probeTypes,omitempty"`
+	// NodeSelector is a label selector restricting the nodes under test
+	NodeSelector string `json:"nodeSelector,omitempty"`
+	// Throughput measures the bandwidth between agents: all, random or zone sampled node pairs, empty disables it
+	Throughput string `json:"throughput,omitempty"`
+	// ThroughputPairs is the number of random pairs
+	ThroughputPairs int `json:"throughputPairs,omitempty"`
+	// ThroughputDuration is the duration of a stream
+	ThroughputDuration time.Duration `json:"-"`
+	// LatencySamples is the number of pings per node pair of the latency measurement, 0 disables it
+	LatencySamples int `json:"latencySamples,omitempty"`
+	// LatencySLO are the latency thresholds per zone pair, see ParseLatencySLOs
+	LatencySLO string `json:"latencySLO,omitempty"`
+	// Traceroute traces failed pairs with icmp or udp, empty disables it
+	Traceroute string `json:"traceroute,omitempty"`
+	// SkipCNI skips the detection of the CNI plugin and the check of its agents, which read DaemonSets and pods cluster wide
+	SkipCNI bool `json:"skipCNI,omitempty"`
+	// NodePoolLabel is the node label results are grouped by as node pools, well-known labels are detected if empty
+	NodePoolLabel string `json:"nodePoolLabel,omitempty"`
+
+	// ReadyTimeout limits the wait for the DaemonSet and pod network, 0 waits forever
+	ReadyTimeout time.Duration `json:"-"`
+	// RunTimeout limits a single test run, 0 for no limit
+	RunTimeout time.Duration `json:"-"`
+
+	// SecurityMode selects the privileges of the test pods: privileged, netraw, baseline or restricted
+	SecurityMode string `json:"securityMode,omitempty"`
+
+	// PodTemplate customizes the pods of the test DaemonSet
+	PodTemplate PodTemplateOverrides `json:"podTemplate,omitempty"`
+	// DaemonSetPatch is a strategic merge patch in YAML or JSON applied to the generated DaemonSet
+	DaemonSetPatch string `json:"daemonSetPatch,omitempty"`
+
+	// Output is the result format (text, matrix or json), written to OutputFile or stdout
+	Output     string `json:"output,omitempty"`
+	OutputFile string `json:"outputFile,omitempty"`
+	// LogFormat writes progress messages and warnings as text or JSON log records
+	LogFormat string `json:"logFormat,omitempty"`
+
+	// HistoryDir stores the report of every run in <dir>/<cluster>/<timestamp>.json
+	HistoryDir string `json:"historyDir,omitempty"`
+	// HistoryConfigMap stores the reports of the last runs in the ConfigMap <app>-history of the namespace
+	HistoryConfigMap bool `json:"historyConfigMap,omitempty"`
+
+	// DiagnosticsDir receives a diagnostics tarball when probes fail, empty disables it
+	DiagnosticsDir string `json:"diagnosticsDir,omitempty"`
 }
 
 // DefaultConfig returns default configuration
@@ -23,8 +121,363 @@ func DefaultConfig() *Config {
 		AppName:   "overlaytest",
 		// Default image: minimal Alpine-based image with bash and ping (~10MB compressed)
 		// Previous image (deprecated): mtr.devops.telekom.de/mcsps/swiss-army-knife:latest
-		Image: "ghcr.io/eumel8/overlaytest:main",
+		Image:              "ghcr.io/eumel8/overlaytest:main",
+		Interval:           5 * time.Minute,
+		MetricsAddr:        ":9090",
+		ProbeTypes:         []string{ProbeTypeICMP},
+		SecurityMode:       SecurityModePrivileged,
+		Output:             OutputText,
+		LogFormat:          LogFormatText,
+		DiagnosticsDir:     ".",
+		Parallel:           4,
+		ThroughputPairs:    10,
+		ThroughputDuration: 5 * time.Second,
+	}
+}
+
+// UnmarshalJSON reads durations in the config file as strings like "5m" and rejects unknown keys
+func (c *Config) UnmarshalJSON(data []byte) error {
+	type plain Config
+	file := struct {
+		*plain
+		Interval     *string `json:"interval,omitempty"`
+		ReadyTimeout *string `json:"readyTimeout,omitempty"`
+		RunTimeout   *string `json:"runTimeout,omitempty"`
+
+		RequestTimeout *string `json:"requestTimeout,omitempty"`
+
+		ThroughputDuration *string `json:"throughputDuration,omitempty"`
+	}{plain: (*plain)(c)}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&file); err != nil {
+		return err
+	}
+
+	var errs []error
+	for name, field := range map[string]struct {
+		value  *string
+		target *time.Duration
+	}{
+		"interval":     {file.Interval, &c.Interval},
+		"readyTimeout": {file.ReadyTimeout, &c.ReadyTimeout},
+		"runTimeout":   {file.RunTimeout, &c.RunTimeout},
+
+		"requestTimeout": {file.RequestTimeout, &c.RequestTimeout},
+
+		"throughputDuration": {file.ThroughputDuration, &c.ThroughputDuration},
+	} {
+		if field.value == nil {
+			continue
+		}
+		duration, err := time.ParseDuration(*field.value)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+			continue
+		}
+		*field.target = duration
+	}
+	return errors.Join(errs...)
+}
+
+// LoadConfigFile reads a YAML config file on top of the current values
+func (c *Config) LoadConfigFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("error reading config file: %w", err)
+	}
+	if err := yaml.UnmarshalStrict(data, c); err != nil {
+		return fmt.Errorf("error parsing config file %s: %w", path, err)
+	}
+	return nil
+}
+
+// ConfigField is a setting which can be set by environment variable and command line flag
+type ConfigField struct {
+	// Name is the flag name, the environment variable is OVERLAYTEST_<NAME> in upper snake case
+	Name  string
+	Usage string
+	Bool  bool
+	Set   func(c *Config, value string) error
+}
+
+// EnvName returns the environment variable overriding the field
+func (f ConfigField) EnvName() string {
+	return "OVERLAYTEST_" + strings.ToUpper(strings.ReplaceAll(f.Name, "-", "_"))
+}
+
+func setString(target func(c *Config) *string) func(c *Config, value string) error {
+	return func(c *Config, value string) error {
+		*target(c) = value
+		return nil
+	}
+}
+
+func setBool(target func(c *Config) *bool) func(c *Config, value string) error {
+	return func(c *Config, value string) error {
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		*target(c) = b
+		return nil
+	}
+}
+
+func setInt(target func(c *Config) *int) func(c *Config, value string) error {
+	return func(c *Config, value string) error {
+		i, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		*target(c) = i
+		return nil
+	}
+}
+
+func setDuration(target func(c *Config) *time.Duration) func(c *Config, value string) error {
+	return func(c *Config, value string) error {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		*target(c) = d
+		return nil
+	}
+}
+
+// ConfigFields lists all settings available as environment variable and command line flag
+var ConfigFields = []ConfigField{
+	{Name: "kubeconfig", Usage: "(optional) absolute path to the kubeconfig file, empty for in-cluster config", Set: setString(func(c *Config) *string { return &c.Kubeconfig })},
+	{Name: "context", Usage: "kubeconfig context to use (default the current context)", Set: setString(func(c *Config) *string { return &c.Context })},
+	{Name: "cluster", Usage: "kubeconfig cluster to use", Set: setString(func(c *Config) *string { return &c.Cluster })},
+	{Name: "user", Usage: "kubeconfig user to use", Set: setString(func(c *Config) *string { return &c.User })},
+	{Name: "server", Usage: "address of the Kubernetes API server", Set: setString(func(c *Config) *string { return &c.Server })},
+	{Name: "token", Usage: "bearer token for the API server", Set: setString(func(c *Config) *string { return &c.Token })},
+	{Name: "as", Usage: "user or service account to impersonate", Set: setString(func(c *Config) *string { return &c.As })},
+	{Name: "as-group", Usage: "group to impersonate, can be repeated", Set: func(c *Config, value string) error {
+		c.AsGroups = append(c.AsGroups, value)
+		return nil
+	}},
+	{Name: "request-timeout", Usage: "maximum duration of a single API request, 0 for no limit", Set: setDuration(func(c *Config) *time.Duration { return &c.RequestTimeout })},
+	{Name: "contexts", Usage: "comma separated kubeconfig contexts, globs or all, tested in parallel with a fleet summary", Set: func(c *Config, value string) error {
+		c.Contexts = strings.Split(value, ",")
+		return nil
+	}},
+	{Name: "parallel", Usage: "number of clusters tested at once with -contexts (default 4)", Set: setInt(func(c *Config) *int { return &c.Parallel })},
+	{Name: "namespace", Usage: "namespace to deploy the DaemonSet to (default kube-system)", Set: setString(func(c *Config) *string { return &c.Namespace })},
+	{Name: "app-name", Usage: "name of the DaemonSet (default overlaytest)", Set: setString(func(c *Config) *string { return &c.AppName })},
+	{Name: "image", Usage: "test image, needs sh and ping", Set: setString(func(c *Config) *string { return &c.Image })},
+	{Name: "create-namespace", Usage: "create the namespace with Pod Security labels for the security mode and delete it on cleanup", Bool: true, Set: setBool(func(c *Config) *bool { return &c.CreateNamespace })},
+	{Name: "reuse", Usage: "reuse existing deployment", Bool: true, Set: setBool(func(c *Config) *bool { return &c.Reuse })},
+	{Name: "cleanup", Usage: "remove the test resources after the run", Bool: true, Set: setBool(func(c *Config) *bool { return &c.Cleanup })},
+	{Name: "events", Usage: "record Kubernetes Events for failed probes on the affected nodes", Bool: true, Set: setBool(func(c *Config) *bool { return &c.Events })},
+	{Name: "batch", Usage: "ping all targets of a pod with a single exec instead of one exec per node pair", Bool: true, Set: setBool(func(c *Config) *bool { return &c.Batch })},
+	{Name: "agent", Usage: "probe from an agent in the pods instead of exec (image must contain the overlaytest binary)", Bool: true, Set: setBool(func(c *Config) *bool { return &c.Agent })},
+	{Name: "monitor", Usage: "run the test repeatedly and expose Prometheus metrics", Bool: true, Set: setBool(func(c *Config) *bool { return &c.Monitor })},
+	{Name: "interval", Usage: "time between test runs in monitor mode (default 5m)", Set: setDuration(func(c *Config) *time.Duration { return &c.Interval })},
+	{Name: "metrics-addr", Usage: "listen address of the /metrics endpoint in monitor mode (default :9090)", Set: setString(func(c *Config) *string { return &c.MetricsAddr })},
+	{Name: "probe-types", Usage: "comma separated list of probes to run (default icmp)", Set: func(c *Config, value string) error {
+		c.ProbeTypes = strings.Split(value, ",")
+		return nil
+	}},
+	{Name: "node-selector", Usage: "label selector restricting the nodes under test", Set: setString(func(c *Config) *string { return &c.NodeSelector })},
+	{Name: "throughput", Usage: "measure the bandwidth between agents of all, random or one pair per zone pair (requires -agent)", Set: setString(func(c *Config) *string { return &c.Throughput })},
+	{Name: "throughput-pairs", Usage: "number of node pairs measured with -throughput random (default 10)", Set: setInt(func(c *Config) *int { return &c.ThroughputPairs })},
+	{Name: "throughput-duration", Usage: "duration of each throughput stream (default 5s)", Set: setDuration(func(c *Config) *time.Duration { return &c.ThroughputDuration })},
+	{Name: "latency-samples", Usage: "measure the latency percentiles of every node pair with this number of pings, 0 disables it", Set: setInt(func(c *Config) *int { return &c.LatencySamples })},
+	{Name: "latency-slo", Usage: "comma separated latency thresholds SOURCE-ZONE/TARGET-ZONE[@p50|p90|p99|max]=DURATION, * matches all zones", Set: setString(func(c *Config) *string { return &c.LatencySLO })},
+	{Name: "traceroute", Usage: "trace failed pairs with icmp or udp traceroute", Set: setString(func(c *Config) *string { return &c.Traceroute })},
+	{Name: "skip-cni", Usage: "skip the detection of the CNI plugin and the check of its agents", Bool: true, Set: setBool(func(c *Config) *bool { return &c.SkipCNI })},
+	{Name: "node-pool-label", Usage: "node label grouping the results by node pool (default well-known cloud provider labels)", Set: setString(func(c *Config) *string { return &c.NodePoolLabel })},
+	{Name: "ready-timeout", Usage: "maximum wait for the DaemonSet and pod network, 0 waits forever", Set: setDuration(func(c *Config) *time.Duration { return &c.ReadyTimeout })},
+	{Name: "run-timeout", Usage: "maximum duration of a test run, 0 for no limit", Set: setDuration(func(c *Config) *time.Duration { return &c.RunTimeout })},
+	{Name: "security-mode", Usage: "privileges of the test pods: privileged, netraw, baseline or restricted (default privileged)", Set: setString(func(c *Config) *string { return &c.SecurityMode })},
+	{Name: "image-pull-secrets", Usage: "comma separated list of image pull secrets for the test pods", Set: func(c *Config, value string) error {
+		c.PodTemplate.ImagePullSecrets = strings.Split(value, ",")
+		return nil
+	}},
+	{Name: "priority-class-name", Usage: "priority class of the test pods", Set: setString(func(c *Config) *string { return &c.PodTemplate.PriorityClassName })},
+	{Name: "daemonset-patch-file", Usage: "file with a strategic merge patch applied to the generated DaemonSet", Set: func(c *Config, value string) error {
+		patch, err := os.ReadFile(value)
+		if err != nil {
+			return err
+		}
+		c.DaemonSetPatch = string(patch)
+		return nil
+	}},
+	{Name: "output", Usage: "result format: text, matrix or json (default text)", Set: setString(func(c *Config) *string { return &c.Output })},
+	{Name: "output-file", Usage: "write the result to this file instead of stdout", Set: setString(func(c *Config) *string { return &c.OutputFile })},
+	{Name: "log-format", Usage: "format of progress messages and warnings: text or json (default text)", Set: setString(func(c *Config) *string { return &c.LogFormat })},
+	{Name: "history-dir", Usage: "store the result of every run in this directory", Set: setString(func(c *Config) *string { return &c.HistoryDir })},
+	{Name: "diagnostics-dir", Usage: "write a diagnostics tarball into this directory when probes fail, empty to disable (default .)", Set: setString(func(c *Config) *string { return &c.DiagnosticsDir })},
+	{Name: "history-configmap", Usage: "store the results of the last runs in a ConfigMap in the namespace", Bool: true, Set: setBool(func(c *Config) *bool { return &c.HistoryConfigMap })},
+}
+
+// ApplyEnv overrides settings from OVERLAYTEST_* environment variables
+func (c *Config) ApplyEnv(lookup func(string) (string, bool)) error {
+	var errs []error
+	for _, field := range ConfigFields {
+		value, ok := lookup(field.EnvName())
+		if !ok {
+			continue
+		}
+		if err := field.Set(c, value); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", field.EnvName(), err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Validate checks the configuration and reports all problems at once
+func (c *Config) Validate() error {
+	var errs []error
+
+	for _, msg := range validation.IsDNS1123Label(c.Namespace) {
+		errs = append(errs, fmt.Errorf("namespace %q: %s", c.Namespace, msg))
+	}
+	if c.CreateNamespace && systemNamespaces[c.Namespace] {
+		errs = append(errs, fmt.Errorf("create namespace needs a dedicated namespace, not %s", c.Namespace))
+	}
+	for _, msg := range validation.IsDNS1123Label(c.AppName) {
+		errs = append(errs, fmt.Errorf("app name %q: %s", c.AppName, msg))
+	}
+	if c.Image == "" {
+		errs = append(errs, errors.New("image must not be empty"))
+	}
+	if c.Batch && c.Agent {
+		errs = append(errs, errors.New("batch and agent mode are mutually exclusive"))
+	}
+	if c.RequestTimeout < 0 {
+		errs = append(errs, fmt.Errorf("request timeout must not be negative, got %s", c.RequestTimeout))
+	}
+	if len(c.AsGroups) > 0 && c.As == "" {
+		errs = append(errs, errors.New("as-group requires as"))
+	}
+	if len(c.Contexts) > 0 {
+		if c.Context != "" {
+			errs = append(errs, errors.New("context and contexts are mutually exclusive"))
+		}
+		if c.Monitor {
+			errs = append(errs, errors.New("contexts can not be combined with monitor mode"))
+		}
+		if c.Parallel <= 0 {
+			errs = append(errs, fmt.Errorf("parallel must be positive, got %d", c.Parallel))
+		}
+	}
+	if c.Monitor {
+		if c.Interval <= 0 {
+			errs = append(errs, fmt.Errorf("interval must be positive in monitor mode, got %s", c.Interval))
+		}
+		if c.MetricsAddr == "" {
+			errs = append(errs, errors.New("metrics address must not be empty in monitor mode"))
+		}
+	}
+	if len(c.ProbeTypes) == 0 {
+		errs = append(errs, errors.New("at least one probe type is required"))
+	}
+	for _, probeType := range c.ProbeTypes {
+		if probeType != ProbeTypeICMP {
+			errs = append(errs, fmt.Errorf("unsupported probe type %q", probeType))
+		}
+	}
+	if _, err := labels.Parse(c.NodeSelector); err != nil {
+		errs = append(errs, fmt.Errorf("node selector: %w", err))
+	}
+	if c.ReadyTimeout < 0 {
+		errs = append(errs, fmt.Errorf("ready timeout must not be negative, got %s", c.ReadyTimeout))
+	}
+	if c.RunTimeout < 0 {
+		errs = append(errs, fmt.Errorf("run timeout must not be negative, got %s", c.RunTimeout))
+	}
+	if err := ValidateThroughputMode(c.Throughput); err != nil {
+		errs = append(errs, err)
+	}
+	if c.Throughput != "" {
+		if !c.Agent {
+			errs = append(errs, fmt.Errorf("throughput requires agent mode"))
+		}
+		if c.ThroughputDuration <= 0 || c.ThroughputDuration > maxThroughputDuration {
+			errs = append(errs, fmt.Errorf("throughput duration must be between 0 and %s, got %s", maxThroughputDuration, c.ThroughputDuration))
+		}
+		if c.Throughput == ThroughputRandom && c.ThroughputPairs <= 0 {
+			errs = append(errs, fmt.Errorf("throughput pairs must be positive, got %d", c.ThroughputPairs))
+		}
+	}
+	if c.LatencySamples < 0 || c.LatencySamples > maxLatencySamples {
+		errs = append(errs, fmt.Errorf("latency samples must be between 0 and %d, got %d", maxLatencySamples, c.LatencySamples))
+	}
+	if c.LatencySLO != "" {
+		if c.LatencySamples == 0 {
+			errs = append(errs, fmt.Errorf("latency SLO requires latency samples"))
+		}
+		if _, err := ParseLatencySLOs(c.LatencySLO); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if err := ValidateTracerouteMode(c.Traceroute); err != nil {
+		errs = append(errs, err)
+	}
+	// traceroute needs raw sockets, which only root in the privileged test pods can open
+	if c.Traceroute != "" && c.SecurityMode != "" && c.SecurityMode != SecurityModePrivileged {
+		errs = append(errs, fmt.Errorf("traceroute requires the privileged security mode, got %s", c.SecurityMode))
+	}
+	if err := ValidateSecurityMode(c.SecurityMode); err != nil {
+		errs = append(errs, err)
+	}
+	errs = append(errs, c.PodTemplate.Validate()...)
+	if c.DaemonSetPatch != "" {
+		if _, err := PatchDaemonSet(CreateDaemonSetSpec(c.Namespace, c.AppName, c.Image), c.DaemonSetPatch); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	switch c.Output {
+	case OutputText, OutputJSON, OutputMatrix:
+	default:
+		errs = append(errs, fmt.Errorf("unsupported output format %q", c.Output))
+	}
+	if err := ValidateLogFormat(c.LogFormat); err != nil {
+		errs = append(errs, err)
+	}
+	if c.LogFormat == LogFormatJSON && c.Output == OutputJSON && c.OutputFile == "" {
+		errs = append(errs, errors.New("json output on stdout can not be combined with json logs, use output-file"))
+	}
+	if c.Cleanup && c.Reuse {
+		errs = append(errs, errors.New("cleanup and reuse are mutually exclusive"))
+	}
+	if c.HistoryDir != "" && c.HistoryConfigMap {
+		errs = append(errs, fmt.Errorf("history-dir and history-configmap are mutually exclusive"))
+	}
+
+	return errors.Join(errs...)
+}
+
+// ClientOptions returns the kubeconfig and the connection overrides of the configuration
+func (c *Config) ClientOptions() ClientOptions {
+	return ClientOptions{
+		Kubeconfig:     c.Kubeconfig,
+		Context:        c.Context,
+		Cluster:        c.Cluster,
+		User:           c.User,
+		Server:         c.Server,
+		Token:          c.Token,
+		As:             c.As,
+		AsGroups:       c.AsGroups,
+		RequestTimeout: c.RequestTimeout,
+	}
+}
+
+// DefaultKubeconfigPath returns GetKubeconfigPath, or empty for the in-cluster config if
+// KUBECONFIG is not set and ~/.kube/config does not exist
+func DefaultKubeconfigPath() string {
+	path := GetKubeconfigPath()
+	if os.Getenv("KUBECONFIG") == "" && path != "" {
+		if _, err := os.Stat(path); err != nil {
+			return ""
+		}
 	}
+	return path
 }
 
 // GetKubeconfigPath returns the kubeconfig path
@@ -3,7 +3,10 @@ package overlaytest
 import (
 	"os"
 	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
 
 	"k8s.io/client-go/util/homedir"
 )
@@ -102,6 +105,39 @@ func TestGetKubeconfigPath(t *testing.T) {
 	})
 }
 
+func TestDefaultKubeconfigPath(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+
+	t.Run("KUBECONFIG is kept", func(t *testing.T) {
+		t.Setenv("KUBECONFIG", "/missing/kubeconfig")
+		if path := DefaultKubeconfigPath(); path != "/missing/kubeconfig" {
+			t.Errorf("Expected KUBECONFIG, got %q", path)
+		}
+	})
+
+	t.Run("Missing home kubeconfig selects in-cluster config", func(t *testing.T) {
+		t.Setenv("KUBECONFIG", "")
+		if path := DefaultKubeconfigPath(); path != "" {
+			t.Errorf("Expected empty path, got %q", path)
+		}
+	})
+
+	t.Run("Existing home kubeconfig", func(t *testing.T) {
+		t.Setenv("KUBECONFIG", "")
+		path := filepath.Join(home, ".kube", "config")
+		if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(fleetKubeconfig), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if got := DefaultKubeconfigPath(); got != path {
+			t.Errorf("Expected %s, got %q", path, got)
+		}
+	})
+}
+
 func TestConstants(t *testing.T) {
 	t.Run("App version constant", func(t *testing.T) {
 		if Version == "" {
@@ -269,3 +305,235 @@ func TestConfigStructValidation(t *testing.T) {
 		}
 	})
 }
+
+func TestLoadConfigFile(t *testing.T) {
+	t.Run("All settings", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "overlaytest.yaml")
+		content := `namespace: overlay
+appName: nettest
+image: example.com/overlaytest:v1
+batch: true
+probeTypes: [icmp]
+nodeSelector: node-role.kubernetes.io/worker
+interval: 1m
+readyTimeout: 2m
+runTimeout: 30s
+output: json
+outputFile: /tmp/result.json
+`
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+
+		config := DefaultConfig()
+		if err := config.LoadConfigFile(path); err != nil {
+			t.Fatalf("Expected no error, got: %v", err)
+		}
+
+		expected := DefaultConfig()
+		expected.Namespace = "overlay"
+		expected.AppName = "nettest"
+		expected.Image = "example.com/overlaytest:v1"
+		expected.Batch = true
+		expected.NodeSelector = "node-role.kubernetes.io/worker"
+		expected.Interval = time.Minute
+		expected.ReadyTimeout = 2 * time.Minute
+		expected.RunTimeout = 30 * time.Second
+		expected.Output = OutputJSON
+		expected.OutputFile = "/tmp/result.json"
+		if !reflect.DeepEqual(config, expected) {
+			t.Errorf("Expected %+v, got %+v", expected, config)
+		}
+	})
+
+	t.Run("Unset settings keep their value", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "overlaytest.yaml")
+		if err := os.WriteFile(path, []byte("namespace: overlay\n"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+
+		config := DefaultConfig()
+		if err := config.LoadConfigFile(path); err != nil {
+			t.Fatalf("Expected no error, got: %v", err)
+		}
+		if config.Image != DefaultConfig().Image || config.Interval != DefaultConfig().Interval {
+			t.Errorf("Expected defaults to be kept, got %+v", config)
+		}
+	})
+
+	errorTests := []struct {
+		name    string
+		content string
+	}{
+		{"Unknown key", "namespaces: overlay\n"},
+		{"Invalid duration", "interval: often\n"},
+		{"Invalid YAML", "namespace: [\n"},
+	}
+	for _, tt := range errorTests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "overlaytest.yaml")
+			if err := os.WriteFile(path, []byte(tt.content), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			if err := DefaultConfig().LoadConfigFile(path); err == nil {
+				t.Error("Expected error")
+			}
+		})
+	}
+
+	t.Run("Missing file", func(t *testing.T) {
+		if err := DefaultConfig().LoadConfigFile(filepath.Join(t.TempDir(), "missing.yaml")); err == nil {
+			t.Error("Expected error for missing file")
+		}
+	})
+}
+
+func TestConfigApplyEnv(t *testing.T) {
+	env := map[string]string{
+		"OVERLAYTEST_NAMESPACE":     "overlay",
+		"OVERLAYTEST_AGENT":         "true",
+		"OVERLAYTEST_PROBE_TYPES":   "icmp",
+		"OVERLAYTEST_RUN_TIMEOUT":   "45s",
+		"OVERLAYTEST_METRICS_ADDR":  ":9100",
+		"OVERLAYTEST_NODE_SELECTOR": "pool=a",
+	}
+	lookup := func(key string) (string, bool) {
+		value, ok := env[key]
+		return value, ok
+	}
+
+	config := DefaultConfig()
+	if err := config.ApplyEnv(lookup); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if config.Namespace != "overlay" || !config.Agent || config.RunTimeout != 45*time.Second ||
+		config.MetricsAddr != ":9100" || config.NodeSelector != "pool=a" {
+		t.Errorf("Environment not applied: %+v", config)
+	}
+	if config.Image != DefaultConfig().Image {
+		t.Errorf("Expected unset image to keep default, got %s", config.Image)
+	}
+
+	t.Run("Invalid values", func(t *testing.T) {
+		env := map[string]string{
+			"OVERLAYTEST_AGENT":    "maybe",
+			"OVERLAYTEST_INTERVAL": "often",
+		}
+		err := DefaultConfig().ApplyEnv(func(key string) (string, bool) {
+			value, ok := env[key]
+			return value, ok
+		})
+		if err == nil {
+			t.Fatal("Expected error")
+		}
+		for _, name := range []string{"OVERLAYTEST_AGENT", "OVERLAYTEST_INTERVAL"} {
+			if !strings.Contains(err.Error(), name) {
+				t.Errorf("Expected error to mention %s, got: %v", name, err)
+			}
+		}
+	})
+}
+
+func TestConfigFieldEnvName(t *testing.T) {
+	for _, field := range ConfigFields {
+		if !strings.HasPrefix(field.EnvName(), "OVERLAYTEST_") || strings.Contains(field.EnvName(), "-") {
+			t.Errorf("Invalid environment variable %s for %s", field.EnvName(), field.Name)
+		}
+	}
+	if name := (ConfigField{Name: "metrics-addr"}).EnvName(); name != "OVERLAYTEST_METRICS_ADDR" {
+		t.Errorf("Expected OVERLAYTEST_METRICS_ADDR, got %s", name)
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	if err := DefaultConfig().Validate(); err != nil {
+		t.Errorf("Expected default config to be valid, got: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		modify func(c *Config)
+		errors []string
+	}{
+		{"Invalid namespace", func(c *Config) { c.Namespace = "Kube_System" }, []string{"namespace"}},
+		{"Empty image", func(c *Config) { c.Image = "" }, []string{"image"}},
+		{"Batch and agent", func(c *Config) { c.Batch, c.Agent = true, true }, []string{"mutually exclusive"}},
+		{"Throughput without agent", func(c *Config) { c.Throughput = ThroughputZone }, []string{"throughput requires agent mode"}},
+		{"Invalid throughput", func(c *Config) { c.Agent, c.Throughput, c.ThroughputDuration = true, "mesh", 0 }, []string{"throughput mode", "throughput duration"}},
+		{"Invalid latency samples", func(c *Config) { c.LatencySamples = -1 }, []string{"latency samples"}},
+		{"Latency SLO without samples", func(c *Config) { c.LatencySLO = "*/*=5ms" }, []string{"latency SLO requires latency samples"}},
+		{"Invalid latency SLO", func(c *Config) { c.LatencySamples, c.LatencySLO = 100, "a/b@p95=5ms" }, []string{"invalid percentile"}},
+		{"Invalid traceroute", func(c *Config) { c.Traceroute = "tcp" }, []string{"traceroute mode"}},
+		{"Traceroute without privileges", func(c *Config) { c.Traceroute, c.SecurityMode = TracerouteICMP, SecurityModeNetRaw }, []string{"traceroute requires the privileged security mode"}},
+		{"History dir and configmap", func(c *Config) { c.HistoryDir, c.HistoryConfigMap = "history", true }, []string{"history-dir and history-configmap"}},
+		{"Monitor without interval", func(c *Config) { c.Monitor, c.Interval = true, 0 }, []string{"interval"}},
+		{"Context and contexts", func(c *Config) { c.Context, c.Contexts = "prod-eu", []string{AllContexts} }, []string{"context and contexts are mutually exclusive"}},
+		{"Group without user", func(c *Config) { c.AsGroups = []string{"system:masters"} }, []string{"as-group requires as"}},
+		{"Negative request timeout", func(c *Config) { c.RequestTimeout = -time.Second }, []string{"request timeout"}},
+		{"Cleanup and reuse", func(c *Config) { c.Cleanup, c.Reuse = true, true }, []string{"cleanup and reuse are mutually exclusive"}},
+		{"Unknown log format", func(c *Config) { c.LogFormat = "logfmt" }, []string{"log format"}},
+		{"JSON logs and results on stdout", func(c *Config) { c.LogFormat, c.Output = LogFormatJSON, OutputJSON }, []string{"use output-file"}},
+		{"Contexts in monitor mode", func(c *Config) { c.Contexts, c.Monitor = []string{AllContexts}, true }, []string{"contexts can not be combined with monitor mode"}},
+		{"Contexts without parallelism", func(c *Config) { c.Contexts, c.Parallel = []string{"prod-*"}, 0 }, []string{"parallel must be positive"}},
+		{"Unknown probe type", func(c *Config) { c.ProbeTypes = []string{"icmp", "sctp"} }, []string{`"sctp"`}},
+		{"Invalid selector", func(c *Config) { c.NodeSelector = "a in (" }, []string{"node selector"}},
+		{"Negative timeout", func(c *Config) { c.RunTimeout = -time.Second }, []string{"run timeout"}},
+		{"Unknown output", func(c *Config) { c.Output = "xml" }, []string{`"xml"`}},
+		{"Create system namespace", func(c *Config) { c.CreateNamespace = true }, []string{"dedicated namespace"}},
+		{"Unknown security mode", func(c *Config) { c.SecurityMode = "root" }, []string{"security mode"}},
+		{
+			name: "All errors reported",
+			modify: func(c *Config) {
+				c.AppName = ""
+				c.Image = ""
+				c.Output = "yaml"
+				c.ReadyTimeout = -time.Minute
+			},
+			errors: []string{"app name", "image", "ready timeout", `"yaml"`},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := DefaultConfig()
+			tt.modify(config)
+			err := config.Validate()
+			if err == nil {
+				t.Fatal("Expected error")
+			}
+			for _, expected := range tt.errors {
+				if !strings.Contains(err.Error(), expected) {
+					t.Errorf("Expected error to contain %q, got: %v", expected, err)
+				}
+			}
+		})
+	}
+}
+
+func TestConfigClientOptions(t *testing.T) {
+	config := DefaultConfig()
+	for name, value := range map[string]string{
+		"kubeconfig":      "/a:/b",
+		"context":         "prod",
+		"as":              "jane",
+		"request-timeout": "20s",
+	} {
+		for _, field := range ConfigFields {
+			if field.Name == name {
+				if err := field.Set(config, value); err != nil {
+					t.Fatal(err)
+				}
+			}
+		}
+	}
+	for _, field := range ConfigFields {
+		if field.Name == "as-group" {
+			field.Set(config, "dev")
+			field.Set(config, "ops")
+		}
+	}
+
+	expected := ClientOptions{Kubeconfig: "/a:/b", Context: "prod", As: "jane", AsGroups: []string{"dev", "ops"}, RequestTimeout: 20 * time.Second}
+	if options := config.ClientOptions(); !reflect.DeepEqual(options, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, options)
+	}
+}
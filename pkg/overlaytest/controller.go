@@ -0,0 +1,252 @@
+package overlaytest
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	apps "k8s.io/api/apps/v1"
+	core "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+// Controller reconciles OverlayTest resources: it manages one DaemonSet per OverlayTest,
+// runs the test on schedule and writes the results into the status
+type Controller struct {
+	Clientset  kubernetes.Interface
+	Dynamic    dynamic.Interface
+	RestConfig *rest.Config
+	// Namespace limits the controller to one namespace, empty for all namespaces
+	Namespace string
+	// Image is used for OverlayTests without an image
+	Image string
+	// Resync is the time between two reconciliations of all OverlayTests
+	Resync time.Duration
+	// Events records Kubernetes Events for every test run, if set
+	Events *EventNotifier
+
+	now func() time.Time
+}
+
+// NewController creates a controller with the default image and resync period
+func NewController(clientset kubernetes.Interface, dynamicClient dynamic.Interface, restConfig *rest.Config, namespace string) *Controller {
+	return &Controller{
+		Clientset:  clientset,
+		Dynamic:    dynamicClient,
+		RestConfig: restConfig,
+		Namespace:  namespace,
+		Image:      DefaultConfig().Image,
+		Resync:     30 * time.Second,
+		now:        time.Now,
+	}
+}
+
+// Run reconciles all OverlayTests every resync period until ctx is cancelled
+func (c *Controller) Run(ctx context.Context) error {
+	for {
+		if err := c.ReconcileAll(ctx); err != nil {
+			fmt.Printf("reconcile failed: %v\n", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(c.Resync):
+		}
+	}
+}
+
+// ReconcileAll reconciles every OverlayTest once
+func (c *Controller) ReconcileAll(ctx context.Context) error {
+	list, err := c.Dynamic.Resource(OverlayTestResource).Namespace(c.Namespace).List(ctx, meta.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("error listing overlaytests: %w", err)
+	}
+
+	for i := range list.Items {
+		test, err := OverlayTestFromUnstructured(&list.Items[i])
+		if err != nil {
+			fmt.Printf("invalid overlaytest %s/%s: %v\n", list.Items[i].GetNamespace(), list.Items[i].GetName(), err)
+			continue
+		}
+		if test.DeletionTimestamp != nil {
+			// Owned resources are removed by the garbage collector
+			continue
+		}
+		if err := c.Reconcile(ctx, test); err != nil {
+			fmt.Printf("error reconciling overlaytest %s/%s: %v\n", test.Namespace, test.Name, err)
+		}
+	}
+	return nil
+}
+
+// Reconcile brings the DaemonSet of an OverlayTest into the desired state and runs the test when it is due
+func (c *Controller) Reconcile(ctx context.Context, test *OverlayTest) error {
+	status := *test.Status.DeepCopy()
+	status.ObservedGeneration = test.Generation
+
+	if err := test.Spec.Validate(); err != nil {
+		apimeta.SetStatusCondition(&status.Conditions, meta.Condition{
+			Type:    ConditionReady,
+			Status:  meta.ConditionFalse,
+			Reason:  ReasonInvalidSpec,
+			Message: err.Error(),
+		})
+		return c.updateStatus(ctx, test, status)
+	}
+
+	daemonset, err := c.ensureDaemonSet(ctx, test)
+	if err != nil {
+		return err
+	}
+
+	if daemonset.Status.NumberReady == 0 || daemonset.Status.NumberReady < daemonset.Status.DesiredNumberScheduled {
+		apimeta.SetStatusCondition(&status.Conditions, meta.Condition{
+			Type:    ConditionReady,
+			Status:  meta.ConditionFalse,
+			Reason:  ReasonDaemonSetNotReady,
+			Message: fmt.Sprintf("%d of %d pods ready", daemonset.Status.NumberReady, daemonset.Status.DesiredNumberScheduled),
+		})
+		return c.updateStatus(ctx, test, status)
+	}
+	apimeta.SetStatusCondition(&status.Conditions, meta.Condition{
+		Type:    ConditionReady,
+		Status:  meta.ConditionTrue,
+		Reason:  ReasonDaemonSetReady,
+		Message: fmt.Sprintf("%d pods ready", daemonset.Status.NumberReady),
+	})
+
+	interval, _ := test.Spec.Interval()
+	if status.LastRunTime != nil && c.now().Before(status.LastRunTime.Add(interval)) {
+		return c.updateStatus(ctx, test, status)
+	}
+
+	report, err := c.runTest(ctx, test)
+	if err != nil {
+		return err
+	}
+	status.SetReport(report)
+	if c.Events != nil {
+		c.Events.RecordReport(report, daemonset)
+	}
+
+	if violations := EvaluateThresholds(report, test.Spec.Thresholds); len(violations) > 0 {
+		apimeta.SetStatusCondition(&status.Conditions, meta.Condition{
+			Type:    ConditionHealthy,
+			Status:  meta.ConditionFalse,
+			Reason:  ReasonThresholdsFailed,
+			Message: strings.Join(violations, ", "),
+		})
+	} else {
+		apimeta.SetStatusCondition(&status.Conditions, meta.Condition{
+			Type:    ConditionHealthy,
+			Status:  meta.ConditionTrue,
+			Reason:  ReasonThresholdsMet,
+			Message: fmt.Sprintf("%d of %d probes succeeded", status.Probes-status.Failures, status.Probes),
+		})
+	}
+	return c.updateStatus(ctx, test, status)
+}
+
+// desiredDaemonSet creates the DaemonSet specification of an OverlayTest
+func (c *Controller) desiredDaemonSet(test *OverlayTest) *apps.DaemonSet {
+	image := test.Spec.Image
+	if image == "" {
+		image = c.Image
+	}
+
+	daemonset := CreateDaemonSetSpec(test.Namespace, test.AppName(), image)
+	if test.Spec.Mode == ModeAgent {
+		daemonset = CreateAgentDaemonSetSpec(test.Namespace, test.AppName(), image)
+	}
+	ApplySecurityMode(daemonset, test.Spec.SecurityMode)
+	daemonset.Spec.Template.Spec.NodeSelector = test.Spec.NodeSelector
+	daemonset.OwnerReferences = []meta.OwnerReference{test.ownerReference()}
+	return daemonset
+}
+
+// ensureDaemonSet creates or updates the DaemonSet (and agent Service) of an OverlayTest
+func (c *Controller) ensureDaemonSet(ctx context.Context, test *OverlayTest) (*apps.DaemonSet, error) {
+	desired := c.desiredDaemonSet(test)
+	daemonsets := c.Clientset.AppsV1().DaemonSets(test.Namespace)
+
+	if test.Spec.Mode == ModeAgent {
+		service := CreateAgentServiceSpec(test.AppName())
+		service.OwnerReferences = []meta.OwnerReference{test.ownerReference()}
+		if _, err := c.Clientset.CoreV1().Services(test.Namespace).Create(ctx, service, meta.CreateOptions{}); err != nil && !errors.IsAlreadyExists(err) {
+			return nil, fmt.Errorf("error creating service: %w", err)
+		}
+	}
+
+	current, err := daemonsets.Get(ctx, desired.Name, meta.GetOptions{})
+	if errors.IsNotFound(err) {
+		fmt.Printf("creating daemonset %s/%s\n", test.Namespace, desired.Name)
+		created, err := daemonsets.Create(ctx, desired, meta.CreateOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("error creating daemonset: %w", err)
+		}
+		return created, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("error getting daemonset: %w", err)
+	}
+
+	if current.Spec.Template.Spec.Containers[0].Image == desired.Spec.Template.Spec.Containers[0].Image &&
+		reflect.DeepEqual(current.Spec.Template.Spec.Containers[0].Command, desired.Spec.Template.Spec.Containers[0].Command) &&
+		reflect.DeepEqual(current.Spec.Template.Spec.Containers[0].SecurityContext, desired.Spec.Template.Spec.Containers[0].SecurityContext) &&
+		reflect.DeepEqual(current.Spec.Template.Spec.SecurityContext, desired.Spec.Template.Spec.SecurityContext) &&
+		reflect.DeepEqual(current.Spec.Template.Spec.NodeSelector, desired.Spec.Template.Spec.NodeSelector) {
+		return current, nil
+	}
+
+	fmt.Printf("updating daemonset %s/%s\n", test.Namespace, desired.Name)
+	current.Spec.Template = desired.Spec.Template
+	updated, err := daemonsets.Update(ctx, current, meta.UpdateOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("error updating daemonset: %w", err)
+	}
+	return updated, nil
+}
+
+// runTest probes all pods of an OverlayTest which already have a pod IP
+func (c *Controller) runTest(ctx context.Context, test *OverlayTest) (*Report, error) {
+	pods, err := c.Clientset.CoreV1().Pods(test.Namespace).List(ctx, meta.ListOptions{LabelSelector: "app=" + test.AppName()})
+	if err != nil {
+		return nil, err
+	}
+
+	var ready []core.Pod
+	for _, pod := range pods.Items {
+		if pod.Status.Phase == core.PodRunning && ValidatePodIP(pod.Status.PodIP) {
+			ready = append(ready, pod)
+		}
+	}
+
+	if test.Spec.Mode == ModeAgent {
+		return CollectAgentResults(ctx, c.Clientset, test.Namespace, ready)
+	}
+	return ProbePods(ctx, c.Clientset, c.RestConfig, test.Namespace, ready, test.Spec.Mode == ModeBatch), nil
+}
+
+// updateStatus writes the status if it changed
+func (c *Controller) updateStatus(ctx context.Context, test *OverlayTest, status OverlayTestStatus) error {
+	if reflect.DeepEqual(test.Status, status) {
+		return nil
+	}
+	test.Status = status
+
+	obj, err := test.ToUnstructured()
+	if err != nil {
+		return err
+	}
+	if _, err := c.Dynamic.Resource(OverlayTestResource).Namespace(test.Namespace).UpdateStatus(ctx, obj, meta.UpdateOptions{}); err != nil {
+		return fmt.Errorf("error updating status: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,189 @@
+package overlaytest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/rest"
+)
+
+func newTestController(t *testing.T, test *OverlayTest) (*Controller, *fake.Clientset) {
+	t.Helper()
+	obj, err := test.ToUnstructured()
+	if err != nil {
+		t.Fatalf("Failed to convert OverlayTest: %v", err)
+	}
+
+	dynamicClient := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{OverlayTestResource: "OverlayTestList"}, obj)
+	clientset := fake.NewSimpleClientset()
+	controller := NewController(clientset, dynamicClient, &rest.Config{Host: "https://localhost:6443"}, "")
+	return controller, clientset
+}
+
+func getOverlayTest(t *testing.T, controller *Controller, namespace, name string) *OverlayTest {
+	t.Helper()
+	obj, err := controller.Dynamic.Resource(OverlayTestResource).Namespace(namespace).Get(context.Background(), name, meta.GetOptions{})
+	if err != nil {
+		t.Fatalf("Failed to get OverlayTest: %v", err)
+	}
+	test, err := OverlayTestFromUnstructured(obj)
+	if err != nil {
+		t.Fatalf("Failed to convert OverlayTest: %v", err)
+	}
+	return test
+}
+
+func sampleOverlayTest() *OverlayTest {
+	return &OverlayTest{
+		TypeMeta:   meta.TypeMeta{APIVersion: CRDGroup + "/" + CRDVersion, Kind: CRDKind},
+		ObjectMeta: meta.ObjectMeta{Name: "cluster", Namespace: "test-namespace", UID: "1234", Generation: 2},
+		Spec: OverlayTestSpec{
+			Schedule:     "15m",
+			Image:        "test-image",
+			NodeSelector: map[string]string{"kubernetes.io/os": "linux"},
+		},
+	}
+}
+
+func TestControllerCreatesDaemonSet(t *testing.T) {
+	ctx := context.Background()
+	controller, clientset := newTestController(t, sampleOverlayTest())
+
+	if err := controller.ReconcileAll(ctx); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	ds, err := clientset.AppsV1().DaemonSets("test-namespace").Get(ctx, "overlaytest-cluster", meta.GetOptions{})
+	if err != nil {
+		t.Fatalf("Expected DaemonSet to be created, got: %v", err)
+	}
+	if ds.Spec.Template.Spec.Containers[0].Image != "test-image" {
+		t.Errorf("Expected image test-image, got %s", ds.Spec.Template.Spec.Containers[0].Image)
+	}
+	if ds.Spec.Template.Spec.NodeSelector["kubernetes.io/os"] != "linux" {
+		t.Errorf("Expected node selector to be applied, got %v", ds.Spec.Template.Spec.NodeSelector)
+	}
+	if len(ds.OwnerReferences) != 1 || ds.OwnerReferences[0].Kind != CRDKind || ds.OwnerReferences[0].UID != "1234" {
+		t.Errorf("Expected owner reference to OverlayTest, got %v", ds.OwnerReferences)
+	}
+
+	test := getOverlayTest(t, controller, "test-namespace", "cluster")
+	ready := apimeta.FindStatusCondition(test.Status.Conditions, ConditionReady)
+	if ready == nil || ready.Status != meta.ConditionFalse || ready.Reason != ReasonDaemonSetNotReady {
+		t.Errorf("Expected Ready=False/DaemonSetNotReady, got %+v", ready)
+	}
+	if test.Status.ObservedGeneration != 2 {
+		t.Errorf("Expected observed generation 2, got %d", test.Status.ObservedGeneration)
+	}
+}
+
+func TestControllerUpdatesDaemonSet(t *testing.T) {
+	ctx := context.Background()
+	overlayTest := sampleOverlayTest()
+	controller, clientset := newTestController(t, overlayTest)
+
+	if err := controller.ReconcileAll(ctx); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	overlayTest.Spec.Image = "new-image"
+	if _, err := controller.ensureDaemonSet(ctx, overlayTest); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	ds, _ := clientset.AppsV1().DaemonSets("test-namespace").Get(ctx, "overlaytest-cluster", meta.GetOptions{})
+	if ds.Spec.Template.Spec.Containers[0].Image != "new-image" {
+		t.Errorf("Expected image to be updated, got %s", ds.Spec.Template.Spec.Containers[0].Image)
+	}
+}
+
+func TestControllerRunsTest(t *testing.T) {
+	ctx := context.Background()
+	controller, clientset := newTestController(t, sampleOverlayTest())
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	controller.now = func() time.Time { return now }
+
+	// Pretend the DaemonSet is ready
+	ds := controller.desiredDaemonSet(sampleOverlayTest())
+	ds.Status.NumberReady = 1
+	ds.Status.DesiredNumberScheduled = 1
+	if _, err := clientset.AppsV1().DaemonSets("test-namespace").Create(ctx, ds, meta.CreateOptions{}); err != nil {
+		t.Fatalf("Failed to create DaemonSet: %v", err)
+	}
+
+	if err := controller.ReconcileAll(ctx); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	test := getOverlayTest(t, controller, "test-namespace", "cluster")
+	if test.Status.LastRunTime == nil {
+		t.Fatal("Expected test to have run")
+	}
+	ready := apimeta.FindStatusCondition(test.Status.Conditions, ConditionReady)
+	if ready == nil || ready.Status != meta.ConditionTrue {
+		t.Errorf("Expected Ready=True, got %+v", ready)
+	}
+	// Without pods there are no successful probes
+	healthy := apimeta.FindStatusCondition(test.Status.Conditions, ConditionHealthy)
+	if healthy == nil || healthy.Status != meta.ConditionFalse || healthy.Reason != ReasonThresholdsFailed {
+		t.Errorf("Expected Healthy=False/ThresholdsFailed, got %+v", healthy)
+	}
+
+	t.Run("Not due before schedule", func(t *testing.T) {
+		lastRun := test.Status.LastRunTime.Time
+		now = now.Add(5 * time.Minute)
+		if err := controller.Reconcile(ctx, test); err != nil {
+			t.Fatalf("Expected no error, got: %v", err)
+		}
+		if !getOverlayTest(t, controller, "test-namespace", "cluster").Status.LastRunTime.Time.Equal(lastRun) {
+			t.Error("Expected no new run before the schedule is due")
+		}
+	})
+}
+
+func TestControllerInvalidSpec(t *testing.T) {
+	ctx := context.Background()
+	overlayTest := sampleOverlayTest()
+	overlayTest.Spec.Schedule = "daily"
+	controller, clientset := newTestController(t, overlayTest)
+
+	if err := controller.ReconcileAll(ctx); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	if _, err := clientset.AppsV1().DaemonSets("test-namespace").Get(ctx, "overlaytest-cluster", meta.GetOptions{}); err == nil {
+		t.Error("Expected no DaemonSet for invalid spec")
+	}
+	test := getOverlayTest(t, controller, "test-namespace", "cluster")
+	ready := apimeta.FindStatusCondition(test.Status.Conditions, ConditionReady)
+	if ready == nil || ready.Reason != ReasonInvalidSpec {
+		t.Errorf("Expected Ready reason InvalidSpec, got %+v", ready)
+	}
+}
+
+func TestControllerAgentMode(t *testing.T) {
+	ctx := context.Background()
+	overlayTest := sampleOverlayTest()
+	overlayTest.Spec.Mode = ModeAgent
+	controller, clientset := newTestController(t, overlayTest)
+
+	if err := controller.ReconcileAll(ctx); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	if _, err := clientset.CoreV1().Services("test-namespace").Get(ctx, "overlaytest-cluster", meta.GetOptions{}); err != nil {
+		t.Errorf("Expected agent service to be created, got: %v", err)
+	}
+	ds, _ := clientset.AppsV1().DaemonSets("test-namespace").Get(ctx, "overlaytest-cluster", meta.GetOptions{})
+	if ds.Spec.Template.Spec.Containers[0].Command[0] != "overlaytest" {
+		t.Error("Expected agent DaemonSet")
+	}
+}
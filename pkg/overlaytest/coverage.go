@@ -0,0 +1,188 @@
+package overlaytest
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	core "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/klog/v2"
+)
+
+// Reasons for nodes without a running test pod
+const (
+	UncoveredNotReady              = "NotReady"
+	UncoveredUnschedulable         = "Unschedulable"
+	UncoveredNodeSelector          = "NodeSelectorMismatch"
+	UncoveredTaint                 = "UntoleratedTaint"
+	UncoveredInsufficientResources = "InsufficientResources"
+	UncoveredImagePull             = "ImagePullFailure"
+	UncoveredPodNotRunning         = "PodNotRunning"
+	UncoveredNoPod                 = "NoPod"
+)
+
+// imagePullReasons are container waiting reasons caused by the image
+var imagePullReasons = map[string]bool{
+	"ErrImagePull":      true,
+	"ImagePullBackOff":  true,
+	"InvalidImageName":  true,
+	"ErrImageNeverPull": true,
+}
+
+// UncoveredNode is a node without a running test pod
+type UncoveredNode struct {
+	Name    string `json:"name"`
+	Reason  string `json:"reason"`
+	Message string `json:"message,omitempty"`
+}
+
+// Coverage compares the nodes under test with the test pods
+type Coverage struct {
+	// Nodes is the number of nodes under test
+	Nodes int `json:"nodes"`
+	// Pods are the running test pods
+	Pods      []core.Pod      `json:"-"`
+	Uncovered []UncoveredNode `json:"uncovered,omitempty"`
+}
+
+// CheckNodeCoverage finds the nodes matching the node selector of the config which have no running test pod
+func CheckNodeCoverage(ctx context.Context, clientset kubernetes.Interface, config *Config) (*Coverage, error) {
+	nodes, err := clientset.CoreV1().Nodes().List(ctx, meta.ListOptions{LabelSelector: config.NodeSelector})
+	if err != nil {
+		return nil, fmt.Errorf("error listing nodes: %w", err)
+	}
+	pods, err := clientset.CoreV1().Pods(config.Namespace).List(ctx, meta.ListOptions{LabelSelector: "app=" + config.AppName})
+	if err != nil {
+		return nil, fmt.Errorf("error listing pods: %w", err)
+	}
+
+	var template *core.PodTemplateSpec
+	daemonset, err := clientset.AppsV1().DaemonSets(config.Namespace).Get(ctx, config.AppName, meta.GetOptions{})
+	if err == nil {
+		template = &daemonset.Spec.Template
+	} else if !errors.IsNotFound(err) {
+		return nil, fmt.Errorf("error getting daemonset: %w", err)
+	}
+
+	return AnalyzeCoverage(nodes.Items, pods.Items, template), nil
+}
+
+// AnalyzeCoverage matches the test pods to the nodes and explains why nodes have no running test pod.
+// The pod template of the DaemonSet is used to check node selector and tolerations, if given.
+func AnalyzeCoverage(nodes []core.Node, pods []core.Pod, template *core.PodTemplateSpec) *Coverage {
+	podsByNode := map[string]*core.Pod{}
+	for i := range pods {
+		if node := podNodeName(&pods[i]); node != "" {
+			podsByNode[node] = &pods[i]
+		}
+	}
+
+	coverage := &Coverage{Nodes: len(nodes)}
+	for i := range nodes {
+		node := &nodes[i]
+		pod := podsByNode[node.Name]
+		if pod != nil && pod.Status.Phase == core.PodRunning {
+			coverage.Pods = append(coverage.Pods, *pod)
+			continue
+		}
+
+		uncovered := UncoveredNode{Name: node.Name}
+		if pod != nil {
+			uncovered.Reason, uncovered.Message = podProblem(pod)
+		} else {
+			uncovered.Reason, uncovered.Message = nodeProblem(node, template)
+		}
+		coverage.Uncovered = append(coverage.Uncovered, uncovered)
+	}
+
+	sort.Slice(coverage.Uncovered, func(i, j int) bool { return coverage.Uncovered[i].Name < coverage.Uncovered[j].Name })
+	return coverage
+}
+
+// podNodeName returns the node of a DaemonSet pod, pending pods are bound to their node by node affinity
+func podNodeName(pod *core.Pod) string {
+	if pod.Spec.NodeName != "" {
+		return pod.Spec.NodeName
+	}
+	affinity := pod.Spec.Affinity
+	if affinity == nil || affinity.NodeAffinity == nil || affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution == nil {
+		return ""
+	}
+	for _, term := range affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms {
+		for _, field := range term.MatchFields {
+			if field.Key == "metadata.name" && field.Operator == core.NodeSelectorOpIn && len(field.Values) == 1 {
+				return field.Values[0]
+			}
+		}
+	}
+	return ""
+}
+
+// podProblem explains why an existing test pod is not running
+func podProblem(pod *core.Pod) (string, string) {
+	for _, status := range pod.Status.ContainerStatuses {
+		if waiting := status.State.Waiting; waiting != nil && imagePullReasons[waiting.Reason] {
+			return UncoveredImagePull, fmt.Sprintf("%s: %s", waiting.Reason, waiting.Message)
+		}
+	}
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == core.PodScheduled && condition.Status == core.ConditionFalse {
+			if strings.Contains(condition.Message, "Insufficient") {
+				return UncoveredInsufficientResources, condition.Message
+			}
+			return UncoveredUnschedulable, condition.Message
+		}
+	}
+	return UncoveredPodNotRunning, fmt.Sprintf("pod %s is %s", pod.Name, pod.Status.Phase)
+}
+
+// nodeProblem explains why the DaemonSet created no pod on a node
+func nodeProblem(node *core.Node, template *core.PodTemplateSpec) (string, string) {
+	for _, condition := range node.Status.Conditions {
+		if condition.Type == core.NodeReady && condition.Status != core.ConditionTrue {
+			return UncoveredNotReady, condition.Message
+		}
+	}
+	if template != nil {
+		if selector := template.Spec.NodeSelector; len(selector) > 0 && !labels.SelectorFromSet(selector).Matches(labels.Set(node.Labels)) {
+			return UncoveredNodeSelector, fmt.Sprintf("node does not match node selector %s", labels.Set(selector))
+		}
+		for _, taint := range node.Spec.Taints {
+			if taint.Effect == core.TaintEffectPreferNoSchedule || tolerated(template.Spec.Tolerations, &taint) {
+				continue
+			}
+			return UncoveredTaint, fmt.Sprintf("taint %s is not tolerated", taint.ToString())
+		}
+	}
+	if node.Spec.Unschedulable {
+		return UncoveredUnschedulable, "node is cordoned"
+	}
+	return UncoveredNoPod, "no test pod was created on the node"
+}
+
+func tolerated(tolerations []core.Toleration, taint *core.Taint) bool {
+	for i := range tolerations {
+		if tolerations[i].ToleratesTaint(klog.Background(), taint, false) {
+			return true
+		}
+	}
+	return false
+}
+
+// PrintCoverage writes the number of covered nodes and the reason for every uncovered node
+func PrintCoverage(w io.Writer, coverage *Coverage) {
+	fmt.Fprintf(w, "There are %d nodes in the cluster, %d with a running test pod\n", coverage.Nodes, len(coverage.Pods))
+	for _, node := range coverage.Uncovered {
+		fmt.Fprintf(w, "  %s is not tested: %s", node.Name, node.Reason)
+		if node.Message != "" {
+			fmt.Fprintf(w, " (%s)", node.Message)
+		}
+		fmt.Fprintln(w)
+	}
+}
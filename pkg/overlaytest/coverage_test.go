@@ -0,0 +1,148 @@
+package overlaytest
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	core "k8s.io/api/core/v1"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func coverageNode(name string) core.Node {
+	return core.Node{
+		ObjectMeta: meta.ObjectMeta{Name: name, Labels: map[string]string{"kubernetes.io/os": "linux"}},
+		Status: core.NodeStatus{Conditions: []core.NodeCondition{
+			{Type: core.NodeReady, Status: core.ConditionTrue},
+		}},
+	}
+}
+
+func coveragePod(name, node string, phase core.PodPhase) core.Pod {
+	return core.Pod{
+		ObjectMeta: meta.ObjectMeta{Name: name, Namespace: "test-namespace", Labels: map[string]string{"app": "overlaytest"}},
+		Spec:       core.PodSpec{NodeName: node},
+		Status:     core.PodStatus{Phase: phase},
+	}
+}
+
+func TestAnalyzeCoverage(t *testing.T) {
+	notReady := coverageNode("not-ready")
+	notReady.Status.Conditions[0].Status = core.ConditionFalse
+	notReady.Status.Conditions[0].Message = "kubelet stopped posting node status"
+
+	cordoned := coverageNode("cordoned")
+	cordoned.Spec.Unschedulable = true
+
+	tainted := coverageNode("tainted")
+	tainted.Spec.Taints = []core.Taint{{Key: "dedicated", Value: "gpu", Effect: core.TaintEffectNoSchedule}}
+
+	windows := coverageNode("windows")
+	windows.Labels["kubernetes.io/os"] = "windows"
+
+	// Pending DaemonSet pods are bound to their node by node affinity
+	pending := coveragePod("overlaytest-pending", "", core.PodPending)
+	pending.Spec.Affinity = &core.Affinity{NodeAffinity: &core.NodeAffinity{
+		RequiredDuringSchedulingIgnoredDuringExecution: &core.NodeSelector{NodeSelectorTerms: []core.NodeSelectorTerm{{
+			MatchFields: []core.NodeSelectorRequirement{{Key: "metadata.name", Operator: core.NodeSelectorOpIn, Values: []string{"full"}}},
+		}}},
+	}}
+	pending.Status.Conditions = []core.PodCondition{{
+		Type: core.PodScheduled, Status: core.ConditionFalse, Reason: "Unschedulable",
+		Message: "0/6 nodes are available: 1 Insufficient memory.",
+	}}
+
+	pullFailure := coveragePod("overlaytest-pull", "pull", core.PodPending)
+	pullFailure.Status.ContainerStatuses = []core.ContainerStatus{{
+		State: core.ContainerState{Waiting: &core.ContainerStateWaiting{Reason: "ImagePullBackOff", Message: "Back-off pulling image"}},
+	}}
+
+	nodes := []core.Node{
+		coverageNode("ready"), notReady, cordoned, tainted, windows,
+		coverageNode("full"), coverageNode("pull"), coverageNode("missing"),
+	}
+	pods := []core.Pod{coveragePod("overlaytest-ready", "ready", core.PodRunning), pending, pullFailure}
+
+	template := CreateDaemonSetSpec("test-namespace", "overlaytest", "test-image").Spec.Template
+	template.Spec.Tolerations = nil
+	template.Spec.NodeSelector = map[string]string{"kubernetes.io/os": "linux"}
+
+	coverage := AnalyzeCoverage(nodes, pods, &template)
+
+	if coverage.Nodes != len(nodes) {
+		t.Errorf("Expected %d nodes, got %d", len(nodes), coverage.Nodes)
+	}
+	if len(coverage.Pods) != 1 || coverage.Pods[0].Name != "overlaytest-ready" {
+		t.Errorf("Expected one running pod, got %v", coverage.Pods)
+	}
+
+	expected := map[string]string{
+		"not-ready": UncoveredNotReady,
+		"cordoned":  UncoveredUnschedulable,
+		"tainted":   UncoveredTaint,
+		"windows":   UncoveredNodeSelector,
+		"full":      UncoveredInsufficientResources,
+		"pull":      UncoveredImagePull,
+		"missing":   UncoveredNoPod,
+	}
+	if len(coverage.Uncovered) != len(expected) {
+		t.Fatalf("Expected %d uncovered nodes, got %+v", len(expected), coverage.Uncovered)
+	}
+	for _, node := range coverage.Uncovered {
+		if node.Reason != expected[node.Name] {
+			t.Errorf("Expected reason %s for %s, got %s (%s)", expected[node.Name], node.Name, node.Reason, node.Message)
+		}
+	}
+	if coverage.Uncovered[0].Name != "cordoned" {
+		t.Errorf("Expected uncovered nodes sorted by name, got %s first", coverage.Uncovered[0].Name)
+	}
+}
+
+func TestAnalyzeCoverageDefaultTolerations(t *testing.T) {
+	tainted := coverageNode("tainted")
+	tainted.Spec.Taints = []core.Taint{{Key: "dedicated", Value: "gpu", Effect: core.TaintEffectNoSchedule}}
+
+	template := CreateDaemonSetSpec("test-namespace", "overlaytest", "test-image").Spec.Template
+	coverage := AnalyzeCoverage([]core.Node{tainted}, nil, &template)
+
+	if len(coverage.Uncovered) != 1 || coverage.Uncovered[0].Reason != UncoveredNoPod {
+		t.Errorf("Expected taint to be tolerated by default, got %+v", coverage.Uncovered)
+	}
+}
+
+func TestCheckNodeCoverage(t *testing.T) {
+	node1, node2 := coverageNode("node-1"), coverageNode("node-2")
+	node2.Labels["pool"] = "b"
+	pod := coveragePod("overlaytest-a", "node-1", core.PodRunning)
+	clientset := fake.NewSimpleClientset(&node1, &node2, &pod)
+
+	config := DefaultConfig()
+	config.Namespace = "test-namespace"
+	coverage, err := CheckNodeCoverage(context.Background(), clientset, config)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if coverage.Nodes != 2 || len(coverage.Uncovered) != 1 || coverage.Uncovered[0].Name != "node-2" {
+		t.Errorf("Expected node-2 uncovered, got %+v", coverage)
+	}
+
+	// Nodes excluded by the node selector are not reported
+	config.NodeSelector = "pool!=b"
+	coverage, err = CheckNodeCoverage(context.Background(), clientset, config)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if coverage.Nodes != 1 || len(coverage.Uncovered) != 0 {
+		t.Errorf("Expected only node-1, got %+v", coverage)
+	}
+}
+
+func TestNodeProblemMessages(t *testing.T) {
+	tainted := coverageNode("tainted")
+	tainted.Spec.Taints = []core.Taint{{Key: "dedicated", Value: "gpu", Effect: core.TaintEffectNoExecute}}
+	_, message := nodeProblem(&tainted, &core.PodTemplateSpec{})
+	if !strings.Contains(message, "dedicated=gpu:NoExecute") {
+		t.Errorf("Expected taint in message, got %q", message)
+	}
+}
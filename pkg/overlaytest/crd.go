@@ -0,0 +1,255 @@
+package overlaytest
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"strings"
+	"time"
+
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// OverlayTest custom resource, see deploy/crd.yaml
+const (
+	CRDGroup   = "overlaytest.eumel8.github.io"
+	CRDVersion = "v1alpha1"
+	CRDKind    = "OverlayTest"
+)
+
+// OverlayTestResource is the GroupVersionResource of the OverlayTest custom resource
+var OverlayTestResource = schema.GroupVersionResource{Group: CRDGroup, Version: CRDVersion, Resource: "overlaytests"}
+
+// Probe modes of an OverlayTest
+const (
+	ModeExec  = "exec"
+	ModeBatch = "batch"
+	ModeAgent = "agent"
+)
+
+// Probe types of an OverlayTest
+const (
+	ProbeTypeICMP = "icmp"
+)
+
+// Condition types and reasons written into the OverlayTest status
+const (
+	ConditionReady   = "Ready"
+	ConditionHealthy = "Healthy"
+
+	ReasonDaemonSetReady    = "DaemonSetReady"
+	ReasonDaemonSetNotReady = "DaemonSetNotReady"
+	ReasonThresholdsMet     = "ThresholdsMet"
+	ReasonThresholdsFailed  = "ThresholdsFailed"
+	ReasonInvalidSpec       = "InvalidSpec"
+)
+
+// OverlayTest declares a recurring overlay network test
+type OverlayTest struct {
+	meta.TypeMeta   `json:",inline"`
+	meta.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   OverlayTestSpec   `json:"spec,omitempty"`
+	Status OverlayTestStatus `json:"status,omitempty"`
+}
+
+// OverlayTestSpec is the desired state of an OverlayTest
+type OverlayTestSpec struct {
+	// Schedule is the interval between test runs as Go duration, e.g. "15m"
+	Schedule string `json:"schedule,omitempty"`
+	// Mode selects how probes are executed: exec, batch or agent
+	Mode string `json:"mode,omitempty"`
+	// ProbeTypes lists the probes to run between each node pair
+	ProbeTypes []string `json:"probeTypes,omitempty"`
+	// Image overrides the test image
+	Image string `json:"image,omitempty"`
+	// NodeSelector restricts the nodes under test
+	NodeSelector map[string]string `json:"nodeSelector,omitempty"`
+	// SecurityMode selects the privileges of the test pods: privileged, netraw, baseline or restricted
+	SecurityMode string `json:"securityMode,omitempty"`
+	// Thresholds decide whether a run is healthy
+	Thresholds OverlayTestThresholds `json:"thresholds,omitempty"`
+}
+
+// OverlayTestThresholds are the limits a run must meet to be healthy
+type OverlayTestThresholds struct {
+	// MinSuccessPercent is the minimum percentage of successful probes, default 100
+	MinSuccessPercent *int `json:"minSuccessPercent,omitempty"`
+	// MaxRTT is the maximum round-trip time of a single probe as Go duration, e.g. "10ms"
+	MaxRTT string `json:"maxRTT,omitempty"`
+}
+
+// OverlayTestStatus is the observed state of an OverlayTest
+type OverlayTestStatus struct {
+	ObservedGeneration int64            `json:"observedGeneration,omitempty"`
+	LastRunTime        *meta.Time       `json:"lastRunTime,omitempty"`
+	LastRunDuration    string           `json:"lastRunDuration,omitempty"`
+	Nodes              int              `json:"nodes,omitempty"`
+	Probes             int              `json:"probes,omitempty"`
+	Failures           int              `json:"failures,omitempty"`
+	SuccessPercent     int              `json:"successPercent,omitempty"`
+	FailedPairs        []FailedPair     `json:"failedPairs,omitempty"`
+	Conditions         []meta.Condition `json:"conditions,omitempty"`
+}
+
+// FailedPair is a node pair which failed in the last run
+type FailedPair struct {
+	Source     string `json:"source"`
+	Target     string `json:"target"`
+	ErrorClass string `json:"errorClass,omitempty"`
+}
+
+// maxFailedPairs limits the failed pairs stored in the status to keep the object small
+const maxFailedPairs = 50
+
+// OverlayTestFromUnstructured converts an unstructured object into an OverlayTest
+func OverlayTestFromUnstructured(obj *unstructured.Unstructured) (*OverlayTest, error) {
+	test := &OverlayTest{}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj.Object, test); err != nil {
+		return nil, err
+	}
+	return test, nil
+}
+
+// ToUnstructured converts the OverlayTest into an unstructured object
+func (t *OverlayTest) ToUnstructured() (*unstructured.Unstructured, error) {
+	obj, err := runtime.DefaultUnstructuredConverter.ToUnstructured(t)
+	if err != nil {
+		return nil, err
+	}
+	return &unstructured.Unstructured{Object: obj}, nil
+}
+
+// AppName returns the name of the DaemonSet and app label of an OverlayTest. Names longer than
+// a label value are truncated and end with a hash of the OverlayTest name to stay unique.
+func (t *OverlayTest) AppName() string {
+	name := "overlaytest-" + t.Name
+	if len(name) <= validation.LabelValueMaxLength {
+		return name
+	}
+	hash := fmt.Sprintf("%x", sha256.Sum256([]byte(t.Name)))[:appNameHashLength]
+	prefix := strings.TrimRight(name[:validation.LabelValueMaxLength-appNameHashLength-1], "-.")
+	return prefix + "-" + hash
+}
+
+// appNameHashLength is the length of the hash ending truncated app names
+const appNameHashLength = 8
+
+// ownerReference marks objects managed for the OverlayTest
+func (t *OverlayTest) ownerReference() meta.OwnerReference {
+	controller := true
+	return meta.OwnerReference{
+		APIVersion: CRDGroup + "/" + CRDVersion,
+		Kind:       CRDKind,
+		Name:       t.Name,
+		UID:        t.UID,
+		Controller: &controller,
+	}
+}
+
+// DeepCopy returns a copy of the status which shares no memory with the original
+func (s *OverlayTestStatus) DeepCopy() *OverlayTestStatus {
+	out := *s
+	if s.LastRunTime != nil {
+		out.LastRunTime = s.LastRunTime.DeepCopy()
+	}
+	out.FailedPairs = append([]FailedPair(nil), s.FailedPairs...)
+	out.Conditions = append([]meta.Condition(nil), s.Conditions...)
+	return &out
+}
+
+// Interval returns the parsed schedule
+func (s *OverlayTestSpec) Interval() (time.Duration, error) {
+	if s.Schedule == "" {
+		return 0, fmt.Errorf("schedule is required")
+	}
+	interval, err := time.ParseDuration(s.Schedule)
+	if err != nil {
+		return 0, fmt.Errorf("invalid schedule %q: %w", s.Schedule, err)
+	}
+	if interval <= 0 {
+		return 0, fmt.Errorf("schedule must be positive, got %q", s.Schedule)
+	}
+	return interval, nil
+}
+
+// Validate checks the spec for unsupported values
+func (s *OverlayTestSpec) Validate() error {
+	if _, err := s.Interval(); err != nil {
+		return err
+	}
+	switch s.Mode {
+	case "", ModeExec, ModeBatch, ModeAgent:
+	default:
+		return fmt.Errorf("unsupported mode %q", s.Mode)
+	}
+	for _, probeType := range s.ProbeTypes {
+		if probeType != ProbeTypeICMP {
+			return fmt.Errorf("unsupported probe type %q", probeType)
+		}
+	}
+	if err := ValidateSecurityMode(s.SecurityMode); err != nil {
+		return err
+	}
+	if p := s.Thresholds.MinSuccessPercent; p != nil && (*p < 0 || *p > 100) {
+		return fmt.Errorf("minSuccessPercent must be between 0 and 100, got %d", *p)
+	}
+	if s.Thresholds.MaxRTT != "" {
+		if _, err := time.ParseDuration(s.Thresholds.MaxRTT); err != nil {
+			return fmt.Errorf("invalid maxRTT %q: %w", s.Thresholds.MaxRTT, err)
+		}
+	}
+	return nil
+}
+
+// EvaluateThresholds checks a report against the thresholds and returns a message for every violation
+func EvaluateThresholds(report *Report, thresholds OverlayTestThresholds) []string {
+	var violations []string
+
+	minSuccess := 100
+	if thresholds.MinSuccessPercent != nil {
+		minSuccess = *thresholds.MinSuccessPercent
+	}
+	if success := report.SuccessPercent(); success < minSuccess {
+		violations = append(violations, fmt.Sprintf("success rate %d%% below %d%%", success, minSuccess))
+	}
+
+	if maxRTT, err := time.ParseDuration(thresholds.MaxRTT); err == nil && maxRTT > 0 {
+		slow := 0
+		for _, result := range report.Results {
+			if result.Reachable && result.RTT > maxRTT {
+				slow++
+			}
+		}
+		if slow > 0 {
+			violations = append(violations, fmt.Sprintf("%d probes exceeded RTT of %s", slow, maxRTT))
+		}
+	}
+	return violations
+}
+
+// SetReport fills the run results of the status from a report
+func (s *OverlayTestStatus) SetReport(report *Report) {
+	runTime := meta.NewTime(report.StartTime)
+	s.LastRunTime = &runTime
+	s.LastRunDuration = report.Duration.Round(time.Millisecond).String()
+	s.Nodes = len(report.Nodes)
+	s.Probes = len(report.Results)
+	s.Failures = len(report.Failures())
+	s.SuccessPercent = report.SuccessPercent()
+
+	s.FailedPairs = nil
+	for _, failure := range report.Failures() {
+		if len(s.FailedPairs) == maxFailedPairs {
+			break
+		}
+		s.FailedPairs = append(s.FailedPairs, FailedPair{
+			Source:     failure.SourceNode,
+			Target:     failure.TargetNode,
+			ErrorClass: failure.ErrorClass,
+		})
+	}
+}
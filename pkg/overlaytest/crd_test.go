@@ -0,0 +1,196 @@
+package overlaytest
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+func intPtr(i int) *int {
+	return &i
+}
+
+func TestOverlayTestSpecValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		spec    OverlayTestSpec
+		wantErr string
+	}{
+		{
+			name: "Minimal spec",
+			spec: OverlayTestSpec{Schedule: "15m"},
+		},
+		{
+			name: "Full spec",
+			spec: OverlayTestSpec{
+				Schedule:   "1h",
+				Mode:       ModeAgent,
+				ProbeTypes: []string{ProbeTypeICMP},
+				Thresholds: OverlayTestThresholds{MinSuccessPercent: intPtr(90), MaxRTT: "10ms"},
+			},
+		},
+		{
+			name:    "Missing schedule",
+			spec:    OverlayTestSpec{},
+			wantErr: "schedule is required",
+		},
+		{
+			name:    "Invalid schedule",
+			spec:    OverlayTestSpec{Schedule: "*/5 * * * *"},
+			wantErr: "invalid schedule",
+		},
+		{
+			name:    "Negative schedule",
+			spec:    OverlayTestSpec{Schedule: "-5m"},
+			wantErr: "must be positive",
+		},
+		{
+			name:    "Unknown mode",
+			spec:    OverlayTestSpec{Schedule: "5m", Mode: "ssh"},
+			wantErr: "unsupported mode",
+		},
+		{
+			name:    "Unknown probe type",
+			spec:    OverlayTestSpec{Schedule: "5m", ProbeTypes: []string{"http"}},
+			wantErr: "unsupported probe type",
+		},
+		{
+			name:    "Success percent out of range",
+			spec:    OverlayTestSpec{Schedule: "5m", Thresholds: OverlayTestThresholds{MinSuccessPercent: intPtr(101)}},
+			wantErr: "minSuccessPercent",
+		},
+		{
+			name:    "Invalid max RTT",
+			spec:    OverlayTestSpec{Schedule: "5m", Thresholds: OverlayTestThresholds{MaxRTT: "fast"}},
+			wantErr: "invalid maxRTT",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.spec.Validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("Expected no error, got: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Expected error containing %q, got: %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestEvaluateThresholds(t *testing.T) {
+	report := testReport()
+	report.Results[0].RTT = 20 * time.Millisecond
+
+	t.Run("Default requires all probes to succeed", func(t *testing.T) {
+		violations := EvaluateThresholds(report, OverlayTestThresholds{})
+		if len(violations) != 1 || !strings.Contains(violations[0], "success rate 75%") {
+			t.Errorf("Expected success rate violation, got %v", violations)
+		}
+	})
+
+	t.Run("Lower success threshold", func(t *testing.T) {
+		violations := EvaluateThresholds(report, OverlayTestThresholds{MinSuccessPercent: intPtr(75)})
+		if len(violations) != 0 {
+			t.Errorf("Expected no violations, got %v", violations)
+		}
+	})
+
+	t.Run("RTT threshold", func(t *testing.T) {
+		violations := EvaluateThresholds(report, OverlayTestThresholds{MinSuccessPercent: intPtr(0), MaxRTT: "10ms"})
+		if len(violations) != 1 || !strings.Contains(violations[0], "1 probes exceeded RTT") {
+			t.Errorf("Expected RTT violation, got %v", violations)
+		}
+	})
+}
+
+func TestOverlayTestStatusSetReport(t *testing.T) {
+	report := testReport()
+	report.StartTime = time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	report.Duration = 1500 * time.Millisecond
+
+	var status OverlayTestStatus
+	status.SetReport(report)
+
+	if status.Nodes != 2 || status.Probes != 4 || status.Failures != 1 {
+		t.Errorf("Unexpected counts nodes=%d probes=%d failures=%d", status.Nodes, status.Probes, status.Failures)
+	}
+	if status.SuccessPercent != 75 {
+		t.Errorf("Expected success 75%%, got %d%%", status.SuccessPercent)
+	}
+	if status.LastRunDuration != "1.5s" {
+		t.Errorf("Expected duration 1.5s, got %s", status.LastRunDuration)
+	}
+	if len(status.FailedPairs) != 1 || status.FailedPairs[0] != (FailedPair{Source: "node-1", Target: "node-2", ErrorClass: ErrorClassUnreachable}) {
+		t.Errorf("Unexpected failed pairs %v", status.FailedPairs)
+	}
+}
+
+func TestOverlayTestUnstructuredRoundTrip(t *testing.T) {
+	test := &OverlayTest{
+		TypeMeta:   meta.TypeMeta{APIVersion: CRDGroup + "/" + CRDVersion, Kind: CRDKind},
+		ObjectMeta: meta.ObjectMeta{Name: "cluster", Namespace: "kube-system"},
+		Spec: OverlayTestSpec{
+			Schedule:     "15m",
+			NodeSelector: map[string]string{"kubernetes.io/os": "linux"},
+			Thresholds:   OverlayTestThresholds{MinSuccessPercent: intPtr(90)},
+		},
+	}
+
+	obj, err := test.ToUnstructured()
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if obj.GetName() != "cluster" || obj.GetKind() != CRDKind {
+		t.Errorf("Unexpected object %s/%s", obj.GetKind(), obj.GetName())
+	}
+
+	back, err := OverlayTestFromUnstructured(obj)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if back.Spec.Schedule != "15m" || *back.Spec.Thresholds.MinSuccessPercent != 90 || back.Spec.NodeSelector["kubernetes.io/os"] != "linux" {
+		t.Errorf("Spec not preserved: %+v", back.Spec)
+	}
+	if back.AppName() != "overlaytest-cluster" {
+		t.Errorf("Expected app name overlaytest-cluster, got %s", back.AppName())
+	}
+}
+
+func TestOverlayTestAppName(t *testing.T) {
+	long := strings.Repeat("a", 60)
+	tests := []struct {
+		name     string
+		expected string
+	}{
+		{"cluster", "overlaytest-cluster"},
+		{strings.Repeat("a", 51), "overlaytest-" + strings.Repeat("a", 51)},
+		{long, ""},
+		{long + "-b", ""},
+		{strings.Repeat("a", 41) + "-" + long, ""},
+	}
+	seen := map[string]bool{}
+	for _, tt := range tests {
+		appName := (&OverlayTest{ObjectMeta: meta.ObjectMeta{Name: tt.name}}).AppName()
+		if tt.expected != "" && appName != tt.expected {
+			t.Errorf("Expected app name %s, got %s", tt.expected, appName)
+		}
+		for _, msg := range validation.IsValidLabelValue(appName) {
+			t.Errorf("Expected a valid label value for %s, got %s: %s", tt.name, appName, msg)
+		}
+		for _, msg := range validation.IsDNS1123Label(appName) {
+			t.Errorf("Expected a valid DaemonSet and Service name for %s, got %s: %s", tt.name, appName, msg)
+		}
+		if seen[appName] {
+			t.Errorf("Expected unique app names, got %s twice", appName)
+		}
+		seen[appName] = true
+	}
+}
@@ -0,0 +1,211 @@
+package overlaytest
+
+import (
+	"context"
+	"fmt"
+
+	batch "k8s.io/api/batch/v1"
+	core "k8s.io/api/core/v1"
+	rbac "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// DefaultSchedule runs the scheduled test every hour
+const DefaultSchedule = "@hourly"
+
+// CronJobArgs are added to the test flags of a scheduled run: remove the DaemonSet after the run,
+// keep the results in the history ConfigMap and log JSON records. Diagnostics bundles are turned
+// off, they could not be fetched from the finished job pod.
+var CronJobArgs = []string{"-cleanup", "-history-configmap", "-log-format=json", "-diagnostics-dir="}
+
+// CronJobOptions describe a scheduled test run inside the cluster
+type CronJobOptions struct {
+	Namespace string
+	Name      string
+	Image     string
+	Schedule  string
+	// Args are the arguments of the test run
+	Args []string
+	// Permissions are granted to the ServiceAccount of the CronJob
+	Permissions []Permission
+}
+
+// CronJobResources are the ServiceAccount, its RBAC rules and the CronJob of a scheduled test
+type CronJobResources struct {
+	ServiceAccount     *core.ServiceAccount
+	ClusterRole        *rbac.ClusterRole
+	ClusterRoleBinding *rbac.ClusterRoleBinding
+	Roles              []*rbac.Role
+	RoleBindings       []*rbac.RoleBinding
+	CronJob            *batch.CronJob
+}
+
+// NewCronJobResources creates the resources of a scheduled test, all named after the test
+func NewCronJobResources(options CronJobOptions) *CronJobResources {
+	labels := map[string]string{ManagedByLabel: ManagedByValue}
+	subjects := []rbac.Subject{{Kind: rbac.ServiceAccountKind, Name: options.Name, Namespace: options.Namespace}}
+
+	resources := &CronJobResources{
+		ServiceAccount: &core.ServiceAccount{
+			TypeMeta:   meta.TypeMeta{APIVersion: "v1", Kind: "ServiceAccount"},
+			ObjectMeta: meta.ObjectMeta{Name: options.Name, Namespace: options.Namespace, Labels: labels},
+		},
+	}
+
+	clusterRole, roles := rbacRoles(options.Name, options.Permissions)
+	if clusterRole != nil {
+		clusterRole.Labels = labels
+		resources.ClusterRole = clusterRole
+		resources.ClusterRoleBinding = &rbac.ClusterRoleBinding{
+			TypeMeta:   meta.TypeMeta{APIVersion: "rbac.authorization.k8s.io/v1", Kind: "ClusterRoleBinding"},
+			ObjectMeta: meta.ObjectMeta{Name: options.Name, Labels: labels},
+			RoleRef:    rbac.RoleRef{APIGroup: rbac.GroupName, Kind: "ClusterRole", Name: clusterRole.Name},
+			Subjects:   subjects,
+		}
+	}
+	for _, role := range roles {
+		role.Labels = labels
+		resources.Roles = append(resources.Roles, role)
+		resources.RoleBindings = append(resources.RoleBindings, &rbac.RoleBinding{
+			TypeMeta:   meta.TypeMeta{APIVersion: "rbac.authorization.k8s.io/v1", Kind: "RoleBinding"},
+			ObjectMeta: meta.ObjectMeta{Name: role.Name, Namespace: role.Namespace, Labels: labels},
+			RoleRef:    rbac.RoleRef{APIGroup: rbac.GroupName, Kind: "Role", Name: role.Name},
+			Subjects:   subjects,
+		})
+	}
+
+	historyLimit, backoffLimit := int32(3), int32(0)
+	nonRoot, privilegeEscalation := true, false
+
+	// The job pods must not carry the app label, they would be taken for test pods
+	resources.CronJob = &batch.CronJob{
+		TypeMeta:   meta.TypeMeta{APIVersion: "batch/v1", Kind: "CronJob"},
+		ObjectMeta: meta.ObjectMeta{Name: options.Name, Namespace: options.Namespace, Labels: labels},
+		Spec: batch.CronJobSpec{
+			Schedule: options.Schedule,
+			// Runs share the DaemonSet
+			ConcurrencyPolicy:          batch.ForbidConcurrent,
+			SuccessfulJobsHistoryLimit: &historyLimit,
+			FailedJobsHistoryLimit:     &historyLimit,
+			JobTemplate: batch.JobTemplateSpec{
+				ObjectMeta: meta.ObjectMeta{Labels: labels},
+				Spec: batch.JobSpec{
+					BackoffLimit: &backoffLimit,
+					Template: core.PodTemplateSpec{
+						ObjectMeta: meta.ObjectMeta{Labels: labels},
+						Spec: core.PodSpec{
+							ServiceAccountName: options.Name,
+							RestartPolicy:      core.RestartPolicyNever,
+							SecurityContext: &core.PodSecurityContext{
+								RunAsNonRoot:   &nonRoot,
+								SeccompProfile: &core.SeccompProfile{Type: core.SeccompProfileTypeRuntimeDefault},
+							},
+							Containers: []core.Container{{
+								Name:    "overlaytest",
+								Image:   options.Image,
+								Command: []string{"overlaytest"},
+								Args:    options.Args,
+								Resources: core.ResourceRequirements{
+									Requests: core.ResourceList{
+										core.ResourceCPU:    resource.MustParse("50m"),
+										core.ResourceMemory: resource.MustParse("64Mi"),
+									},
+									Limits: core.ResourceList{
+										core.ResourceMemory: resource.MustParse("256Mi"),
+									},
+								},
+								SecurityContext: &core.SecurityContext{
+									AllowPrivilegeEscalation: &privilegeEscalation,
+									Capabilities:             &core.Capabilities{Drop: []core.Capability{"ALL"}},
+								},
+							}},
+						},
+					},
+				},
+			},
+		},
+	}
+	return resources
+}
+
+// Objects returns the resources in the order they are applied
+func (r *CronJobResources) Objects() []any {
+	objects := []any{r.ServiceAccount}
+	if r.ClusterRole != nil {
+		objects = append(objects, r.ClusterRole, r.ClusterRoleBinding)
+	}
+	for i := range r.Roles {
+		objects = append(objects, r.Roles[i], r.RoleBindings[i])
+	}
+	return append(objects, r.CronJob)
+}
+
+// Manifest renders the resources as multi-document YAML
+func (r *CronJobResources) Manifest() ([]byte, error) {
+	return marshalManifest(r.Objects())
+}
+
+// Install creates the resources or updates existing ones
+func (r *CronJobResources) Install(ctx context.Context, clientset kubernetes.Interface) error {
+	for _, obj := range r.Objects() {
+		var err error
+		var kind, name string
+		switch o := obj.(type) {
+		case *core.ServiceAccount:
+			kind, name = "serviceaccount", o.Name
+			err = apply(ctx, o, clientset.CoreV1().ServiceAccounts(o.Namespace))
+		case *rbac.ClusterRole:
+			kind, name = "clusterrole", o.Name
+			err = apply(ctx, o, clientset.RbacV1().ClusterRoles())
+		case *rbac.ClusterRoleBinding:
+			kind, name = "clusterrolebinding", o.Name
+			err = apply(ctx, o, clientset.RbacV1().ClusterRoleBindings())
+		case *rbac.Role:
+			kind, name = "role", o.Namespace+"/"+o.Name
+			err = apply(ctx, o, clientset.RbacV1().Roles(o.Namespace))
+		case *rbac.RoleBinding:
+			kind, name = "rolebinding", o.Namespace+"/"+o.Name
+			err = apply(ctx, o, clientset.RbacV1().RoleBindings(o.Namespace))
+		case *batch.CronJob:
+			kind, name = "cronjob", o.Namespace+"/"+o.Name
+			err = apply(ctx, o, clientset.BatchV1().CronJobs(o.Namespace))
+		}
+		if err != nil {
+			return fmt.Errorf("error applying %s %s: %w", kind, name, err)
+		}
+		fmt.Printf("applied %s %s\n", kind, name)
+	}
+	return nil
+}
+
+// object is a typed Kubernetes object of the resource client
+type object interface {
+	GetName() string
+	GetResourceVersion() string
+	SetResourceVersion(string)
+}
+
+// resourceClient is the part of a typed client needed to apply objects
+type resourceClient[T object] interface {
+	Get(ctx context.Context, name string, options meta.GetOptions) (T, error)
+	Create(ctx context.Context, obj T, options meta.CreateOptions) (T, error)
+	Update(ctx context.Context, obj T, options meta.UpdateOptions) (T, error)
+}
+
+// apply creates the object or replaces the existing one
+func apply[T object](ctx context.Context, obj T, client resourceClient[T]) error {
+	existing, err := client.Get(ctx, obj.GetName(), meta.GetOptions{})
+	if errors.IsNotFound(err) {
+		_, err = client.Create(ctx, obj, meta.CreateOptions{})
+		return err
+	}
+	if err != nil {
+		return err
+	}
+	obj.SetResourceVersion(existing.GetResourceVersion())
+	_, err = client.Update(ctx, obj, meta.UpdateOptions{})
+	return err
+}
@@ -0,0 +1,269 @@
+package overlaytest
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+
+	apps "k8s.io/api/apps/v1"
+	batch "k8s.io/api/batch/v1"
+	core "k8s.io/api/core/v1"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	restclient "k8s.io/client-go/rest"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func cronJobOptions() CronJobOptions {
+	config := DefaultConfig()
+	config.Namespace = "overlaytest"
+	config.Events = true
+	return CronJobOptions{
+		Namespace:   "overlaytest",
+		Name:        "overlaytest",
+		Image:       "example.com/overlaytest:v1",
+		Schedule:    "*/30 * * * *",
+		Args:        []string{"-namespace=overlaytest", "-cleanup"},
+		Permissions: RequiredPermissions(config),
+	}
+}
+
+func TestNewCronJobResources(t *testing.T) {
+	resources := NewCronJobResources(cronJobOptions())
+
+	if resources.ClusterRole == nil || resources.ClusterRoleBinding == nil {
+		t.Fatal("Expected a ClusterRole for the node permissions")
+	}
+	// Events of nodes are recorded in the default namespace, CNI ConfigMaps are read in kube-system
+	if len(resources.Roles) != 3 || len(resources.RoleBindings) != 3 {
+		t.Fatalf("Expected a Role per namespace, got %d", len(resources.Roles))
+	}
+	for _, binding := range resources.RoleBindings {
+		subject := binding.Subjects[0]
+		if subject.Kind != "ServiceAccount" || subject.Name != "overlaytest" || subject.Namespace != "overlaytest" {
+			t.Errorf("Expected the ServiceAccount as subject of %s/%s, got %+v", binding.Namespace, binding.Name, subject)
+		}
+	}
+
+	cronJob := resources.CronJob
+	if cronJob.Spec.Schedule != "*/30 * * * *" || cronJob.Spec.ConcurrencyPolicy != batch.ForbidConcurrent {
+		t.Errorf("Unexpected CronJob spec %+v", cronJob.Spec)
+	}
+	pod := cronJob.Spec.JobTemplate.Spec.Template
+	if pod.Spec.ServiceAccountName != "overlaytest" || pod.Spec.RestartPolicy != core.RestartPolicyNever {
+		t.Errorf("Unexpected pod spec %+v", pod.Spec)
+	}
+	if _, ok := pod.Labels["app"]; ok {
+		t.Error("Expected the job pods without app label, they would be selected as test pods")
+	}
+	container := pod.Spec.Containers[0]
+	if container.Image != "example.com/overlaytest:v1" || !reflect.DeepEqual(container.Args, []string{"-namespace=overlaytest", "-cleanup"}) {
+		t.Errorf("Unexpected container %+v", container)
+	}
+}
+
+func TestCronJobManifest(t *testing.T) {
+	manifest, err := NewCronJobResources(cronJobOptions()).Manifest()
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	var kinds []string
+	for _, document := range strings.Split(string(manifest), "---\n") {
+		for _, line := range strings.Split(document, "\n") {
+			if strings.HasPrefix(line, "kind: ") {
+				kinds = append(kinds, strings.TrimPrefix(line, "kind: "))
+			}
+		}
+	}
+	expected := []string{"ServiceAccount", "ClusterRole", "ClusterRoleBinding", "Role", "RoleBinding", "Role", "RoleBinding", "Role", "RoleBinding", "CronJob"}
+	if !reflect.DeepEqual(kinds, expected) {
+		t.Errorf("Expected kinds %v, got %v", expected, kinds)
+	}
+}
+
+func TestCronJobInstall(t *testing.T) {
+	options := cronJobOptions()
+	clientset := fake.NewSimpleClientset(&batch.CronJob{
+		ObjectMeta: meta.ObjectMeta{Name: "overlaytest", Namespace: "overlaytest", ResourceVersion: "7"},
+		Spec:       batch.CronJobSpec{Schedule: "@daily"},
+	})
+
+	if err := NewCronJobResources(options).Install(context.Background(), clientset); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	// Installing again updates the existing resources
+	if err := NewCronJobResources(options).Install(context.Background(), clientset); err != nil {
+		t.Fatalf("Expected no error on reinstall, got: %v", err)
+	}
+
+	ctx := context.Background()
+	if _, err := clientset.CoreV1().ServiceAccounts("overlaytest").Get(ctx, "overlaytest", meta.GetOptions{}); err != nil {
+		t.Errorf("Expected the ServiceAccount: %v", err)
+	}
+	if _, err := clientset.RbacV1().ClusterRoleBindings().Get(ctx, "overlaytest", meta.GetOptions{}); err != nil {
+		t.Errorf("Expected the ClusterRoleBinding: %v", err)
+	}
+	if _, err := clientset.RbacV1().RoleBindings(meta.NamespaceDefault).Get(ctx, "overlaytest", meta.GetOptions{}); err != nil {
+		t.Errorf("Expected the RoleBinding for node events: %v", err)
+	}
+	cronJob, err := clientset.BatchV1().CronJobs("overlaytest").Get(ctx, "overlaytest", meta.GetOptions{})
+	if err != nil {
+		t.Fatalf("Expected the CronJob: %v", err)
+	}
+	if cronJob.Spec.Schedule != "*/30 * * * *" {
+		t.Errorf("Expected the existing CronJob to be updated, got schedule %s", cronJob.Spec.Schedule)
+	}
+}
+
+// applyArgs sets the config fields of flags like "-cleanup" or "-log-format=json"
+func applyArgs(t *testing.T, config *Config, args []string) {
+	t.Helper()
+	for _, arg := range args {
+		name, value, found := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		i := slices.IndexFunc(ConfigFields, func(field ConfigField) bool { return field.Name == name })
+		if i < 0 {
+			t.Fatalf("Unknown flag %s", arg)
+		}
+		if !found && ConfigFields[i].Bool {
+			value = "true"
+		}
+		if err := ConfigFields[i].Set(config, value); err != nil {
+			t.Fatalf("Invalid flag %s: %v", arg, err)
+		}
+	}
+}
+
+// cronJobCluster is a cluster with two test pods and a Calico agent on node-1
+func cronJobCluster(namespace string) *fake.Clientset {
+	var objects []runtime.Object
+	for i, node := range []string{"node-1", "node-2"} {
+		objects = append(objects,
+			&core.Node{ObjectMeta: meta.ObjectMeta{Name: node}},
+			&core.Pod{
+				ObjectMeta: meta.ObjectMeta{Name: "overlaytest-" + node, Namespace: namespace, Labels: map[string]string{"app": "overlaytest"}},
+				Spec:       core.PodSpec{NodeName: node},
+				Status:     core.PodStatus{Phase: core.PodRunning, PodIP: []string{"10.244.0.1", "10.244.1.1"}[i]},
+			})
+	}
+	calicoLabels := map[string]string{"k8s-app": "calico-node"}
+	objects = append(objects,
+		&apps.DaemonSet{
+			ObjectMeta: meta.ObjectMeta{Name: "calico-node", Namespace: meta.NamespaceSystem},
+			Spec: apps.DaemonSetSpec{
+				Selector: &meta.LabelSelector{MatchLabels: calicoLabels},
+				Template: core.PodTemplateSpec{Spec: core.PodSpec{Containers: []core.Container{{Image: "calico/node:v3.27.0"}}}},
+			},
+		},
+		&core.Pod{
+			ObjectMeta: meta.ObjectMeta{Name: "calico-node-x", Namespace: meta.NamespaceSystem, Labels: calicoLabels},
+			Spec:       core.PodSpec{NodeName: "node-1"},
+		})
+
+	clientset := fake.NewSimpleClientset(objects...)
+	// The DaemonSet controller is missing, report the pods as ready
+	clientset.PrependReactor("get", "daemonsets", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		get := action.(k8stesting.GetAction)
+		obj, err := clientset.Tracker().Get(action.GetResource(), get.GetNamespace(), get.GetName())
+		if err != nil {
+			return true, nil, err
+		}
+		daemonset := obj.(*apps.DaemonSet).DeepCopy()
+		daemonset.Status.DesiredNumberScheduled = 2
+		daemonset.Status.NumberReady = 2
+		return true, daemonset, nil
+	})
+	clientset.PrependProxyReactor("pods", func(action k8stesting.Action) (bool, restclient.ResponseWrapper, error) {
+		body, _ := json.Marshal(AgentResults{Results: []ProbeResult{{TargetIP: "10.244.1.1", ErrorClass: ErrorClassUnreachable}}})
+		return true, fakeProxyResponse{body: body}, nil
+	})
+	return clientset
+}
+
+func TestCronJobPermissionsCoverRun(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+	}{
+		{"Exec", nil},
+		{"Agent", []string{"-agent"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			config := DefaultConfig()
+			applyArgs(t, config, append([]string{"-namespace=overlaytest"}, append(tt.args, CronJobArgs...)...))
+			if err := config.Validate(); err != nil {
+				t.Fatalf("Expected a valid config, got: %v", err)
+			}
+			if config.DiagnosticsDir != "" {
+				t.Errorf("Expected no diagnostics bundle in the job pod, got dir %q", config.DiagnosticsDir)
+			}
+			permissions := RequiredPermissions(config)
+			clientset := cronJobCluster(config.Namespace)
+
+			// The API calls of a scheduled run, exec is not recorded by the fake clientset
+			if err := CreateOrReuseDaemonSet(ctx, clientset, config, config.Reuse); err != nil {
+				t.Fatalf("Expected no error, got: %v", err)
+			}
+			if err := WaitForDaemonSetReady(ctx, clientset, config.Namespace, config.AppName); err != nil {
+				t.Fatalf("Expected no error, got: %v", err)
+			}
+			coverage, err := CheckNodeCoverage(ctx, clientset, config)
+			if err != nil {
+				t.Fatalf("Expected no error, got: %v", err)
+			}
+			if err := WaitForPodNetwork(ctx, clientset, config.Namespace, coverage.Pods); err != nil {
+				t.Fatalf("Expected no error, got: %v", err)
+			}
+			pods, err := SelectTestPods(ctx, clientset, config)
+			if err != nil || len(pods) != 2 {
+				t.Fatalf("Expected 2 test pods, got %d: %v", len(pods), err)
+			}
+			report := &Report{Nodes: GetNodeInfo(ctx, clientset, pods), Results: []ProbeResult{{SourceNode: "node-1", TargetNode: "node-2"}}}
+			if config.Agent {
+				if report, err = CollectAgentResults(ctx, clientset, config.Namespace, pods); err != nil {
+					t.Fatalf("Expected no error, got: %v", err)
+				}
+			}
+			cni, err := DetectCNI(ctx, clientset)
+			if err != nil || cni == nil {
+				t.Fatalf("Expected Calico to be detected, got %v: %v", cni, err)
+			}
+			if _, err := CheckCNIAgents(ctx, clientset, cni, FailingNodes(report)); err != nil {
+				t.Fatalf("Expected no error, got: %v", err)
+			}
+			// Creates the history ConfigMap, then updates it
+			for range 2 {
+				if err := NewHistoryStore(clientset, config).Save(ctx, "cluster", report); err != nil {
+					t.Fatalf("Expected no error, got: %v", err)
+				}
+			}
+			if err := Cleanup(ctx, clientset, config); err != nil {
+				t.Fatalf("Expected no error, got: %v", err)
+			}
+
+			var calls []Permission
+			for _, action := range clientset.Actions() {
+				resource := action.GetResource()
+				calls = append(calls, Permission{Group: resource.Group, Resource: resource.Resource, Subresource: action.GetSubresource(),
+					Verb: action.GetVerb(), Namespace: action.GetNamespace()})
+			}
+			if !config.Agent {
+				calls = append(calls, Permission{Resource: "pods", Subresource: "exec", Verb: "create", Namespace: config.Namespace})
+			}
+			for _, call := range calls {
+				granted := slices.ContainsFunc(permissions, func(p Permission) bool {
+					return p.Group == call.Group && p.Resource == call.Resource && p.Subresource == call.Subresource &&
+						p.Verb == call.Verb && (p.Namespace == "" || p.Namespace == call.Namespace)
+				})
+				if !granted {
+					t.Errorf("Expected the permission to %s", call)
+				}
+			}
+		})
+	}
+}
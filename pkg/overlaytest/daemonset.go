@@ -10,6 +10,7 @@ import (
 	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/resource"
 	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
 	"k8s.io/client-go/kubernetes"
 )
 
@@ -82,50 +83,175 @@ func CreateDaemonSetSpec(namespace, app, image string) *apps.DaemonSet {
 	}
 }
 
+// CreateAgentDaemonSetSpec creates a DaemonSet specification running the probe agent.
+// The image must contain the overlaytest binary.
+func CreateAgentDaemonSetSpec(namespace, app, image string) *apps.DaemonSet {
+	daemonset := CreateDaemonSetSpec(namespace, app, image)
+
+	container := &daemonset.Spec.Template.Spec.Containers[0]
+	container.Command = []string{"overlaytest", "agent"}
+	container.Args = []string{fmt.Sprintf("-port=%d", DefaultAgentPort)}
+	container.Env = []core.EnvVar{
+		{
+			Name: "NODE_NAME",
+			ValueFrom: &core.EnvVarSource{
+				FieldRef: &core.ObjectFieldSelector{FieldPath: "spec.nodeName"},
+			},
+		},
+		{
+			Name: "POD_IP",
+			ValueFrom: &core.EnvVarSource{
+				FieldRef: &core.ObjectFieldSelector{FieldPath: "status.podIP"},
+			},
+		},
+		{
+			Name:  "PEER_SERVICE",
+			Value: fmt.Sprintf("%s.%s.svc", app, namespace),
+		},
+	}
+	container.Ports = []core.ContainerPort{{
+		Name:          "http",
+		ContainerPort: DefaultAgentPort,
+		Protocol:      core.ProtocolTCP,
+	}}
+	container.ReadinessProbe = &core.Probe{
+		ProbeHandler: core.ProbeHandler{
+			HTTPGet: &core.HTTPGetAction{
+				Path: "/healthz",
+				Port: intstr.FromString("http"),
+			},
+		},
+	}
+	return daemonset
+}
+
+// CreateAgentServiceSpec creates the headless Service the agents use to discover their peers
+func CreateAgentServiceSpec(app string) *core.Service {
+	return &core.Service{
+		ObjectMeta: meta.ObjectMeta{
+			Name: app,
+		},
+		Spec: core.ServiceSpec{
+			ClusterIP: core.ClusterIPNone,
+			Selector: map[string]string{
+				"app": app,
+			},
+			// Peers must be discoverable before they pass their readiness probe
+			PublishNotReadyAddresses: true,
+			Ports: []core.ServicePort{{
+				Name:       "http",
+				Port:       DefaultAgentPort,
+				TargetPort: intstr.FromString("http"),
+			}},
+		},
+	}
+}
+
 // CreateOrReuseDaemonSet creates a new DaemonSet or exits if it exists (when not reusing)
 func CreateOrReuseDaemonSet(ctx context.Context, clientset kubernetes.Interface, config *Config, reuse bool) error {
 	daemonsetsClient := clientset.AppsV1().DaemonSets(config.Namespace)
 	daemonset := CreateDaemonSetSpec(config.Namespace, config.AppName, config.Image)
+	if config.Agent {
+		daemonset = CreateAgentDaemonSetSpec(config.Namespace, config.AppName, config.Image)
+	}
+	ApplySecurityMode(daemonset, config.SecurityMode)
+	if config.Traceroute != "" {
+		ApplyTracerouteUser(daemonset)
+	}
+	daemonset, err := CustomizeDaemonSet(daemonset, config)
+	if err != nil {
+		return err
+	}
 
 	if !reuse {
-		fmt.Println("Creating daemonset...")
+		if config.CreateNamespace {
+			if err := EnsureNamespace(ctx, clientset, config.Namespace, config.SecurityMode); err != nil {
+				return err
+			}
+		}
+
+		fmt.Fprintln(Stdout(ctx), "Creating daemonset...")
 		result, err := daemonsetsClient.Create(ctx, daemonset, meta.CreateOptions{})
 		if errors.IsAlreadyExists(err) {
-			fmt.Println("daemonset already exists, deleting ... & exit")
-			deletePolicy := meta.DeletePropagationForeground
-			if err := daemonsetsClient.Delete(ctx, config.AppName, meta.DeleteOptions{
-				PropagationPolicy: &deletePolicy,
-			}); err != nil {
+			fmt.Fprintln(Stdout(ctx), "daemonset already exists, deleting ... & exit")
+			if err := Cleanup(ctx, clientset, config); err != nil {
 				return err
 			}
 			return fmt.Errorf("daemonset already existed, deleted it - please run again")
 		} else if err != nil {
 			return err
 		}
-		fmt.Printf("Created daemonset %q.\n", result.GetObjectMeta().GetName())
+		fmt.Fprintf(Stdout(ctx), "Created daemonset %q.\n", result.GetObjectMeta().GetName())
+
+		if config.Agent {
+			service, err := clientset.CoreV1().Services(config.Namespace).Create(ctx, CreateAgentServiceSpec(config.AppName), meta.CreateOptions{})
+			if err != nil && !errors.IsAlreadyExists(err) {
+				return err
+			}
+			if err == nil {
+				fmt.Fprintf(Stdout(ctx), "Created service %q.\n", service.GetObjectMeta().GetName())
+			}
+		}
 	}
 	return nil
 }
 
-// WaitForDaemonSetReady waits for all DaemonSet pods to be ready
+// Cleanup removes the DaemonSet, the agent Service and, with CreateNamespace, the namespace if overlaytest created it.
+// Other namespaces are kept.
+func Cleanup(ctx context.Context, clientset kubernetes.Interface, config *Config) error {
+	deletePolicy := meta.DeletePropagationForeground
+	if err := clientset.AppsV1().DaemonSets(config.Namespace).Delete(ctx, config.AppName, meta.DeleteOptions{
+		PropagationPolicy: &deletePolicy,
+	}); err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	// The agent service is only present for agent deployments, other runs may lack the permission to delete services
+	if config.Agent {
+		if err := clientset.CoreV1().Services(config.Namespace).Delete(ctx, config.AppName, meta.DeleteOptions{}); err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+	}
+	if !config.CreateNamespace {
+		return nil
+	}
+
+	// A namespace which existed before the test is used as it is and kept
+	namespace, err := clientset.CoreV1().Namespaces().Get(ctx, config.Namespace, meta.GetOptions{})
+	if errors.IsNotFound(err) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("error getting namespace: %w", err)
+	}
+	if !IsManagedNamespace(namespace) {
+		fmt.Fprintf(Stdout(ctx), "namespace %s is not managed by overlaytest, keeping it\n", config.Namespace)
+		return nil
+	}
+	return DeleteNamespace(ctx, clientset, config.Namespace)
+}
+
+// WaitForDaemonSetReady waits until a pod is ready on every node the DaemonSet is scheduled to.
+// When ctx ends first, the error tells how many pods are ready and wraps the context error.
 func WaitForDaemonSetReady(ctx context.Context, clientset kubernetes.Interface, namespace, name string) error {
 	for {
 		obj, err := clientset.AppsV1().DaemonSets(namespace).Get(ctx, name, meta.GetOptions{})
 		if err != nil {
 			return fmt.Errorf("error getting daemonset: %w", err)
 		}
-		if obj.Status.NumberReady != 0 {
-			fmt.Printf("all pods ready\n")
-			break
+		if obj.Status.NumberReady != 0 && obj.Status.NumberReady >= obj.Status.DesiredNumberScheduled {
+			fmt.Fprintf(Stdout(ctx), "all pods ready\n")
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%d of %d pods ready: %w", obj.Status.NumberReady, obj.Status.DesiredNumberScheduled, ctx.Err())
+		case <-time.After(2 * time.Second):
 		}
-		time.Sleep(2 * time.Second)
 	}
-	return nil
 }
 
-// GetOverlayTestPods returns all pods with the overlaytest label
-func GetOverlayTestPods(ctx context.Context, clientset kubernetes.Interface, namespace string) (*core.PodList, error) {
-	pods, err := clientset.CoreV1().Pods(namespace).List(ctx, meta.ListOptions{LabelSelector: "app=overlaytest"})
+// GetOverlayTestPods returns all pods of the test DaemonSet of the config
+func GetOverlayTestPods(ctx context.Context, clientset kubernetes.Interface, config *Config) (*core.PodList, error) {
+	pods, err := clientset.CoreV1().Pods(config.Namespace).List(ctx, meta.ListOptions{LabelSelector: "app=" + config.AppName})
 	if err != nil {
 		return nil, err
 	}
@@ -134,7 +260,7 @@ func GetOverlayTestPods(ctx context.Context, clientset kubernetes.Interface, nam
 
 // WaitForPodNetwork waits for all pods to have valid IP addresses
 func WaitForPodNetwork(ctx context.Context, clientset kubernetes.Interface, namespace string, pods []core.Pod) error {
-	fmt.Printf("checking pod network...\n")
+	fmt.Fprintf(Stdout(ctx), "checking pod network...\n")
 	for _, pod := range pods {
 		for {
 			podi, err := clientset.CoreV1().Pods(namespace).Get(ctx, pod.ObjectMeta.Name, meta.GetOptions{})
@@ -143,11 +269,45 @@ func WaitForPodNetwork(ctx context.Context, clientset kubernetes.Interface, name
 			}
 
 			if ValidatePodIP(podi.Status.PodIP) {
-				fmt.Println(podi.ObjectMeta.Name, "ready", podi.Status.PodIP)
+				fmt.Fprintln(Stdout(ctx), podi.ObjectMeta.Name, "ready", podi.Status.PodIP)
 				break
 			}
 		}
 	}
-	fmt.Printf("all pods have network\n")
+	fmt.Fprintf(Stdout(ctx), "all pods have network\n")
 	return nil
 }
+
+// SelectTestPods returns the running pods of the test DaemonSet with a pod IP on nodes matching the node selector of the config
+func SelectTestPods(ctx context.Context, clientset kubernetes.Interface, config *Config) ([]core.Pod, error) {
+	list, err := clientset.CoreV1().Pods(config.Namespace).List(ctx, meta.ListOptions{LabelSelector: "app=" + config.AppName})
+	if err != nil {
+		return nil, err
+	}
+	var pods []core.Pod
+	for _, pod := range list.Items {
+		if pod.Status.Phase == core.PodRunning && ValidatePodIP(pod.Status.PodIP) {
+			pods = append(pods, pod)
+		}
+	}
+	if config.NodeSelector == "" {
+		return pods, nil
+	}
+
+	nodes, err := clientset.CoreV1().Nodes().List(ctx, meta.ListOptions{LabelSelector: config.NodeSelector})
+	if err != nil {
+		return nil, fmt.Errorf("error listing nodes: %w", err)
+	}
+	selected := make(map[string]bool, len(nodes.Items))
+	for _, node := range nodes.Items {
+		selected[node.Name] = true
+	}
+
+	var filtered []core.Pod
+	for _, pod := range pods {
+		if selected[pod.Spec.NodeName] {
+			filtered = append(filtered, pod)
+		}
+	}
+	return filtered, nil
+}
@@ -2,7 +2,12 @@ package overlaytest
 
 import (
 	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
 	"testing"
+	"time"
 
 	core "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
@@ -350,11 +355,30 @@ func TestWaitForDaemonSetReady(t *testing.T) {
 			t.Errorf("Unexpected error: %v", err)
 		}
 	})
+
+	t.Run("Waits for all scheduled pods", func(t *testing.T) {
+		ds := CreateDaemonSetSpec(namespace, appName, "test-image")
+		ds.Status.NumberReady = 1
+		ds.Status.DesiredNumberScheduled = 3
+		ds.Namespace = namespace
+		clientset := fake.NewSimpleClientset(ds)
+
+		ctx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+		defer cancel()
+		err := WaitForDaemonSetReady(ctx, clientset, namespace, appName)
+		if err == nil || ctx.Err() == nil {
+			t.Fatalf("Expected the deadline to be exceeded, got: %v", err)
+		}
+		if !strings.Contains(err.Error(), "1 of 3 pods ready") {
+			t.Errorf("Expected the number of ready pods in the error, got: %v", err)
+		}
+	})
 }
 
 func TestGetOverlayTestPods(t *testing.T) {
 	ctx := context.Background()
 	namespace := "test-namespace"
+	config := &Config{Namespace: namespace, AppName: "overlaytest"}
 
 	t.Run("Get pods successfully", func(t *testing.T) {
 		pod1 := &core.Pod{
@@ -374,7 +398,7 @@ func TestGetOverlayTestPods(t *testing.T) {
 
 		clientset := fake.NewSimpleClientset(pod1, pod2)
 
-		pods, err := GetOverlayTestPods(ctx, clientset, namespace)
+		pods, err := GetOverlayTestPods(ctx, clientset, config)
 		if err != nil {
 			t.Errorf("Expected no error, got: %v", err)
 		}
@@ -387,7 +411,7 @@ func TestGetOverlayTestPods(t *testing.T) {
 	t.Run("No pods found", func(t *testing.T) {
 		clientset := fake.NewSimpleClientset()
 
-		pods, err := GetOverlayTestPods(ctx, clientset, namespace)
+		pods, err := GetOverlayTestPods(ctx, clientset, config)
 		if err != nil {
 			t.Errorf("Expected no error, got: %v", err)
 		}
@@ -415,7 +439,7 @@ func TestGetOverlayTestPods(t *testing.T) {
 
 		clientset := fake.NewSimpleClientset(overlayPod, otherPod)
 
-		pods, err := GetOverlayTestPods(ctx, clientset, namespace)
+		pods, err := GetOverlayTestPods(ctx, clientset, config)
 		if err != nil {
 			t.Errorf("Expected no error, got: %v", err)
 		}
@@ -423,6 +447,14 @@ func TestGetOverlayTestPods(t *testing.T) {
 		if len(pods.Items) != 1 {
 			t.Errorf("Expected 1 pod with overlaytest label, got %d", len(pods.Items))
 		}
+
+		pods, err = GetOverlayTestPods(ctx, clientset, &Config{Namespace: namespace, AppName: "other"})
+		if err != nil {
+			t.Errorf("Expected no error, got: %v", err)
+		}
+		if len(pods.Items) != 1 || pods.Items[0].Name != "other-pod" {
+			t.Errorf("Expected the pod of the app name, got %v", pods.Items)
+		}
 	})
 }
 
@@ -515,3 +547,157 @@ func TestDaemonSetEdgeCases(t *testing.T) {
 		}
 	})
 }
+
+func TestCreateAgentDaemonSetSpec(t *testing.T) {
+	ds := CreateAgentDaemonSetSpec("test-namespace", "test-app", "test-image")
+	container := ds.Spec.Template.Spec.Containers[0]
+
+	if len(container.Command) != 2 || container.Command[0] != "overlaytest" || container.Command[1] != "agent" {
+		t.Errorf("Expected agent command, got %v", container.Command)
+	}
+
+	env := map[string]core.EnvVar{}
+	for _, e := range container.Env {
+		env[e.Name] = e
+	}
+	if env["NODE_NAME"].ValueFrom == nil || env["NODE_NAME"].ValueFrom.FieldRef.FieldPath != "spec.nodeName" {
+		t.Error("Expected NODE_NAME from downward API")
+	}
+	if env["POD_IP"].ValueFrom == nil || env["POD_IP"].ValueFrom.FieldRef.FieldPath != "status.podIP" {
+		t.Error("Expected POD_IP from downward API")
+	}
+	if env["PEER_SERVICE"].Value != "test-app.test-namespace.svc" {
+		t.Errorf("Expected PEER_SERVICE test-app.test-namespace.svc, got %s", env["PEER_SERVICE"].Value)
+	}
+
+	if len(container.Ports) != 1 || container.Ports[0].ContainerPort != DefaultAgentPort {
+		t.Errorf("Expected container port %d, got %v", DefaultAgentPort, container.Ports)
+	}
+	if container.ReadinessProbe == nil || container.ReadinessProbe.HTTPGet.Path != "/healthz" {
+		t.Error("Expected readiness probe on /healthz")
+	}
+
+	// Security settings are inherited from the exec DaemonSet
+	if container.SecurityContext == nil || *container.SecurityContext.RunAsUser != 1000 {
+		t.Error("Expected security context to be kept")
+	}
+}
+
+func TestCreateAgentServiceSpec(t *testing.T) {
+	svc := CreateAgentServiceSpec("test-app")
+
+	if svc.Spec.ClusterIP != core.ClusterIPNone {
+		t.Errorf("Expected headless service, got cluster IP %s", svc.Spec.ClusterIP)
+	}
+	if svc.Spec.Selector["app"] != "test-app" {
+		t.Errorf("Expected selector app=test-app, got %v", svc.Spec.Selector)
+	}
+	if !svc.Spec.PublishNotReadyAddresses {
+		t.Error("Expected not ready addresses to be published")
+	}
+}
+
+func TestCreateOrReuseDaemonSetAgent(t *testing.T) {
+	ctx := context.Background()
+	clientset := fake.NewSimpleClientset()
+	config := &Config{
+		Namespace: "test-namespace",
+		AppName:   "test-app",
+		Image:     "test-image",
+		Agent:     true,
+	}
+
+	if err := CreateOrReuseDaemonSet(ctx, clientset, config, false); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	ds, err := clientset.AppsV1().DaemonSets("test-namespace").Get(ctx, "test-app", meta.GetOptions{})
+	if err != nil {
+		t.Fatalf("Expected DaemonSet to be created, got: %v", err)
+	}
+	if ds.Spec.Template.Spec.Containers[0].Command[0] != "overlaytest" {
+		t.Error("Expected agent DaemonSet")
+	}
+
+	if _, err := clientset.CoreV1().Services("test-namespace").Get(ctx, "test-app", meta.GetOptions{}); err != nil {
+		t.Errorf("Expected agent service to be created, got: %v", err)
+	}
+}
+
+func TestCleanup(t *testing.T) {
+	ctx := context.Background()
+	for _, agent := range []bool{false, true} {
+		t.Run(fmt.Sprintf("agent=%v", agent), func(t *testing.T) {
+			config := &Config{Namespace: "test-namespace", AppName: "test-app", Image: "test-image", Agent: agent}
+			service := CreateAgentServiceSpec("test-app")
+			service.Namespace = "test-namespace"
+			clientset := fake.NewSimpleClientset(service)
+			clientset.PrependReactor("delete", "services", func(action k8stesting.Action) (bool, runtime.Object, error) {
+				if !agent {
+					t.Error("Expected no service deletion outside of agent mode")
+				}
+				return false, nil, nil
+			})
+			if err := CreateOrReuseDaemonSet(ctx, clientset, config, false); err != nil {
+				t.Fatalf("Expected no error, got: %v", err)
+			}
+
+			if err := Cleanup(ctx, clientset, config); err != nil {
+				t.Fatalf("Expected no error, got: %v", err)
+			}
+			if _, err := clientset.AppsV1().DaemonSets("test-namespace").Get(ctx, "test-app", meta.GetOptions{}); !errors.IsNotFound(err) {
+				t.Errorf("Expected DaemonSet to be deleted, got: %v", err)
+			}
+			if _, err := clientset.CoreV1().Services("test-namespace").Get(ctx, "test-app", meta.GetOptions{}); errors.IsNotFound(err) != agent {
+				t.Errorf("Expected agent service to be deleted only in agent mode, got: %v", err)
+			}
+		})
+	}
+}
+
+func TestSelectTestPods(t *testing.T) {
+	ctx := context.Background()
+	pod := func(name, node string) *core.Pod {
+		return &core.Pod{
+			ObjectMeta: meta.ObjectMeta{Name: name, Namespace: "test-namespace", Labels: map[string]string{"app": "nettest"}},
+			Spec:       core.PodSpec{NodeName: node},
+			Status:     core.PodStatus{Phase: core.PodRunning, PodIP: "10.244.0.1"},
+		}
+	}
+	node := func(name, pool string) *core.Node {
+		return &core.Node{ObjectMeta: meta.ObjectMeta{Name: name, Labels: map[string]string{"pool": pool}}}
+	}
+	pending := pod("nettest-c", "node-3")
+	pending.Status = core.PodStatus{Phase: core.PodPending}
+	clientset := fake.NewSimpleClientset(
+		pod("nettest-a", "node-1"), pod("nettest-b", "node-2"), pending,
+		node("node-1", "a"), node("node-2", "b"), node("node-3", "b"),
+	)
+
+	tests := []struct {
+		name     string
+		selector string
+		expected []string
+	}{
+		{"No selector", "", []string{"nettest-a", "nettest-b"}},
+		{"Matching selector", "pool=b", []string{"nettest-b"}},
+		{"No matching nodes", "pool=c", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &Config{Namespace: "test-namespace", AppName: "nettest", NodeSelector: tt.selector}
+			pods, err := SelectTestPods(ctx, clientset, config)
+			if err != nil {
+				t.Fatalf("Expected no error, got: %v", err)
+			}
+			var names []string
+			for _, pod := range pods {
+				names = append(names, pod.Name)
+			}
+			sort.Strings(names)
+			if !reflect.DeepEqual(names, tt.expected) {
+				t.Errorf("Expected pods %v, got %v", tt.expected, names)
+			}
+		})
+	}
+}
@@ -0,0 +1,237 @@
+package overlaytest
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// Verdict kinds, ordered from the broadest to the narrowest explanation
+const (
+	VerdictIsolated    = "isolated"       // node can neither send nor receive
+	VerdictCannotSend  = "cannot-send"    // node reaches no other node
+	VerdictCannotRecv  = "cannot-receive" // node is reached by no other node
+	VerdictPartition   = "partition"      // groups of nodes reach each other but not the other groups
+	VerdictAsymmetric  = "asymmetric"     // pair fails in one direction only
+	VerdictPairFailure = "pair"           // pair fails in both directions
+)
+
+// minPeers is the number of probed peers required to blame a single node
+const minPeers = 2
+
+// Verdict is one explanation of a set of failed probes
+type Verdict struct {
+	Kind string `json:"kind"`
+	// Nodes are the nodes the verdict blames, the source and target for pair verdicts
+	Nodes []string `json:"nodes,omitempty"`
+	// Groups are the node groups of a partition
+	Groups   [][]string `json:"groups,omitempty"`
+	Failures int        `json:"failures"`
+	Message  string     `json:"message"`
+}
+
+// Diagnosis explains the failed probes of a report with as few verdicts as possible
+type Diagnosis struct {
+	Failures int       `json:"failures"`
+	Verdicts []Verdict `json:"verdicts,omitempty"`
+}
+
+// nodeStats are the probes of a node to and from other nodes
+type nodeStats struct {
+	outOK, outTotal int
+	inOK, inTotal   int
+}
+
+// Diagnose finds the minimal set of nodes and node groups explaining the failures.
+// Nodes which can not send or receive at all are blamed first, then partitions of the
+// remaining nodes are detected and the rest is reported per node pair.
+func Diagnose(report *Report) *Diagnosis {
+	m := newMatrix(report)
+	diagnosis := &Diagnosis{Failures: len(report.Failures())}
+	if diagnosis.Failures == 0 {
+		return diagnosis
+	}
+
+	stats := map[string]*nodeStats{}
+	for _, node := range m.nodes {
+		stats[node] = &nodeStats{}
+	}
+	for key, result := range m.results {
+		if key[0] == key[1] {
+			continue
+		}
+		source, target := stats[key[0]], stats[key[1]]
+		source.outTotal++
+		target.inTotal++
+		if result.Reachable {
+			source.outOK++
+			target.inOK++
+		}
+	}
+
+	// explained marks the failed probes covered by a verdict
+	explained := map[[2]string]bool{}
+	explain := func(key [2]string) int {
+		if result, ok := m.results[key]; ok && !result.Reachable && !explained[key] {
+			explained[key] = true
+			return 1
+		}
+		return 0
+	}
+
+	// Broken nodes
+	blamed := map[string]bool{}
+	for _, node := range m.nodes {
+		s := stats[node]
+		cannotSend := s.outTotal >= minPeers && s.outOK == 0
+		cannotRecv := s.inTotal >= minPeers && s.inOK == 0
+		if !cannotSend && !cannotRecv {
+			continue
+		}
+		blamed[node] = true
+
+		verdict := Verdict{Nodes: []string{node}}
+		for _, peer := range m.nodes {
+			if peer == node {
+				continue
+			}
+			if cannotSend {
+				verdict.Failures += explain([2]string{node, peer})
+			}
+			if cannotRecv {
+				verdict.Failures += explain([2]string{peer, node})
+			}
+		}
+		switch {
+		case cannotSend && cannotRecv:
+			verdict.Kind = VerdictIsolated
+			verdict.Message = fmt.Sprintf("%s is isolated, it can neither send nor receive traffic", node)
+		case cannotSend:
+			verdict.Kind = VerdictCannotSend
+			verdict.Message = fmt.Sprintf("%s cannot send traffic (reaches 0 of %d nodes)", node, s.outTotal)
+		default:
+			verdict.Kind = VerdictCannotRecv
+			verdict.Message = fmt.Sprintf("%s cannot receive traffic (reached by 0 of %d nodes)", node, s.inTotal)
+		}
+		diagnosis.Verdicts = append(diagnosis.Verdicts, verdict)
+	}
+
+	// Partitions of the remaining nodes, connected by successful probes in any direction
+	var remaining []string
+	for _, node := range m.nodes {
+		if !blamed[node] {
+			remaining = append(remaining, node)
+		}
+	}
+	if groups := partitionGroups(m, remaining); len(groups) > 1 {
+		verdict := Verdict{Kind: VerdictPartition, Groups: groups}
+		group := map[string]int{}
+		for i, nodes := range groups {
+			for _, node := range nodes {
+				group[node] = i
+			}
+		}
+		for key := range m.results {
+			if gs, ok := group[key[0]]; ok {
+				if gt, ok := group[key[1]]; ok && gs != gt {
+					verdict.Failures += explain(key)
+				}
+			}
+		}
+		names := make([]string, len(groups))
+		for i, nodes := range groups {
+			names[i] = "[" + strings.Join(nodes, " ") + "]"
+		}
+		verdict.Message = fmt.Sprintf("network is partitioned, the groups %s cannot reach each other", strings.Join(names, ", "))
+		diagnosis.Verdicts = append(diagnosis.Verdicts, verdict)
+	}
+
+	// Remaining failures per node pair
+	for _, result := range sortedFailures(report) {
+		key := [2]string{result.SourceNode, result.TargetNode}
+		if explained[key] {
+			continue
+		}
+		reverse := [2]string{result.TargetNode, result.SourceNode}
+		verdict := Verdict{Nodes: []string{result.SourceNode, result.TargetNode}, Failures: explain(key)}
+		switch back, ok := m.results[reverse]; {
+		case key == reverse:
+			verdict.Kind = VerdictPairFailure
+			verdict.Message = fmt.Sprintf("%s cannot reach its own pod", result.SourceNode)
+		case ok && back.Reachable:
+			verdict.Kind = VerdictAsymmetric
+			verdict.Message = fmt.Sprintf("%s cannot reach %s, but %s reaches %s", result.SourceNode, result.TargetNode, result.TargetNode, result.SourceNode)
+		case ok:
+			verdict.Kind = VerdictPairFailure
+			verdict.Failures += explain(reverse)
+			verdict.Message = fmt.Sprintf("%s and %s cannot reach each other", result.SourceNode, result.TargetNode)
+		default:
+			verdict.Kind = VerdictPairFailure
+			verdict.Message = fmt.Sprintf("%s cannot reach %s", result.SourceNode, result.TargetNode)
+		}
+		diagnosis.Verdicts = append(diagnosis.Verdicts, verdict)
+	}
+	return diagnosis
+}
+
+// partitionGroups returns the connected components of the nodes, linked by successful probes.
+// Nodes without probes to other nodes of the set are left out.
+func partitionGroups(m *matrix, nodes []string) [][]string {
+	parent := map[string]string{}
+	for _, node := range nodes {
+		parent[node] = node
+	}
+	var find func(string) string
+	find = func(node string) string {
+		if parent[node] != node {
+			parent[node] = find(parent[node])
+		}
+		return parent[node]
+	}
+
+	probed := map[string]bool{}
+	for key, result := range m.results {
+		_, sourceOK := parent[key[0]]
+		_, targetOK := parent[key[1]]
+		if !sourceOK || !targetOK || key[0] == key[1] {
+			continue
+		}
+		probed[key[0]], probed[key[1]] = true, true
+		if result.Reachable {
+			parent[find(key[0])] = find(key[1])
+		}
+	}
+
+	members := map[string][]string{}
+	for _, node := range nodes {
+		if probed[node] {
+			root := find(node)
+			members[root] = append(members[root], node)
+		}
+	}
+	groups := make([][]string, 0, len(members))
+	for _, group := range members {
+		sort.Strings(group)
+		groups = append(groups, group)
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i][0] < groups[j][0] })
+	return groups
+}
+
+func sortedFailures(report *Report) []ProbeResult {
+	failures := report.Failures()
+	sortResults(failures)
+	return failures
+}
+
+// PrintDiagnosis writes one line per verdict
+func PrintDiagnosis(w io.Writer, diagnosis *Diagnosis) {
+	if diagnosis.Failures == 0 {
+		return
+	}
+	fmt.Fprintf(w, "\nDiagnosis of %d failed probes:\n", diagnosis.Failures)
+	for _, verdict := range diagnosis.Verdicts {
+		fmt.Fprintf(w, "  %s, explains %d failed probes\n", verdict.Message, verdict.Failures)
+	}
+}
@@ -0,0 +1,135 @@
+package overlaytest
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// meshReport probes all pairs of n nodes, fails reports whether a pair fails
+func meshReport(n int, fails func(source, target int) bool) *Report {
+	report := &Report{}
+	for source := 1; source <= n; source++ {
+		report.Nodes = append(report.Nodes, NodeInfo{Name: fmt.Sprintf("node-%d", source)})
+		for target := 1; target <= n; target++ {
+			report.Results = append(report.Results, ProbeResult{
+				SourceNode: fmt.Sprintf("node-%d", source),
+				TargetNode: fmt.Sprintf("node-%d", target),
+				Reachable:  !fails(source, target),
+			})
+		}
+	}
+	return report
+}
+
+func TestDiagnose(t *testing.T) {
+	tests := []struct {
+		name     string
+		nodes    int
+		fails    func(source, target int) bool
+		expected []string
+	}{
+		{
+			name:     "All reachable",
+			nodes:    4,
+			fails:    func(source, target int) bool { return false },
+			expected: nil,
+		},
+		{
+			name:     "Cannot receive",
+			nodes:    5,
+			fails:    func(source, target int) bool { return target == 3 && source != 3 },
+			expected: []string{"cannot-receive [node-3]: node-3 cannot receive traffic (reached by 0 of 4 nodes)"},
+		},
+		{
+			name:     "Cannot send",
+			nodes:    4,
+			fails:    func(source, target int) bool { return source == 2 && target != 2 },
+			expected: []string{"cannot-send [node-2]: node-2 cannot send traffic (reaches 0 of 3 nodes)"},
+		},
+		{
+			name:     "Isolated",
+			nodes:    4,
+			fails:    func(source, target int) bool { return (source == 4) != (target == 4) },
+			expected: []string{"isolated [node-4]: node-4 is isolated, it can neither send nor receive traffic"},
+		},
+		{
+			name:  "Partition",
+			nodes: 4,
+			fails: func(source, target int) bool { return (source <= 2) != (target <= 2) },
+			expected: []string{
+				"partition []: network is partitioned, the groups [node-1 node-2], [node-3 node-4] cannot reach each other",
+			},
+		},
+		{
+			name:  "Broken node and asymmetric pair",
+			nodes: 4,
+			fails: func(source, target int) bool {
+				return target == 4 && source != 4 || source == 1 && target == 2
+			},
+			expected: []string{
+				"cannot-receive [node-4]: node-4 cannot receive traffic (reached by 0 of 3 nodes)",
+				"asymmetric [node-1 node-2]: node-1 cannot reach node-2, but node-2 reaches node-1",
+			},
+		},
+		{
+			name:  "Pair failing both ways and self probe",
+			nodes: 3,
+			fails: func(source, target int) bool {
+				return source == 1 && target == 2 || source == 2 && target == 1 || source == 3 && target == 3
+			},
+			expected: []string{
+				"pair [node-1 node-2]: node-1 and node-2 cannot reach each other",
+				"pair [node-3 node-3]: node-3 cannot reach its own pod",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report := meshReport(tt.nodes, tt.fails)
+			diagnosis := Diagnose(report)
+
+			var verdicts []string
+			explained := 0
+			for _, verdict := range diagnosis.Verdicts {
+				verdicts = append(verdicts, fmt.Sprintf("%s %v: %s", verdict.Kind, verdict.Nodes, verdict.Message))
+				explained += verdict.Failures
+			}
+			if !reflect.DeepEqual(verdicts, tt.expected) {
+				t.Errorf("Expected verdicts %q, got %q", tt.expected, verdicts)
+			}
+			if diagnosis.Failures != len(report.Failures()) || explained != diagnosis.Failures {
+				t.Errorf("Expected all %d failures to be explained, got %d of %d", len(report.Failures()), explained, diagnosis.Failures)
+			}
+		})
+	}
+}
+
+func TestDiagnoseTwoNodes(t *testing.T) {
+	// With a single peer a failure can not be attributed to one node
+	diagnosis := Diagnose(meshReport(2, func(source, target int) bool { return source == 1 && target == 2 }))
+	if len(diagnosis.Verdicts) != 1 || diagnosis.Verdicts[0].Kind != VerdictAsymmetric {
+		t.Errorf("Expected an asymmetric pair verdict, got %+v", diagnosis.Verdicts)
+	}
+}
+
+func TestPrintDiagnosis(t *testing.T) {
+	var buf bytes.Buffer
+	PrintDiagnosis(&buf, Diagnose(meshReport(3, func(source, target int) bool { return false })))
+	if buf.Len() != 0 {
+		t.Errorf("Expected no output without failures, got:\n%s", buf.String())
+	}
+
+	PrintDiagnosis(&buf, Diagnose(meshReport(5, func(source, target int) bool { return target == 3 && source != 3 })))
+	output := buf.String()
+	for _, expected := range []string{
+		"Diagnosis of 4 failed probes:",
+		"node-3 cannot receive traffic (reached by 0 of 4 nodes), explains 4 failed probes",
+	} {
+		if !strings.Contains(output, expected) {
+			t.Errorf("Expected output to contain %q, got:\n%s", expected, output)
+		}
+	}
+}
@@ -0,0 +1,239 @@
+package overlaytest
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	core "k8s.io/api/core/v1"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/yaml"
+)
+
+// diagnosticsLogLines limits the CNI agent logs per container
+const diagnosticsLogLines = 500
+
+// diagnosticsCommands are run in the test pods on nodes with failed probes
+var diagnosticsCommands = [][]string{
+	{"ip", "addr"},
+	{"ip", "route"},
+}
+
+// DiagnosticsBundleName returns the file name of the diagnostics bundle of a report
+func DiagnosticsBundleName(report *Report) string {
+	return "overlaytest-diagnostics-" + report.StartTime.UTC().Format(historyTimeFormat) + ".tar.gz"
+}
+
+// DiagnosticsCollector gathers the state of the test and the nodes with failed probes
+type DiagnosticsCollector struct {
+	Clientset kubernetes.Interface
+	Namespace string
+	AppName   string
+	// Exec runs a command in a test pod
+	Exec func(ctx context.Context, pod string, cmd []string) (string, error)
+}
+
+// NewDiagnosticsCollector creates a collector running commands with ExecInPod
+func NewDiagnosticsCollector(clientset kubernetes.Interface, restConfig *rest.Config, config *Config) *DiagnosticsCollector {
+	return &DiagnosticsCollector{
+		Clientset: clientset,
+		Namespace: config.Namespace,
+		AppName:   config.AppName,
+		Exec: func(ctx context.Context, pod string, cmd []string) (string, error) {
+			return ExecInPod(ctx, clientset, restConfig, config.Namespace, pod, cmd)
+		},
+	}
+}
+
+// WriteBundle writes a gzipped tarball with the report, the DaemonSet and its pods, their events,
+// the conditions of the affected nodes, the CNI agent logs and the addresses and routes of the
+// test pods on the affected nodes. Data which can not be collected is listed in errors.txt.
+func (c *DiagnosticsCollector) WriteBundle(ctx context.Context, w io.Writer, report *Report) error {
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	bundle := &diagnosticsBundle{tar: tw, modTime: time.Now()}
+
+	if data, err := json.MarshalIndent(report, "", "  "); err == nil {
+		bundle.add("report.json", data)
+	}
+	c.collectWorkload(ctx, bundle)
+
+	for _, node := range FailingNodes(report) {
+		c.collectNode(ctx, bundle, node)
+		if info, ok := report.Node(node); ok && info.PodName != "" {
+			c.collectNetwork(ctx, bundle, node, info.PodName)
+		}
+	}
+	for _, agent := range report.CNIAgents {
+		if agent.Pod != "" && report.Metadata.CNI != nil {
+			c.collectLogs(ctx, bundle, report.Metadata.CNI.Namespace, agent.Node, agent.Pod)
+		}
+	}
+
+	if len(bundle.errors) > 0 {
+		bundle.add("errors.txt", []byte(strings.Join(bundle.errors, "\n")+"\n"))
+	}
+	if bundle.err != nil {
+		return fmt.Errorf("error writing diagnostics bundle: %w", bundle.err)
+	}
+	if err := tw.Close(); err != nil {
+		return fmt.Errorf("error writing diagnostics bundle: %w", err)
+	}
+	return gz.Close()
+}
+
+// collectWorkload adds the DaemonSet, its pods and their events
+func (c *DiagnosticsCollector) collectWorkload(ctx context.Context, bundle *diagnosticsBundle) {
+	involved := map[string]bool{c.AppName: true}
+
+	if daemonset, err := c.Clientset.AppsV1().DaemonSets(c.Namespace).Get(ctx, c.AppName, meta.GetOptions{}); err != nil {
+		bundle.failed("daemonset", err)
+	} else {
+		daemonset.ManagedFields = nil
+		daemonset.APIVersion, daemonset.Kind = "apps/v1", "DaemonSet"
+		bundle.addYAML("daemonset.yaml", daemonset)
+	}
+
+	if pods, err := c.Clientset.CoreV1().Pods(c.Namespace).List(ctx, meta.ListOptions{LabelSelector: "app=" + c.AppName}); err != nil {
+		bundle.failed("pods", err)
+	} else {
+		pods.APIVersion, pods.Kind = "v1", "PodList"
+		for i := range pods.Items {
+			pods.Items[i].ManagedFields = nil
+			involved[pods.Items[i].Name] = true
+		}
+		bundle.addYAML("pods.yaml", pods)
+	}
+
+	events, err := c.Clientset.CoreV1().Events(c.Namespace).List(ctx, meta.ListOptions{})
+	if err != nil {
+		bundle.failed("events", err)
+		return
+	}
+	var buf strings.Builder
+	tw := tabwriter.NewWriter(&buf, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "LAST SEEN\tTYPE\tREASON\tOBJECT\tCOUNT\tMESSAGE\n")
+	for _, event := range events.Items {
+		if !involved[event.InvolvedObject.Name] {
+			continue
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s/%s\t%d\t%s\n", eventTime(&event).UTC().Format(time.RFC3339), event.Type, event.Reason,
+			strings.ToLower(event.InvolvedObject.Kind), event.InvolvedObject.Name, event.Count, strings.TrimSpace(event.Message))
+	}
+	tw.Flush()
+	bundle.add("events.txt", []byte(buf.String()))
+}
+
+func eventTime(event *core.Event) time.Time {
+	switch {
+	case !event.LastTimestamp.IsZero():
+		return event.LastTimestamp.Time
+	case !event.EventTime.IsZero():
+		return event.EventTime.Time
+	}
+	return event.CreationTimestamp.Time
+}
+
+// collectNode adds the conditions, addresses and taints of a node
+func (c *DiagnosticsCollector) collectNode(ctx context.Context, bundle *diagnosticsBundle, name string) {
+	node, err := c.Clientset.CoreV1().Nodes().Get(ctx, name, meta.GetOptions{})
+	if err != nil {
+		bundle.failed("node "+name, err)
+		return
+	}
+
+	var buf strings.Builder
+	tw := tabwriter.NewWriter(&buf, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "CONDITION\tSTATUS\tLAST TRANSITION\tREASON\tMESSAGE\n")
+	for _, condition := range node.Status.Conditions {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", condition.Type, condition.Status,
+			condition.LastTransitionTime.UTC().Format(time.RFC3339), condition.Reason, condition.Message)
+	}
+	tw.Flush()
+	fmt.Fprintf(&buf, "\nAddresses:\n")
+	for _, address := range node.Status.Addresses {
+		fmt.Fprintf(&buf, "  %s: %s\n", address.Type, address.Address)
+	}
+	if len(node.Spec.Taints) > 0 {
+		fmt.Fprintf(&buf, "\nTaints:\n")
+		for _, taint := range node.Spec.Taints {
+			fmt.Fprintf(&buf, "  %s\n", taint.ToString())
+		}
+	}
+	if node.Spec.Unschedulable {
+		fmt.Fprintf(&buf, "\nUnschedulable: true\n")
+	}
+	bundle.add("nodes/"+name+".txt", []byte(buf.String()))
+}
+
+// collectNetwork adds the output of the diagnostics commands in the test pod of a node
+func (c *DiagnosticsCollector) collectNetwork(ctx context.Context, bundle *diagnosticsBundle, node, pod string) {
+	var buf strings.Builder
+	for _, cmd := range diagnosticsCommands {
+		fmt.Fprintf(&buf, "$ %s\n", strings.Join(cmd, " "))
+		output, err := c.Exec(ctx, pod, cmd)
+		buf.WriteString(output)
+		if err != nil {
+			fmt.Fprintf(&buf, "error: %v\n", err)
+		}
+		buf.WriteString("\n")
+	}
+	bundle.add("network/"+node+".txt", []byte(buf.String()))
+}
+
+// collectLogs adds the last log lines of all containers of a CNI agent pod
+func (c *DiagnosticsCollector) collectLogs(ctx context.Context, bundle *diagnosticsBundle, namespace, node, name string) {
+	pod, err := c.Clientset.CoreV1().Pods(namespace).Get(ctx, name, meta.GetOptions{})
+	if err != nil {
+		bundle.failed("CNI pod "+name, err)
+		return
+	}
+	lines := int64(diagnosticsLogLines)
+	for _, container := range pod.Spec.Containers {
+		data, err := c.Clientset.CoreV1().Pods(namespace).GetLogs(name, &core.PodLogOptions{Container: container.Name, TailLines: &lines}).DoRaw(ctx)
+		if err != nil {
+			bundle.failed(fmt.Sprintf("logs of %s/%s", name, container.Name), err)
+			continue
+		}
+		bundle.add(fmt.Sprintf("cni/%s/%s-%s.log", node, name, container.Name), data)
+	}
+}
+
+// diagnosticsBundle writes files to the tarball and keeps the first write error
+type diagnosticsBundle struct {
+	tar     *tar.Writer
+	modTime time.Time
+	errors  []string
+	err     error
+}
+
+func (b *diagnosticsBundle) add(name string, data []byte) {
+	if b.err != nil {
+		return
+	}
+	header := &tar.Header{Name: name, Mode: 0o644, Size: int64(len(data)), ModTime: b.modTime}
+	if b.err = b.tar.WriteHeader(header); b.err == nil {
+		_, b.err = b.tar.Write(data)
+	}
+}
+
+func (b *diagnosticsBundle) addYAML(name string, object any) {
+	data, err := yaml.Marshal(object)
+	if err != nil {
+		b.failed(name, err)
+		return
+	}
+	b.add(name, data)
+}
+
+func (b *diagnosticsBundle) failed(what string, err error) {
+	b.errors = append(b.errors, fmt.Sprintf("%s: %v", what, err))
+}
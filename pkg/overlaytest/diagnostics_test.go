@@ -0,0 +1,132 @@
+package overlaytest
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	core "k8s.io/api/core/v1"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// readBundle returns the files of a gzipped tarball
+func readBundle(t *testing.T, data []byte) map[string]string {
+	t.Helper()
+	gz, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Expected a gzip stream: %v", err)
+	}
+	files := map[string]string{}
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return files
+		}
+		if err != nil {
+			t.Fatalf("Expected a tar archive: %v", err)
+		}
+		content, _ := io.ReadAll(tr)
+		files[header.Name] = string(content)
+	}
+}
+
+func TestDiagnosticsWriteBundle(t *testing.T) {
+	config := DefaultConfig()
+	daemonset := CreateDaemonSetSpec(config.Namespace, config.AppName, config.Image)
+	daemonset.Namespace = config.Namespace
+	testPod := &core.Pod{ObjectMeta: meta.ObjectMeta{Name: "overlaytest-b", Namespace: config.Namespace, Labels: map[string]string{"app": config.AppName}}}
+	otherEvent := &core.Event{
+		ObjectMeta:     meta.ObjectMeta{Name: "coredns.1", Namespace: config.Namespace},
+		InvolvedObject: core.ObjectReference{Kind: "Pod", Name: "coredns"},
+		Reason:         "Unrelated",
+	}
+	podEvent := &core.Event{
+		ObjectMeta:     meta.ObjectMeta{Name: "overlaytest-b.1", Namespace: config.Namespace},
+		InvolvedObject: core.ObjectReference{Kind: "Pod", Name: "overlaytest-b"},
+		Type:           core.EventTypeWarning,
+		Reason:         "BackOff",
+		Message:        "Back-off restarting failed container",
+		Count:          3,
+		LastTimestamp:  meta.NewTime(time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)),
+	}
+	node := &core.Node{
+		ObjectMeta: meta.ObjectMeta{Name: "node-2"},
+		Spec:       core.NodeSpec{Taints: []core.Taint{{Key: "node.kubernetes.io/network-unavailable", Effect: core.TaintEffectNoSchedule}}},
+		Status: core.NodeStatus{
+			Conditions: []core.NodeCondition{{Type: core.NodeNetworkUnavailable, Status: core.ConditionTrue, Reason: "NoRouteCreated"}},
+			Addresses:  []core.NodeAddress{{Type: core.NodeInternalIP, Address: "192.168.0.2"}},
+		},
+	}
+	cniPod := &core.Pod{
+		ObjectMeta: meta.ObjectMeta{Name: "calico-node-b", Namespace: "kube-system"},
+		Spec:       core.PodSpec{NodeName: "node-2", Containers: []core.Container{{Name: "calico-node"}}},
+	}
+	clientset := fake.NewSimpleClientset(daemonset, testPod, otherEvent, podEvent, node, cniPod)
+
+	collector := &DiagnosticsCollector{
+		Clientset: clientset,
+		Namespace: config.Namespace,
+		AppName:   config.AppName,
+		Exec: func(ctx context.Context, pod string, cmd []string) (string, error) {
+			if cmd[1] == "route" {
+				return "", errors.New("command terminated with exit code 127")
+			}
+			return "1: lo: <LOOPBACK,UP,LOWER_UP>\n", nil
+		},
+	}
+
+	report := testReport()
+	report.Metadata.CNI = &CNIInfo{Name: "calico", Namespace: "kube-system"}
+	report.CNIAgents = []CNIAgentStatus{{Node: "node-2", Pod: "calico-node-b"}}
+
+	var buf bytes.Buffer
+	if err := collector.WriteBundle(context.Background(), &buf, report); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	files := readBundle(t, buf.Bytes())
+
+	expected := map[string][]string{
+		"report.json":        {`"sourceNode": "node-1"`},
+		"daemonset.yaml":     {"kind: DaemonSet", "name: overlaytest"},
+		"pods.yaml":          {"name: overlaytest-b"},
+		"events.txt":         {"2026-01-02T03:04:05Z", "Warning", "BackOff", "pod/overlaytest-b", "Back-off restarting failed container"},
+		"nodes/node-2.txt":   {"NetworkUnavailable", "NoRouteCreated", "InternalIP: 192.168.0.2", "node.kubernetes.io/network-unavailable:NoSchedule"},
+		"network/node-2.txt": {"$ ip addr\n1: lo:", "$ ip route\nerror: command terminated with exit code 127"},
+		"cni/node-2/calico-node-b-calico-node.log": {"fake logs"},
+		// node-1 is not in the cluster
+		"errors.txt": {"node node-1:"},
+	}
+	for name, contents := range expected {
+		content, ok := files[name]
+		if !ok {
+			t.Errorf("Expected %s in the bundle, got %d files", name, len(files))
+			continue
+		}
+		for _, expected := range contents {
+			if !strings.Contains(content, expected) {
+				t.Errorf("Expected %s to contain %q, got:\n%s", name, expected, content)
+			}
+		}
+	}
+	if strings.Contains(files["events.txt"], "Unrelated") {
+		t.Errorf("Expected only events of the test pods, got:\n%s", files["events.txt"])
+	}
+	if _, ok := files["network/node-1.txt"]; !ok {
+		t.Errorf("Expected network diagnostics of node-1")
+	}
+}
+
+func TestDiagnosticsBundleName(t *testing.T) {
+	report := &Report{StartTime: time.Date(2026, 1, 2, 3, 4, 5, 0, time.FixedZone("CET", 3600))}
+	if name := DiagnosticsBundleName(report); name != "overlaytest-diagnostics-20260102T020405Z.tar.gz" {
+		t.Errorf("Expected UTC timestamp in the name, got %s", name)
+	}
+}
@@ -0,0 +1,156 @@
+package overlaytest
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"time"
+)
+
+// DiffOptions are the thresholds for latency regressions, a regression must exceed both
+type DiffOptions struct {
+	// MinLatencyIncrease is the minimum absolute RTT increase of a pair
+	MinLatencyIncrease time.Duration
+	// LatencyIncreasePercent is the minimum RTT increase of a pair relative to the first report
+	LatencyIncreasePercent int
+}
+
+// DefaultDiffOptions ignore RTT changes below 1ms or 50%
+func DefaultDiffOptions() DiffOptions {
+	return DiffOptions{MinLatencyIncrease: time.Millisecond, LatencyIncreasePercent: 50}
+}
+
+// LatencyChange is a node pair whose RTT increased beyond the thresholds
+type LatencyChange struct {
+	SourceNode string        `json:"sourceNode"`
+	TargetNode string        `json:"targetNode"`
+	Before     time.Duration `json:"before"`
+	After      time.Duration `json:"after"`
+}
+
+// ReportDiff are the changes between two reports of the same cluster
+type ReportDiff struct {
+	// NewFailures failed in the second report but were reachable or not tested in the first
+	NewFailures []ProbeResult `json:"newFailures,omitempty"`
+	// Recovered failed in the first report and are reachable in the second
+	Recovered          []ProbeResult   `json:"recovered,omitempty"`
+	StillFailing       []ProbeResult   `json:"stillFailing,omitempty"`
+	LatencyRegressions []LatencyChange `json:"latencyRegressions,omitempty"`
+	NodesAdded         []string        `json:"nodesAdded,omitempty"`
+	NodesRemoved       []string        `json:"nodesRemoved,omitempty"`
+}
+
+// Regressions returns the number of new failures and latency regressions
+func (d *ReportDiff) Regressions() int {
+	return len(d.NewFailures) + len(d.LatencyRegressions)
+}
+
+// DiffReports compares two reports, e.g. before and after a CNI upgrade
+func DiffReports(before, after *Report, options DiffOptions) *ReportDiff {
+	diff := &ReportDiff{}
+
+	beforeResults := resultsByPair(before)
+	for _, result := range after.Results {
+		previous, found := beforeResults[[2]string{result.SourceNode, result.TargetNode}]
+		switch {
+		case !result.Reachable && (!found || previous.Reachable):
+			diff.NewFailures = append(diff.NewFailures, result)
+		case !result.Reachable:
+			diff.StillFailing = append(diff.StillFailing, result)
+		case found && !previous.Reachable:
+			diff.Recovered = append(diff.Recovered, result)
+		case found && isLatencyRegression(previous.RTT, result.RTT, options):
+			diff.LatencyRegressions = append(diff.LatencyRegressions, LatencyChange{
+				SourceNode: result.SourceNode,
+				TargetNode: result.TargetNode,
+				Before:     previous.RTT,
+				After:      result.RTT,
+			})
+		}
+	}
+
+	beforeNodes, afterNodes := reportNodes(before), reportNodes(after)
+	for _, node := range sortedKeys(afterNodes) {
+		if !beforeNodes[node] {
+			diff.NodesAdded = append(diff.NodesAdded, node)
+		}
+	}
+	for _, node := range sortedKeys(beforeNodes) {
+		if !afterNodes[node] {
+			diff.NodesRemoved = append(diff.NodesRemoved, node)
+		}
+	}
+
+	sortResults(diff.NewFailures)
+	sortResults(diff.Recovered)
+	sortResults(diff.StillFailing)
+	sort.Slice(diff.LatencyRegressions, func(i, j int) bool {
+		a, b := diff.LatencyRegressions[i], diff.LatencyRegressions[j]
+		return a.SourceNode < b.SourceNode || a.SourceNode == b.SourceNode && a.TargetNode < b.TargetNode
+	})
+	return diff
+}
+
+func isLatencyRegression(before, after time.Duration, options DiffOptions) bool {
+	if before <= 0 || after <= 0 {
+		return false
+	}
+	increase := after - before
+	return increase >= options.MinLatencyIncrease && increase*100 >= before*time.Duration(options.LatencyIncreasePercent)
+}
+
+func resultsByPair(report *Report) map[[2]string]ProbeResult {
+	results := make(map[[2]string]ProbeResult, len(report.Results))
+	for _, result := range report.Results {
+		results[[2]string{result.SourceNode, result.TargetNode}] = result
+	}
+	return results
+}
+
+// reportNodes returns the names of all tested nodes of a report
+func reportNodes(report *Report) map[string]bool {
+	nodes := map[string]bool{}
+	for _, node := range report.Nodes {
+		nodes[node.Name] = true
+	}
+	for _, result := range report.Results {
+		nodes[result.SourceNode] = true
+		nodes[result.TargetNode] = true
+	}
+	return nodes
+}
+
+func sortResults(results []ProbeResult) {
+	sort.Slice(results, func(i, j int) bool {
+		a, b := results[i], results[j]
+		return a.SourceNode < b.SourceNode || a.SourceNode == b.SourceNode && a.TargetNode < b.TargetNode
+	})
+}
+
+// PrintDiff writes the changes between two reports
+func PrintDiff(w io.Writer, diff *ReportDiff) {
+	for _, node := range diff.NodesAdded {
+		fmt.Fprintf(w, "+ node %s added\n", node)
+	}
+	for _, node := range diff.NodesRemoved {
+		fmt.Fprintf(w, "- node %s removed\n", node)
+	}
+	for _, result := range diff.NewFailures {
+		fmt.Fprintf(w, "! %s can NOT reach %s anymore", result.SourceNode, result.TargetNode)
+		if result.ErrorClass != "" {
+			fmt.Fprintf(w, " (%s)", result.ErrorClass)
+		}
+		fmt.Fprintln(w)
+	}
+	for _, change := range diff.LatencyRegressions {
+		fmt.Fprintf(w, "! %s to %s RTT increased from %s to %s\n", change.SourceNode, change.TargetNode, change.Before, change.After)
+	}
+	for _, result := range diff.Recovered {
+		fmt.Fprintf(w, "✓ %s can reach %s again\n", result.SourceNode, result.TargetNode)
+	}
+	for _, result := range diff.StillFailing {
+		fmt.Fprintf(w, "  %s can still NOT reach %s\n", result.SourceNode, result.TargetNode)
+	}
+	fmt.Fprintf(w, "%d new failures, %d latency regressions, %d recovered, %d still failing\n",
+		len(diff.NewFailures), len(diff.LatencyRegressions), len(diff.Recovered), len(diff.StillFailing))
+}
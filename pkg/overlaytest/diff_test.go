@@ -0,0 +1,111 @@
+package overlaytest
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDiffReports(t *testing.T) {
+	before := &Report{Results: []ProbeResult{
+		{SourceNode: "node-1", TargetNode: "node-2", Reachable: true, RTT: time.Millisecond},
+		{SourceNode: "node-1", TargetNode: "node-3", Reachable: false},
+		{SourceNode: "node-2", TargetNode: "node-1", Reachable: true, RTT: 2 * time.Millisecond},
+		{SourceNode: "node-2", TargetNode: "node-3", Reachable: false},
+		{SourceNode: "node-3", TargetNode: "node-1", Reachable: true, RTT: time.Millisecond},
+	}}
+	after := &Report{Results: []ProbeResult{
+		{SourceNode: "node-1", TargetNode: "node-2", Reachable: false, ErrorClass: ErrorClassUnreachable},
+		{SourceNode: "node-1", TargetNode: "node-3", Reachable: true, RTT: time.Millisecond},
+		{SourceNode: "node-2", TargetNode: "node-1", Reachable: true, RTT: 5 * time.Millisecond},
+		{SourceNode: "node-2", TargetNode: "node-3", Reachable: false},
+		{SourceNode: "node-1", TargetNode: "node-4", Reachable: false},
+	}}
+	// node-3 is still a target in the second report, so only node-4 is new and no node was removed
+	after.Results = append(after.Results, ProbeResult{SourceNode: "node-4", TargetNode: "node-1", Reachable: true})
+
+	diff := DiffReports(before, after, DefaultDiffOptions())
+
+	if len(diff.NewFailures) != 2 || diff.NewFailures[0].TargetNode != "node-2" || diff.NewFailures[1].TargetNode != "node-4" {
+		t.Errorf("Expected new failures node-1→node-2 and node-1→node-4, got %+v", diff.NewFailures)
+	}
+	if len(diff.Recovered) != 1 || diff.Recovered[0].TargetNode != "node-3" {
+		t.Errorf("Expected node-1→node-3 recovered, got %+v", diff.Recovered)
+	}
+	if len(diff.StillFailing) != 1 || diff.StillFailing[0].SourceNode != "node-2" {
+		t.Errorf("Expected node-2→node-3 still failing, got %+v", diff.StillFailing)
+	}
+	if len(diff.LatencyRegressions) != 1 || diff.LatencyRegressions[0].After != 5*time.Millisecond {
+		t.Errorf("Expected latency regression node-2→node-1, got %+v", diff.LatencyRegressions)
+	}
+	if len(diff.NodesAdded) != 1 || diff.NodesAdded[0] != "node-4" {
+		t.Errorf("Expected node-4 added, got %v", diff.NodesAdded)
+	}
+	if len(diff.NodesRemoved) != 0 {
+		t.Errorf("Expected no removed nodes, got %v", diff.NodesRemoved)
+	}
+	if diff.Regressions() != 3 {
+		t.Errorf("Expected 3 regressions, got %d", diff.Regressions())
+	}
+}
+
+func TestDiffReportsNodesRemoved(t *testing.T) {
+	before := testReport()
+	after := &Report{Nodes: before.Nodes[:1], Results: before.Results[:1]}
+
+	diff := DiffReports(before, after, DefaultDiffOptions())
+	if len(diff.NodesRemoved) != 1 || diff.NodesRemoved[0] != "node-2" {
+		t.Errorf("Expected node-2 removed, got %v", diff.NodesRemoved)
+	}
+	if diff.Regressions() != 0 {
+		t.Errorf("Expected no regressions, got %d", diff.Regressions())
+	}
+}
+
+func TestIsLatencyRegression(t *testing.T) {
+	options := DefaultDiffOptions()
+	tests := []struct {
+		name     string
+		before   time.Duration
+		after    time.Duration
+		expected bool
+	}{
+		{"Large increase", time.Millisecond, 3 * time.Millisecond, true},
+		{"Below absolute threshold", 100 * time.Microsecond, 900 * time.Microsecond, false},
+		{"Below relative threshold", 10 * time.Millisecond, 12 * time.Millisecond, false},
+		{"Faster", 3 * time.Millisecond, time.Millisecond, false},
+		{"No RTT before", 0, 10 * time.Millisecond, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if result := isLatencyRegression(tt.before, tt.after, options); result != tt.expected {
+				t.Errorf("Expected %v, got %v", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestPrintDiff(t *testing.T) {
+	diff := &ReportDiff{
+		NewFailures:        []ProbeResult{{SourceNode: "node-1", TargetNode: "node-2", ErrorClass: ErrorClassUnreachable}},
+		Recovered:          []ProbeResult{{SourceNode: "node-2", TargetNode: "node-1", Reachable: true}},
+		LatencyRegressions: []LatencyChange{{SourceNode: "node-1", TargetNode: "node-3", Before: time.Millisecond, After: 4 * time.Millisecond}},
+		NodesAdded:         []string{"node-3"},
+	}
+
+	var buf bytes.Buffer
+	PrintDiff(&buf, diff)
+	output := buf.String()
+	for _, expected := range []string{
+		"+ node node-3 added",
+		"! node-1 can NOT reach node-2 anymore (unreachable)",
+		"! node-1 to node-3 RTT increased from 1ms to 4ms",
+		"✓ node-2 can reach node-1 again",
+		"1 new failures, 1 latency regressions, 1 recovered, 0 still failing",
+	} {
+		if !strings.Contains(output, expected) {
+			t.Errorf("Expected output to contain %q, got:\n%s", expected, output)
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package overlaytest
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	apps "k8s.io/api/apps/v1"
+	core "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcore "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+// Event reasons
+const (
+	ReasonOverlayUnreachable = "OverlayUnreachable"
+	ReasonOverlayReachable   = "OverlayReachable"
+)
+
+// EventNotifier records Kubernetes Events for the results of a test run
+type EventNotifier struct {
+	broadcaster record.EventBroadcaster
+	recorder    record.EventRecorder
+
+	recorded atomic.Int64
+	written  atomic.Int64
+}
+
+// NewEventNotifier creates an EventNotifier writing Events through the clientset
+func NewEventNotifier(clientset kubernetes.Interface) *EventNotifier {
+	n := &EventNotifier{broadcaster: record.NewBroadcaster()}
+	n.broadcaster.StartRecordingToSink(&countingSink{
+		EventSink: &typedcore.EventSinkImpl{Interface: clientset.CoreV1().Events("")},
+		written:   &n.written,
+	})
+	n.recorder = n.broadcaster.NewRecorder(scheme.Scheme, core.EventSource{Component: "overlaytest"})
+	return n
+}
+
+// NodeReference returns the reference Events of a node are recorded against.
+// Like the kubelet the node name is used as UID, so the Events show up in kubectl describe node.
+func NodeReference(name string) *core.ObjectReference {
+	return &core.ObjectReference{
+		APIVersion: "v1",
+		Kind:       "Node",
+		Name:       name,
+		UID:        types.UID(name),
+	}
+}
+
+// RecordReport emits one Warning Event per node involved in failed probes and
+// a summary Event on the DaemonSet, if given
+func (n *EventNotifier) RecordReport(report *Report, daemonset *apps.DaemonSet) {
+	failures := report.Failures()
+
+	messages := NodeFailureMessages(failures)
+	for _, node := range sortedKeys(messages) {
+		n.event(NodeReference(node), core.EventTypeWarning, ReasonOverlayUnreachable, messages[node])
+	}
+
+	if daemonset == nil {
+		return
+	}
+	if len(failures) > 0 {
+		n.event(daemonset, core.EventTypeWarning, ReasonOverlayUnreachable,
+			fmt.Sprintf("%d of %d overlay probes between %d nodes failed", len(failures), len(report.Results), len(report.Nodes)))
+	} else {
+		n.event(daemonset, core.EventTypeNormal, ReasonOverlayReachable,
+			fmt.Sprintf("all %d overlay probes between %d nodes succeeded", len(report.Results), len(report.Nodes)))
+	}
+}
+
+func (n *EventNotifier) event(object runtime.Object, eventtype, reason, message string) {
+	n.recorded.Add(1)
+	n.recorder.Event(object, eventtype, reason, message)
+}
+
+// Shutdown waits up to timeout for recorded Events to be written and stops the broadcaster
+func (n *EventNotifier) Shutdown(timeout time.Duration) {
+	deadline := time.Now().Add(timeout)
+	for n.written.Load() < n.recorded.Load() && time.Now().Before(deadline) {
+		time.Sleep(100 * time.Millisecond)
+	}
+	n.broadcaster.Shutdown()
+}
+
+// NodeFailureMessages describes the failed probes of every involved node, keyed by node name
+func NodeFailureMessages(failures []ProbeResult) map[string]string {
+	unreachable := map[string][]string{}   // targets a node can not reach
+	unreachableBy := map[string][]string{} // sources which can not reach a node
+	for _, failure := range failures {
+		unreachable[failure.SourceNode] = append(unreachable[failure.SourceNode], failure.TargetNode)
+		unreachableBy[failure.TargetNode] = append(unreachableBy[failure.TargetNode], failure.SourceNode)
+	}
+
+	messages := map[string]string{}
+	for _, node := range append(sortedKeys(unreachable), sortedKeys(unreachableBy)...) {
+		if _, ok := messages[node]; ok {
+			continue
+		}
+		var parts []string
+		if targets := unreachable[node]; len(targets) > 0 {
+			parts = append(parts, "cannot reach "+joinNodes(targets))
+		}
+		if sources := unreachableBy[node]; len(sources) > 0 {
+			parts = append(parts, "unreachable from "+joinNodes(sources))
+		}
+		messages[node] = "overlay network probes failed: " + strings.Join(parts, "; ")
+	}
+	return messages
+}
+
+// maxEventNodes limits the node names listed in an Event message
+const maxEventNodes = 10
+
+func joinNodes(nodes []string) string {
+	if len(nodes) <= maxEventNodes {
+		return strings.Join(nodes, ", ")
+	}
+	return fmt.Sprintf("%s and %d more", strings.Join(nodes[:maxEventNodes], ", "), len(nodes)-maxEventNodes)
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// countingSink counts the Events written successfully to the API server
+type countingSink struct {
+	record.EventSink
+	written *atomic.Int64
+}
+
+func (s *countingSink) Create(event *core.Event) (*core.Event, error) {
+	result, err := s.EventSink.Create(event)
+	if err == nil {
+		s.written.Add(1)
+	}
+	return result, err
+}
+
+func (s *countingSink) Update(event *core.Event) (*core.Event, error) {
+	result, err := s.EventSink.Update(event)
+	if err == nil {
+		s.written.Add(1)
+	}
+	return result, err
+}
+
+func (s *countingSink) Patch(event *core.Event, data []byte) (*core.Event, error) {
+	result, err := s.EventSink.Patch(event, data)
+	if err == nil {
+		s.written.Add(1)
+	}
+	return result, err
+}
@@ -0,0 +1,106 @@
+package overlaytest
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	core "k8s.io/api/core/v1"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestNodeFailureMessages(t *testing.T) {
+	failures := []ProbeResult{
+		{SourceNode: "node-1", TargetNode: "node-3"},
+		{SourceNode: "node-2", TargetNode: "node-3"},
+		{SourceNode: "node-3", TargetNode: "node-1"},
+	}
+
+	messages := NodeFailureMessages(failures)
+
+	if len(messages) != 3 {
+		t.Fatalf("Expected messages for 3 nodes, got %d", len(messages))
+	}
+	expected := "overlay network probes failed: cannot reach node-1; unreachable from node-1, node-2"
+	if messages["node-3"] != expected {
+		t.Errorf("Expected %q, got %q", expected, messages["node-3"])
+	}
+	if messages["node-2"] != "overlay network probes failed: cannot reach node-3" {
+		t.Errorf("Unexpected message for node-2: %q", messages["node-2"])
+	}
+}
+
+func TestJoinNodes(t *testing.T) {
+	var nodes []string
+	for i := 0; i < 12; i++ {
+		nodes = append(nodes, "n")
+	}
+	if result := joinNodes(nodes); !strings.HasSuffix(result, "and 2 more") {
+		t.Errorf("Expected long node lists to be shortened, got %q", result)
+	}
+	if result := joinNodes([]string{"a", "b"}); result != "a, b" {
+		t.Errorf("Expected 'a, b', got %q", result)
+	}
+}
+
+func TestEventNotifierRecordReport(t *testing.T) {
+	ctx := context.Background()
+	clientset := fake.NewSimpleClientset()
+	daemonset := CreateDaemonSetSpec("test-namespace", "overlaytest", "test-image")
+	daemonset.Namespace = "test-namespace"
+
+	notifier := NewEventNotifier(clientset)
+	notifier.RecordReport(testReport(), daemonset)
+	notifier.Shutdown(5 * time.Second)
+
+	nodeEvents, err := clientset.CoreV1().Events(meta.NamespaceDefault).List(ctx, meta.ListOptions{})
+	if err != nil {
+		t.Fatalf("Failed to list events: %v", err)
+	}
+	if len(nodeEvents.Items) != 2 {
+		t.Fatalf("Expected 2 node events, got %d", len(nodeEvents.Items))
+	}
+	for _, event := range nodeEvents.Items {
+		if event.InvolvedObject.Kind != "Node" || string(event.InvolvedObject.UID) != event.InvolvedObject.Name {
+			t.Errorf("Expected node reference with name as UID, got %+v", event.InvolvedObject)
+		}
+		if event.Reason != ReasonOverlayUnreachable || event.Type != core.EventTypeWarning {
+			t.Errorf("Expected Warning %s, got %s %s", ReasonOverlayUnreachable, event.Type, event.Reason)
+		}
+	}
+
+	dsEvents, err := clientset.CoreV1().Events("test-namespace").List(ctx, meta.ListOptions{})
+	if err != nil {
+		t.Fatalf("Failed to list events: %v", err)
+	}
+	if len(dsEvents.Items) != 1 {
+		t.Fatalf("Expected 1 DaemonSet event, got %d", len(dsEvents.Items))
+	}
+	if dsEvents.Items[0].InvolvedObject.Kind != "DaemonSet" || !strings.Contains(dsEvents.Items[0].Message, "1 of 4") {
+		t.Errorf("Unexpected DaemonSet event %+v", dsEvents.Items[0])
+	}
+}
+
+func TestEventNotifierAllReachable(t *testing.T) {
+	ctx := context.Background()
+	clientset := fake.NewSimpleClientset()
+	daemonset := CreateDaemonSetSpec("test-namespace", "overlaytest", "test-image")
+	daemonset.Namespace = "test-namespace"
+
+	report := testReport()
+	report.Results[1].Reachable = true
+
+	notifier := NewEventNotifier(clientset)
+	notifier.RecordReport(report, daemonset)
+	notifier.Shutdown(5 * time.Second)
+
+	events, _ := clientset.CoreV1().Events("").List(ctx, meta.ListOptions{})
+	if len(events.Items) != 1 {
+		t.Fatalf("Expected only the DaemonSet event, got %d", len(events.Items))
+	}
+	if events.Items[0].Reason != ReasonOverlayReachable || events.Items[0].Type != core.EventTypeNormal {
+		t.Errorf("Expected Normal %s, got %s %s", ReasonOverlayReachable, events.Items[0].Type, events.Items[0].Reason)
+	}
+}
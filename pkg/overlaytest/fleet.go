@@ -0,0 +1,156 @@
+package overlaytest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AllContexts selects every context of the kubeconfig
+const AllContexts = "all"
+
+// ClusterResult is the outcome of the test against one kubeconfig context
+type ClusterResult struct {
+	Context string  `json:"context"`
+	Report  *Report `json:"report,omitempty"`
+	// Error is set if the cluster could not be tested
+	Error string `json:"error,omitempty"`
+}
+
+// FleetReport holds the results of a run against multiple clusters
+type FleetReport struct {
+	StartTime time.Time       `json:"startTime"`
+	Duration  time.Duration   `json:"duration"`
+	Clusters  []ClusterResult `json:"clusters"`
+}
+
+// Failed returns the clusters which could not be tested
+func (f *FleetReport) Failed() []ClusterResult {
+	var failed []ClusterResult
+	for _, cluster := range f.Clusters {
+		if cluster.Error != "" {
+			failed = append(failed, cluster)
+		}
+	}
+	return failed
+}
+
+// KubeconfigContexts returns the sorted context names of a kubeconfig file or a merged list of files
+func KubeconfigContexts(kubeconfig string) ([]string, error) {
+	config, err := ClientOptions{Kubeconfig: kubeconfig}.loadingRules().Load()
+	if err != nil {
+		return nil, fmt.Errorf("error loading kubeconfig: %w", err)
+	}
+	contexts := make([]string, 0, len(config.Contexts))
+	for name := range config.Contexts {
+		contexts = append(contexts, name)
+	}
+	sort.Strings(contexts)
+	return contexts, nil
+}
+
+// SelectContexts returns the available contexts matching the patterns in sorted order.
+// A pattern is a context name, a glob like "prod-*" or "all". Names without glob characters
+// must exist, globs may match nothing as long as some context is selected.
+func SelectContexts(available, patterns []string) ([]string, error) {
+	selected := map[string]bool{}
+	for _, pattern := range patterns {
+		pattern = strings.TrimSpace(pattern)
+		switch {
+		case pattern == "":
+		case pattern == AllContexts:
+			for _, name := range available {
+				selected[name] = true
+			}
+		case strings.ContainsAny(pattern, "*?["):
+			if _, err := path.Match(pattern, ""); err != nil {
+				return nil, fmt.Errorf("invalid context pattern %q: %w", pattern, err)
+			}
+			for _, name := range available {
+				if ok, _ := path.Match(pattern, name); ok {
+					selected[name] = true
+				}
+			}
+		default:
+			if !slices.Contains(available, pattern) {
+				return nil, fmt.Errorf("context %q not found in kubeconfig", pattern)
+			}
+			selected[pattern] = true
+		}
+	}
+	if len(selected) == 0 {
+		return nil, fmt.Errorf("no kubeconfig context matches %s", strings.Join(patterns, ","))
+	}
+	return sortedKeys(selected), nil
+}
+
+// RunFleet runs the test against every context with at most parallel runs at once.
+// The results are in the order of the contexts.
+func RunFleet(ctx context.Context, contexts []string, parallel int, run func(ctx context.Context, kubeContext string) (*Report, error)) *FleetReport {
+	fleet := &FleetReport{StartTime: time.Now(), Clusters: make([]ClusterResult, len(contexts))}
+	sem := make(chan struct{}, max(parallel, 1))
+	var wg sync.WaitGroup
+	for i, kubeContext := range contexts {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			result := ClusterResult{Context: kubeContext}
+			report, err := run(ctx, kubeContext)
+			if err != nil {
+				result.Error = err.Error()
+			}
+			result.Report = report
+			fleet.Clusters[i] = result
+		}()
+	}
+	wg.Wait()
+	fleet.Duration = time.Since(fleet.StartTime)
+	return fleet
+}
+
+// WriteFleetJSON writes the fleet report as indented JSON
+func WriteFleetJSON(w io.Writer, fleet *FleetReport) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(fleet)
+}
+
+// PrintFleetSummary writes one line per cluster and the totals of the fleet
+func PrintFleetSummary(w io.Writer, fleet *FleetReport) {
+	fmt.Fprintf(w, "\nFleet summary of %d clusters:\n", len(fleet.Clusters))
+	width := 0
+	for _, cluster := range fleet.Clusters {
+		width = max(width, len(cluster.Context))
+	}
+
+	probes, failures, failedClusters := 0, 0, 0
+	for _, cluster := range fleet.Clusters {
+		switch {
+		case cluster.Error != "":
+			failedClusters++
+			fmt.Fprintf(w, "  ! %-*s  error: %s\n", width, cluster.Context, cluster.Error)
+		case cluster.Report != nil:
+			report := cluster.Report
+			failed := len(report.Failures())
+			probes += len(report.Results)
+			failures += failed
+			marker := " "
+			if failed > 0 {
+				failedClusters++
+				marker = "!"
+			}
+			fmt.Fprintf(w, "  %s %-*s  %d nodes, %d probes, %d failed\n", marker, width, cluster.Context, len(report.Nodes), len(report.Results), failed)
+		}
+	}
+	fmt.Fprintf(w, "%d of %d clusters healthy, %d of %d probes failed, took %s\n",
+		len(fleet.Clusters)-failedClusters, len(fleet.Clusters), failures, probes, fleet.Duration.Round(time.Millisecond))
+}
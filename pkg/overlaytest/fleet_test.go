@@ -0,0 +1,187 @@
+package overlaytest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const fleetKubeconfig = `apiVersion: v1
+kind: Config
+clusters:
+- name: prod-eu
+  cluster:
+    server: https://prod-eu.example.com
+- name: prod-us
+  cluster:
+    server: https://prod-us.example.com
+- name: staging
+  cluster:
+    server: https://staging.example.com
+users:
+- name: admin
+  user:
+    token: secret
+contexts:
+- name: prod-us
+  context: {cluster: prod-us, user: admin}
+- name: prod-eu
+  context: {cluster: prod-eu, user: admin}
+- name: staging
+  context: {cluster: staging, user: admin}
+current-context: staging
+`
+
+func writeFleetKubeconfig(t *testing.T) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "kubeconfig")
+	if err := os.WriteFile(path, []byte(fleetKubeconfig), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestKubeconfigContexts(t *testing.T) {
+	contexts, err := KubeconfigContexts(writeFleetKubeconfig(t))
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if expected := []string{"prod-eu", "prod-us", "staging"}; !reflect.DeepEqual(contexts, expected) {
+		t.Errorf("Expected %v, got %v", expected, contexts)
+	}
+
+	merged, err := KubeconfigContexts(writeFleetKubeconfig(t) + string(filepath.ListSeparator) + filepath.Join(t.TempDir(), "missing"))
+	if err != nil || len(merged) != 3 {
+		t.Errorf("Expected the contexts of a kubeconfig list, got %v, %v", merged, err)
+	}
+
+	if _, err := KubeconfigContexts(filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Error("Expected error for a missing kubeconfig")
+	}
+}
+
+func TestSelectContexts(t *testing.T) {
+	available := []string{"prod-eu", "prod-us", "staging"}
+	tests := []struct {
+		name     string
+		patterns []string
+		expected []string
+		err      string
+	}{
+		{"All", []string{AllContexts}, available, ""},
+		{"Explicit list", []string{"staging", " prod-eu"}, []string{"prod-eu", "staging"}, ""},
+		{"Glob", []string{"prod-*"}, []string{"prod-eu", "prod-us"}, ""},
+		{"Glob and name overlap", []string{"prod-*", "prod-us"}, []string{"prod-eu", "prod-us"}, ""},
+		{"Unknown name", []string{"prod-eu", "dev"}, nil, `context "dev" not found`},
+		{"Glob without match", []string{"dev-*"}, nil, "no kubeconfig context matches dev-*"},
+		{"Invalid glob", []string{"prod-["}, nil, "invalid context pattern"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			contexts, err := SelectContexts(available, tt.patterns)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Errorf("Expected error %q, got %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Expected no error, got: %v", err)
+			}
+			if !reflect.DeepEqual(contexts, tt.expected) {
+				t.Errorf("Expected %v, got %v", tt.expected, contexts)
+			}
+		})
+	}
+}
+
+func TestRunFleet(t *testing.T) {
+	var running, peak atomic.Int32
+	run := func(ctx context.Context, kubeContext string) (*Report, error) {
+		n := running.Add(1)
+		defer running.Add(-1)
+		for {
+			current := peak.Load()
+			if n <= current || peak.CompareAndSwap(current, n) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+		if kubeContext == "broken" {
+			return nil, errors.New("connection refused")
+		}
+		return &Report{Nodes: []NodeInfo{{Name: kubeContext}}}, nil
+	}
+
+	fleet := RunFleet(context.Background(), []string{"a", "broken", "c", "d", "e"}, 2, run)
+	if peak.Load() > 2 {
+		t.Errorf("Expected at most 2 parallel runs, got %d", peak.Load())
+	}
+	if len(fleet.Clusters) != 5 {
+		t.Fatalf("Expected 5 clusters, got %d", len(fleet.Clusters))
+	}
+	for i, name := range []string{"a", "broken", "c", "d", "e"} {
+		if fleet.Clusters[i].Context != name {
+			t.Errorf("Expected cluster %d to be %s, got %s", i, name, fleet.Clusters[i].Context)
+		}
+	}
+	if failed := fleet.Failed(); len(failed) != 1 || failed[0].Error != "connection refused" || failed[0].Report != nil {
+		t.Errorf("Expected only the broken cluster to fail, got %+v", failed)
+	}
+	if fleet.Clusters[2].Report == nil || fleet.Clusters[2].Report.Nodes[0].Name != "c" {
+		t.Errorf("Expected the report of cluster c, got %+v", fleet.Clusters[2])
+	}
+}
+
+func TestPrintFleetSummary(t *testing.T) {
+	fleet := &FleetReport{
+		Duration: 1500 * time.Millisecond,
+		Clusters: []ClusterResult{
+			{Context: "prod-eu", Report: testReport()},
+			{Context: "prod-us", Report: &Report{
+				Nodes:   []NodeInfo{{Name: "node-1"}},
+				Results: []ProbeResult{{SourceNode: "node-1", TargetNode: "node-1", Reachable: true}},
+			}},
+			{Context: "staging", Error: "connection refused"},
+		},
+	}
+
+	var buf bytes.Buffer
+	PrintFleetSummary(&buf, fleet)
+	output := buf.String()
+	for _, expected := range []string{
+		"Fleet summary of 3 clusters",
+		"! prod-eu  2 nodes, 4 probes, 1 failed",
+		"  prod-us  1 nodes, 1 probes, 0 failed",
+		"! staging  error: connection refused",
+		"1 of 3 clusters healthy, 1 of 5 probes failed, took 1.5s",
+	} {
+		if !strings.Contains(output, expected) {
+			t.Errorf("Expected %q in output:\n%s", expected, output)
+		}
+	}
+}
+
+func TestWriteFleetJSON(t *testing.T) {
+	fleet := &FleetReport{Clusters: []ClusterResult{{Context: "prod-eu", Report: testReport()}, {Context: "staging", Error: "timeout"}}}
+
+	var buf bytes.Buffer
+	if err := WriteFleetJSON(&buf, fleet); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	var decoded FleetReport
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil {
+		t.Fatalf("Expected valid JSON, got: %v", err)
+	}
+	if len(decoded.Clusters) != 2 || decoded.Clusters[0].Report == nil || decoded.Clusters[1].Error != "timeout" {
+		t.Errorf("Unexpected fleet report %+v", decoded)
+	}
+}
@@ -0,0 +1,383 @@
+package overlaytest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	core "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// historyTimeFormat names the stored reports, it sorts in time order
+const historyTimeFormat = "20060102T150405Z"
+
+// maxConfigMapHistorySize keeps the history ConfigMap below the 1MiB object size limit
+const maxConfigMapHistorySize = 900 * 1024
+
+// HistoryStore persists the reports of test runs per cluster
+type HistoryStore interface {
+	// Save stores the report of a run
+	Save(ctx context.Context, cluster string, report *Report) error
+	// List returns the stored reports of a cluster, oldest first
+	List(ctx context.Context, cluster string) ([]*Report, error)
+}
+
+// NewHistoryStore returns the history store of the config, nil if no history is kept
+func NewHistoryStore(clientset kubernetes.Interface, config *Config) HistoryStore {
+	switch {
+	case config.HistoryDir != "":
+		return &DirHistoryStore{Dir: config.HistoryDir}
+	case config.HistoryConfigMap:
+		return NewConfigMapHistoryStore(clientset, config.Namespace, config.AppName)
+	}
+	return nil
+}
+
+var clusterNameInvalid = regexp.MustCompile(`[^a-z0-9.-]+`)
+
+// ClusterName derives a file and label friendly cluster name from the API server URL
+func ClusterName(host string) string {
+	if u, err := url.Parse(host); err == nil && u.Host != "" {
+		host = u.Host
+	}
+	name := strings.Trim(clusterNameInvalid.ReplaceAllString(strings.ToLower(host), "-"), "-.")
+	if name == "" {
+		return "default"
+	}
+	return name
+}
+
+func historyKey(report *Report) string {
+	return report.StartTime.UTC().Format(historyTimeFormat) + ".json"
+}
+
+// DirHistoryStore stores every report as JSON file in <Dir>/<cluster>/<timestamp>.json
+type DirHistoryStore struct {
+	Dir string
+}
+
+// Save writes the report into the directory of the cluster
+func (s *DirHistoryStore) Save(ctx context.Context, cluster string, report *Report) error {
+	dir := filepath.Join(s.Dir, cluster)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("error creating history directory: %w", err)
+	}
+	data, err := json.Marshal(report)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(dir, historyKey(report)), data, 0o644); err != nil {
+		return fmt.Errorf("error writing history: %w", err)
+	}
+	return nil
+}
+
+// List reads all reports of the cluster
+func (s *DirHistoryStore) List(ctx context.Context, cluster string) ([]*Report, error) {
+	files, err := filepath.Glob(filepath.Join(s.Dir, cluster, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+
+	reports := make([]*Report, 0, len(files))
+	for _, file := range files {
+		report, err := LoadReport(file)
+		if err != nil {
+			return nil, err
+		}
+		reports = append(reports, report)
+	}
+	return reports, nil
+}
+
+// Clusters returns the clusters with stored reports
+func (s *DirHistoryStore) Clusters() ([]string, error) {
+	entries, err := os.ReadDir(s.Dir)
+	if err != nil {
+		return nil, fmt.Errorf("error reading history directory: %w", err)
+	}
+	var clusters []string
+	for _, entry := range entries {
+		if entry.IsDir() {
+			clusters = append(clusters, entry.Name())
+		}
+	}
+	return clusters, nil
+}
+
+// ConfigMapHistoryStore stores the reports in a ConfigMap of the tested cluster, one key per run.
+// The oldest runs are dropped beyond MaxEntries or when the ConfigMap grows too large.
+type ConfigMapHistoryStore struct {
+	Clientset  kubernetes.Interface
+	Namespace  string
+	Name       string
+	MaxEntries int
+}
+
+// NewConfigMapHistoryStore creates a store keeping the last 20 runs in the ConfigMap <app>-history
+func NewConfigMapHistoryStore(clientset kubernetes.Interface, namespace, app string) *ConfigMapHistoryStore {
+	return &ConfigMapHistoryStore{Clientset: clientset, Namespace: namespace, Name: app + "-history", MaxEntries: 20}
+}
+
+// Save adds the report to the ConfigMap, the cluster is the one the ConfigMap is stored in
+func (s *ConfigMapHistoryStore) Save(ctx context.Context, cluster string, report *Report) error {
+	data, err := json.Marshal(report)
+	if err != nil {
+		return err
+	}
+	configmaps := s.Clientset.CoreV1().ConfigMaps(s.Namespace)
+
+	configmap, err := configmaps.Get(ctx, s.Name, meta.GetOptions{})
+	create := errors.IsNotFound(err)
+	if create {
+		configmap = &core.ConfigMap{ObjectMeta: meta.ObjectMeta{
+			Name:   s.Name,
+			Labels: map[string]string{ManagedByLabel: ManagedByValue},
+		}}
+	} else if err != nil {
+		return fmt.Errorf("error getting history configmap: %w", err)
+	}
+	if configmap.Data == nil {
+		configmap.Data = map[string]string{}
+	}
+	configmap.Data[historyKey(report)] = string(data)
+	s.prune(configmap)
+
+	if create {
+		_, err = configmaps.Create(ctx, configmap, meta.CreateOptions{})
+	} else {
+		_, err = configmaps.Update(ctx, configmap, meta.UpdateOptions{})
+	}
+	if err != nil {
+		return fmt.Errorf("error writing history configmap: %w", err)
+	}
+	return nil
+}
+
+// prune drops the oldest runs beyond the entry and size limits
+func (s *ConfigMapHistoryStore) prune(configmap *core.ConfigMap) {
+	size := 0
+	for _, value := range configmap.Data {
+		size += len(value)
+	}
+	keys := sortedKeys(configmap.Data)
+	for len(keys) > 1 && (s.MaxEntries > 0 && len(keys) > s.MaxEntries || size > maxConfigMapHistorySize) {
+		size -= len(configmap.Data[keys[0]])
+		delete(configmap.Data, keys[0])
+		keys = keys[1:]
+	}
+}
+
+// List reads all reports from the ConfigMap
+func (s *ConfigMapHistoryStore) List(ctx context.Context, cluster string) ([]*Report, error) {
+	configmap, err := s.Clientset.CoreV1().ConfigMaps(s.Namespace).Get(ctx, s.Name, meta.GetOptions{})
+	if errors.IsNotFound(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("error getting history configmap: %w", err)
+	}
+
+	reports := make([]*Report, 0, len(configmap.Data))
+	for _, key := range sortedKeys(configmap.Data) {
+		report := &Report{}
+		if err := json.Unmarshal([]byte(configmap.Data[key]), report); err != nil {
+			return nil, fmt.Errorf("error parsing history entry %s: %w", key, err)
+		}
+		reports = append(reports, report)
+	}
+	return reports, nil
+}
+
+// minFlaps is the number of state changes which make a node pair flaky
+const minFlaps = 2
+
+// An RTT regression is a last RTT of at least twice the average of the earlier runs and 500µs more
+const (
+	rttRegressionFactor = 2
+	minRTTRegression    = 500 * time.Microsecond
+)
+
+// RunTrend is the summary of one stored run
+type RunTrend struct {
+	StartTime      time.Time     `json:"startTime"`
+	Nodes          int           `json:"nodes"`
+	SuccessPercent int           `json:"successPercent"`
+	AvgRTT         time.Duration `json:"avgRTT,omitempty"`
+}
+
+// PairTrend is the history of one node pair
+type PairTrend struct {
+	SourceNode string        `json:"sourceNode"`
+	TargetNode string        `json:"targetNode"`
+	Runs       int           `json:"runs"`
+	Failures   int           `json:"failures"`
+	AvgRTT     time.Duration `json:"avgRTT,omitempty"`
+	FirstRTT   time.Duration `json:"firstRTT,omitempty"`
+	LastRTT    time.Duration `json:"lastRTT,omitempty"`
+	// BaselineRTT is the average RTT before the last run
+	BaselineRTT time.Duration `json:"baselineRTT,omitempty"`
+	// Flaps counts the changes between reachable and unreachable in consecutive runs
+	Flaps int  `json:"flaps"`
+	Flaky bool `json:"flaky"`
+	// RTTRegression is set if the last RTT rose clearly above the baseline
+	RTTRegression bool `json:"rttRegression"`
+}
+
+// SuccessPercent returns the percentage of runs the pair was reachable in
+func (p *PairTrend) SuccessPercent() int {
+	if p.Runs == 0 {
+		return 0
+	}
+	return (p.Runs - p.Failures) * 100 / p.Runs
+}
+
+// HistoryTrends are the success rate and latency trends of stored runs
+type HistoryTrends struct {
+	Runs []RunTrend `json:"runs"`
+	// Pairs lists all node pairs, failing pairs first with flaky ones on top, then RTT regressions
+	Pairs []PairTrend `json:"pairs,omitempty"`
+}
+
+// AnalyzeHistory computes the trends of the reports, which must be sorted oldest first
+func AnalyzeHistory(reports []*Report) *HistoryTrends {
+	trends := &HistoryTrends{}
+	pairs := map[[2]string]*PairTrend{}
+	lastState := map[[2]string]bool{}
+	rttSums := map[[2]string]time.Duration{}
+	rttCounts := map[[2]string]int{}
+
+	for _, report := range reports {
+		run := RunTrend{StartTime: report.StartTime, Nodes: len(reportNodes(report)), SuccessPercent: report.SuccessPercent()}
+		var runRTT time.Duration
+		runRTTCount := 0
+
+		for _, result := range report.Results {
+			key := [2]string{result.SourceNode, result.TargetNode}
+			pair, ok := pairs[key]
+			if !ok {
+				pair = &PairTrend{SourceNode: result.SourceNode, TargetNode: result.TargetNode}
+				pairs[key] = pair
+			}
+			pair.Runs++
+			if !result.Reachable {
+				pair.Failures++
+			}
+			if previous, seen := lastState[key]; seen && previous != result.Reachable {
+				pair.Flaps++
+			}
+			lastState[key] = result.Reachable
+
+			if result.Reachable && result.RTT > 0 {
+				if pair.FirstRTT == 0 {
+					pair.FirstRTT = result.RTT
+				}
+				pair.LastRTT = result.RTT
+				rttSums[key] += result.RTT
+				rttCounts[key]++
+				runRTT += result.RTT
+				runRTTCount++
+			}
+		}
+		if runRTTCount > 0 {
+			run.AvgRTT = runRTT / time.Duration(runRTTCount)
+		}
+		trends.Runs = append(trends.Runs, run)
+	}
+
+	for key, pair := range pairs {
+		if count := rttCounts[key]; count > 0 {
+			pair.AvgRTT = rttSums[key] / time.Duration(count)
+			if count > 1 {
+				pair.BaselineRTT = (rttSums[key] - pair.LastRTT) / time.Duration(count-1)
+				pair.RTTRegression = pair.LastRTT >= rttRegressionFactor*pair.BaselineRTT &&
+					pair.LastRTT-pair.BaselineRTT >= minRTTRegression
+			}
+		}
+		pair.Flaky = pair.Flaps >= minFlaps
+		trends.Pairs = append(trends.Pairs, *pair)
+	}
+	sort.Slice(trends.Pairs, func(i, j int) bool {
+		a, b := trends.Pairs[i], trends.Pairs[j]
+		if (a.Failures > 0) != (b.Failures > 0) {
+			return a.Failures > 0
+		}
+		if a.Flaky != b.Flaky {
+			return a.Flaky
+		}
+		if a.SuccessPercent() != b.SuccessPercent() {
+			return a.SuccessPercent() < b.SuccessPercent()
+		}
+		if a.RTTRegression != b.RTTRegression {
+			return a.RTTRegression
+		}
+		return a.SourceNode < b.SourceNode || a.SourceNode == b.SourceNode && a.TargetNode < b.TargetNode
+	})
+	return trends
+}
+
+// PrintHistory writes the run trends, the failing node pairs and the RTT regressions
+func PrintHistory(w io.Writer, trends *HistoryTrends) {
+	if len(trends.Runs) == 0 {
+		fmt.Fprintln(w, "no stored runs")
+		return
+	}
+
+	fmt.Fprintf(w, "%-20s %5s %8s %10s\n", "RUN", "NODES", "SUCCESS", "AVG RTT")
+	for _, run := range trends.Runs {
+		fmt.Fprintf(w, "%-20s %5d %7d%% %10s\n", run.StartTime.UTC().Format(time.RFC3339), run.Nodes, run.SuccessPercent, formatRTT(run.AvgRTT))
+	}
+
+	var failing, regressions []PairTrend
+	for _, pair := range trends.Pairs {
+		if pair.Failures > 0 {
+			failing = append(failing, pair)
+		}
+		if pair.RTTRegression {
+			regressions = append(regressions, pair)
+		}
+	}
+
+	if len(failing) == 0 {
+		fmt.Fprintf(w, "\nall node pairs were reachable in all %d runs\n", len(trends.Runs))
+	} else {
+		fmt.Fprintf(w, "\nnode pairs with failures:\n")
+	}
+	for _, pair := range failing {
+		fmt.Fprintf(w, "  %s → %s: reachable in %d of %d runs (%d%%)", pair.SourceNode, pair.TargetNode,
+			pair.Runs-pair.Failures, pair.Runs, pair.SuccessPercent())
+		if pair.AvgRTT > 0 {
+			fmt.Fprintf(w, ", RTT %s → %s", formatRTT(pair.FirstRTT), formatRTT(pair.LastRTT))
+		}
+		if pair.Flaky {
+			fmt.Fprintf(w, ", flaky (%d flaps)", pair.Flaps)
+		}
+		fmt.Fprintln(w)
+	}
+
+	if len(regressions) > 0 {
+		fmt.Fprintf(w, "\nnode pairs with RTT regressions:\n")
+	}
+	for _, pair := range regressions {
+		fmt.Fprintf(w, "  %s → %s: RTT %s in the last run, %s on average before\n", pair.SourceNode, pair.TargetNode,
+			formatRTT(pair.LastRTT), formatRTT(pair.BaselineRTT))
+	}
+}
+
+func formatRTT(rtt time.Duration) string {
+	if rtt == 0 {
+		return "-"
+	}
+	return rtt.Round(time.Microsecond).String()
+}
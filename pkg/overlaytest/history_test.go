@@ -0,0 +1,260 @@
+package overlaytest
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func historyReport(start time.Time, reachable bool, rtt time.Duration) *Report {
+	return &Report{
+		StartTime: start,
+		Results: []ProbeResult{
+			{SourceNode: "node-1", TargetNode: "node-2", Reachable: reachable, RTT: rtt},
+			{SourceNode: "node-2", TargetNode: "node-1", Reachable: true, RTT: time.Millisecond},
+		},
+	}
+}
+
+func TestClusterName(t *testing.T) {
+	tests := []struct {
+		host     string
+		expected string
+	}{
+		{"https://api.example.com:6443", "api.example.com-6443"},
+		{"https://10.0.0.1", "10.0.0.1"},
+		{"API.Example.com", "api.example.com"},
+		{"", "default"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.host, func(t *testing.T) {
+			if name := ClusterName(tt.host); name != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, name)
+			}
+		})
+	}
+}
+
+func TestDirHistoryStore(t *testing.T) {
+	ctx := context.Background()
+	store := &DirHistoryStore{Dir: t.TempDir()}
+	start := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	// Saved out of order, listed oldest first
+	for _, offset := range []time.Duration{time.Hour, 0, 2 * time.Hour} {
+		if err := store.Save(ctx, "cluster-a", historyReport(start.Add(offset), true, time.Millisecond)); err != nil {
+			t.Fatalf("Save failed: %v", err)
+		}
+	}
+	if err := store.Save(ctx, "cluster-b", historyReport(start, true, time.Millisecond)); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	reports, err := store.List(ctx, "cluster-a")
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	if len(reports) != 3 {
+		t.Fatalf("Expected 3 reports, got %d", len(reports))
+	}
+	for i, report := range reports {
+		if expected := start.Add(time.Duration(i) * time.Hour); !report.StartTime.Equal(expected) {
+			t.Errorf("Expected report %d to start at %s, got %s", i, expected, report.StartTime)
+		}
+	}
+
+	clusters, err := store.Clusters()
+	if err != nil {
+		t.Fatalf("Clusters failed: %v", err)
+	}
+	if len(clusters) != 2 || clusters[0] != "cluster-a" || clusters[1] != "cluster-b" {
+		t.Errorf("Expected clusters cluster-a and cluster-b, got %v", clusters)
+	}
+}
+
+func TestConfigMapHistoryStore(t *testing.T) {
+	ctx := context.Background()
+	clientset := fake.NewSimpleClientset()
+	store := NewConfigMapHistoryStore(clientset, "overlaytest", "overlaytest")
+	store.MaxEntries = 2
+	start := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	reports, err := store.List(ctx, "")
+	if err != nil || len(reports) != 0 {
+		t.Fatalf("Expected empty history, got %d reports, error %v", len(reports), err)
+	}
+
+	for i := range 3 {
+		if err := store.Save(ctx, "", historyReport(start.Add(time.Duration(i)*time.Minute), true, time.Millisecond)); err != nil {
+			t.Fatalf("Save failed: %v", err)
+		}
+	}
+
+	configmap, err := clientset.CoreV1().ConfigMaps("overlaytest").Get(ctx, "overlaytest-history", meta.GetOptions{})
+	if err != nil {
+		t.Fatalf("Expected history configmap: %v", err)
+	}
+	if configmap.Labels[ManagedByLabel] != ManagedByValue {
+		t.Errorf("Expected configmap to be labeled as managed by overlaytest")
+	}
+
+	reports, err = store.List(ctx, "")
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	if len(reports) != 2 {
+		t.Fatalf("Expected the oldest run to be pruned, got %d reports", len(reports))
+	}
+	if !reports[0].StartTime.Equal(start.Add(time.Minute)) {
+		t.Errorf("Expected the oldest remaining run at %s, got %s", start.Add(time.Minute), reports[0].StartTime)
+	}
+}
+
+func TestConfigMapHistoryStorePruneSize(t *testing.T) {
+	ctx := context.Background()
+	store := NewConfigMapHistoryStore(fake.NewSimpleClientset(), "overlaytest", "overlaytest")
+	start := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	large := historyReport(start, true, time.Millisecond)
+	for i := range 3000 {
+		large.Results = append(large.Results, ProbeResult{SourceNode: fmt.Sprintf("node-%d", i), TargetNode: "node-1", Reachable: true})
+	}
+	for i := range 5 {
+		large.StartTime = start.Add(time.Duration(i) * time.Minute)
+		if err := store.Save(ctx, "", large); err != nil {
+			t.Fatalf("Save failed: %v", err)
+		}
+	}
+
+	reports, err := store.List(ctx, "")
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	if len(reports) == 0 || len(reports) == 5 {
+		t.Errorf("Expected the history to be pruned by size, got %d reports", len(reports))
+	}
+	if last := reports[len(reports)-1]; !last.StartTime.Equal(start.Add(4 * time.Minute)) {
+		t.Errorf("Expected the latest run to be kept, got %s", last.StartTime)
+	}
+}
+
+func TestAnalyzeHistory(t *testing.T) {
+	start := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	reachable := []bool{true, false, true, false, true}
+	var reports []*Report
+	for i, ok := range reachable {
+		reports = append(reports, historyReport(start.Add(time.Duration(i)*time.Hour), ok, time.Duration(i+1)*time.Millisecond))
+	}
+	// A pair which broke once and stayed broken is failing, but not flaky
+	for i, report := range reports {
+		report.Results = append(report.Results, ProbeResult{SourceNode: "node-1", TargetNode: "node-3", Reachable: i < 3, RTT: time.Millisecond})
+	}
+
+	trends := AnalyzeHistory(reports)
+
+	if len(trends.Runs) != 5 {
+		t.Fatalf("Expected 5 runs, got %d", len(trends.Runs))
+	}
+	if trends.Runs[0].SuccessPercent != 100 || trends.Runs[1].SuccessPercent != 66 {
+		t.Errorf("Expected run success of 100%% and 66%%, got %+v", trends.Runs[:2])
+	}
+	if len(trends.Pairs) != 3 {
+		t.Fatalf("Expected all 3 pairs, got %+v", trends.Pairs)
+	}
+
+	flaky := trends.Pairs[0]
+	if flaky.TargetNode != "node-2" || !flaky.Flaky || flaky.Flaps != 4 {
+		t.Errorf("Expected node-1→node-2 flaky with 4 flaps first, got %+v", flaky)
+	}
+	if flaky.Runs != 5 || flaky.Failures != 2 || flaky.SuccessPercent() != 60 {
+		t.Errorf("Expected 3 of 5 runs reachable, got %+v", flaky)
+	}
+	if flaky.FirstRTT != time.Millisecond || flaky.LastRTT != 5*time.Millisecond || flaky.AvgRTT != 3*time.Millisecond {
+		t.Errorf("Expected RTT trend 1ms → 5ms with 3ms average, got %+v", flaky)
+	}
+
+	broken := trends.Pairs[1]
+	if broken.TargetNode != "node-3" || broken.Flaky || broken.Flaps != 1 {
+		t.Errorf("Expected node-1→node-3 failing but not flaky, got %+v", broken)
+	}
+
+	healthy := trends.Pairs[2]
+	if healthy.TargetNode != "node-1" || healthy.Failures != 0 || healthy.AvgRTT != time.Millisecond || healthy.RTTRegression {
+		t.Errorf("Expected node-2→node-1 healthy with 1ms RTT last, got %+v", healthy)
+	}
+}
+
+func TestAnalyzeHistoryRTTRegression(t *testing.T) {
+	start := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	rtts := []time.Duration{time.Millisecond, time.Millisecond, time.Millisecond, 4 * time.Millisecond}
+	var reports []*Report
+	for i, rtt := range rtts {
+		report := historyReport(start.Add(time.Duration(i)*time.Hour), true, time.Millisecond)
+		// Doubling a tiny RTT is jitter, not a regression
+		report.Results[1].RTT = time.Duration(100*(i+1)) * time.Microsecond
+		report.Results = append(report.Results, ProbeResult{SourceNode: "node-1", TargetNode: "node-3", Reachable: true, RTT: rtt})
+		reports = append(reports, report)
+	}
+
+	trends := AnalyzeHistory(reports)
+	if len(trends.Pairs) != 3 {
+		t.Fatalf("Expected all 3 pairs, got %+v", trends.Pairs)
+	}
+	degraded := trends.Pairs[0]
+	if degraded.TargetNode != "node-3" || !degraded.RTTRegression || degraded.Failures != 0 {
+		t.Errorf("Expected node-1→node-3 regression without failures first, got %+v", degraded)
+	}
+	if degraded.BaselineRTT != time.Millisecond || degraded.LastRTT != 4*time.Millisecond {
+		t.Errorf("Expected RTT 4ms after 1ms baseline, got %+v", degraded)
+	}
+	for _, pair := range trends.Pairs[1:] {
+		if pair.RTTRegression {
+			t.Errorf("Expected no regression, got %+v", pair)
+		}
+	}
+
+	var buf bytes.Buffer
+	PrintHistory(&buf, trends)
+	output := buf.String()
+	for _, expected := range []string{
+		"all node pairs were reachable in all 4 runs",
+		"node pairs with RTT regressions:\n  node-1 → node-3: RTT 4ms in the last run, 1ms on average before",
+	} {
+		if !strings.Contains(output, expected) {
+			t.Errorf("Expected output to contain %q, got:\n%s", expected, output)
+		}
+	}
+}
+
+func TestPrintHistory(t *testing.T) {
+	start := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	reports := []*Report{
+		historyReport(start, true, time.Millisecond),
+		historyReport(start.Add(time.Hour), false, 0),
+		historyReport(start.Add(2*time.Hour), true, 2*time.Millisecond),
+	}
+
+	var buf bytes.Buffer
+	PrintHistory(&buf, AnalyzeHistory(reports))
+	output := buf.String()
+	for _, expected := range []string{
+		"2026-01-02T04:04:05Z",
+		"node-1 → node-2: reachable in 2 of 3 runs (66%), RTT 1ms → 2ms, flaky (2 flaps)",
+	} {
+		if !strings.Contains(output, expected) {
+			t.Errorf("Expected output to contain %q, got:\n%s", expected, output)
+		}
+	}
+
+	buf.Reset()
+	PrintHistory(&buf, AnalyzeHistory(reports[:1]))
+	if !strings.Contains(buf.String(), "all node pairs were reachable in all 1 runs") {
+		t.Errorf("Expected all pairs reachable, got:\n%s", buf.String())
+	}
+}
@@ -0,0 +1,145 @@
+package overlaytest
+
+import (
+	_ "embed"
+	"fmt"
+	"html/template"
+	"io"
+	"time"
+)
+
+//go:embed report.html
+var reportTemplateSource string
+
+var reportTemplate = template.Must(template.New("report").Funcs(template.FuncMap{
+	"duration": func(d time.Duration) string { return d.Round(time.Millisecond).String() },
+	"time":     func(t time.Time) string { return t.UTC().Format(time.RFC3339) },
+	"rtt":      formatRTT,
+	"hops":     formatHops,
+	"stop":     TraceStop,
+}).Parse(reportTemplateSource))
+
+// htmlReport is the view of a report rendered by the HTML template
+type htmlReport struct {
+	*Report
+	SuccessPercent int
+	Failures       []ProbeResult
+	Rows           []htmlRow
+	Summaries      []htmlNodeSummary
+	Topology       []TopologySummary
+	Diagnosis      *Diagnosis
+}
+
+type htmlRow struct {
+	Node  string
+	Cells []htmlCell
+	Reach string
+}
+
+type htmlCell struct {
+	Text  string
+	Title string
+	Color template.CSS
+}
+
+type htmlNodeSummary struct {
+	Name     string
+	Zone     string
+	PodIP    string
+	Outgoing string
+	Incoming string
+	AvgRTT   string
+	Failed   bool
+}
+
+// Heatmap colors
+const (
+	heatmapUnreachable = template.CSS("#e5534b")
+	heatmapNoResult    = template.CSS("#eeeeee")
+)
+
+// RenderHTML writes a self-contained HTML page with the connectivity heatmap, node summaries,
+// topology summaries, diagnosis, failed pairs and run metadata of the report
+func RenderHTML(w io.Writer, report *Report) error {
+	m := newMatrix(report)
+	view := htmlReport{
+		Report:         report,
+		SuccessPercent: report.SuccessPercent(),
+		Failures:       report.Failures(),
+		Topology:       TopologySummaries(report, report.Metadata.NodePoolLabel),
+		Diagnosis:      Diagnose(report),
+	}
+
+	var maxRTT time.Duration
+	for _, result := range report.Results {
+		maxRTT = max(maxRTT, result.RTT)
+	}
+
+	for _, source := range m.nodes {
+		row := htmlRow{Node: source}
+		for _, target := range m.nodes {
+			row.Cells = append(row.Cells, heatmapCell(m, source, target, maxRTT))
+		}
+		ok, total := m.outgoing(source)
+		row.Reach = fmt.Sprintf("%d/%d", ok, total)
+		view.Rows = append(view.Rows, row)
+
+		view.Summaries = append(view.Summaries, nodeSummary(m, report, source))
+	}
+
+	return reportTemplate.Execute(w, view)
+}
+
+// heatmapCell colors reachable pairs from green (fastest) to yellow (slowest RTT of the run)
+func heatmapCell(m *matrix, source, target string, maxRTT time.Duration) htmlCell {
+	result, ok := m.results[[2]string{source, target}]
+	switch {
+	case !ok:
+		return htmlCell{Text: MatrixNoResult, Title: fmt.Sprintf("%s → %s: not tested", source, target), Color: heatmapNoResult}
+	case !result.Reachable:
+		title := fmt.Sprintf("%s → %s: unreachable", source, target)
+		if result.ErrorClass != "" {
+			title += " (" + result.ErrorClass + ")"
+		}
+		return htmlCell{Text: MatrixUnreachable, Title: title, Color: heatmapUnreachable}
+	}
+
+	cell := htmlCell{Text: MatrixReachable, Title: fmt.Sprintf("%s → %s: reachable", source, target)}
+	hue := 120
+	if result.RTT > 0 {
+		cell.Text = m.cell(source, target, true)
+		cell.Title += ", RTT " + result.RTT.String()
+		if maxRTT > 0 {
+			hue = 120 - int(60*result.RTT/maxRTT)
+		}
+	}
+	cell.Color = template.CSS(fmt.Sprintf("hsl(%d, 65%%, 70%%)", hue))
+	return cell
+}
+
+func nodeSummary(m *matrix, report *Report, name string) htmlNodeSummary {
+	summary := htmlNodeSummary{Name: name}
+	if info, ok := report.Node(name); ok {
+		summary.Zone = info.Zone
+		summary.PodIP = info.PodIP
+	}
+
+	outOK, outTotal := m.outgoing(name)
+	inOK, inTotal := m.incoming(name)
+	summary.Outgoing = fmt.Sprintf("%d/%d", outOK, outTotal)
+	summary.Incoming = fmt.Sprintf("%d/%d", inOK, inTotal)
+	summary.Failed = outOK < outTotal || inOK < inTotal
+
+	var sum time.Duration
+	count := 0
+	for _, target := range m.nodes {
+		if result, ok := m.results[[2]string{name, target}]; ok && result.Reachable && result.RTT > 0 {
+			sum += result.RTT
+			count++
+		}
+	}
+	if count > 0 {
+		summary.AvgRTT = (sum / time.Duration(count)).Round(time.Microsecond).String()
+	}
+	return summary
+}
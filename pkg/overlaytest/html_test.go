@@ -0,0 +1,72 @@
+package overlaytest
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRenderHTML(t *testing.T) {
+	report := testReport()
+	report.StartTime = time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	report.Duration = 1500 * time.Millisecond
+	report.Metadata = ReportMetadata{Version: "1.2.3", Cluster: "https://api.example.com", KubernetesVersion: "v1.36.0", Mode: ModeBatch}
+	report.Results[0].RTT = time.Millisecond
+	report.Results[1].Error = "command terminated with exit code 1 <script>"
+	report.Uncovered = []UncoveredNode{{Name: "node-3", Reason: UncoveredTaint}}
+	report.Metadata.CNI = &CNIInfo{Name: "calico", Version: "v3.30.1"}
+	report.CNIAgents = []CNIAgentStatus{{Node: "node-2", Pod: "calico-node-b", Message: "calico-node is waiting: CrashLoopBackOff"}}
+	report.Latency = []LatencyStats{{SourceNode: "node-1", TargetNode: "node-2", Sent: 10, Received: 10, P50: time.Millisecond, P99: 3 * time.Millisecond, Violations: []string{"p99 3ms > 2ms"}}}
+
+	var buf bytes.Buffer
+	if err := RenderHTML(&buf, report); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	html := buf.String()
+
+	for _, expected := range []string{
+		"<!DOCTYPE html>",
+		"2026-01-02T03:04:05Z",
+		"1.5s",
+		"75% of 4 probes succeeded, 1 failed",
+		"https://api.example.com",
+		"v1.36.0",
+		"1.2.3",
+		`title="node-1 → node-2: unreachable (unreachable)"`,
+		"background: #e5534b",
+		"background: hsl(60, 65%, 70%)",
+		"node-3</td><td>UntoleratedTaint",
+		"exit code 1 &lt;script&gt;",
+		"<h2>Topology by zone</h2>",
+		`<tr class="failed"><td>zone-a</td><td>zone-b</td>`,
+		"<h2>Diagnosis</h2>",
+		"<dd>calico v3.30.1</dd>",
+		`<tr class="failed"><td>node-2</td><td>calico-node-b</td><td>false</td>`,
+		"node-1 cannot reach node-2, but node-2 reaches node-1, explains 1 failed probes",
+		"<h2>Latency</h2>",
+		"<td>10/10</td><td>p99 3ms &gt; 2ms</td>",
+	} {
+		if !strings.Contains(html, expected) {
+			t.Errorf("Expected HTML to contain %q", expected)
+		}
+	}
+	if strings.Contains(html, "<script>") {
+		t.Error("Expected error messages to be escaped")
+	}
+	if strings.Contains(html, "http://") || strings.Contains(html, "<link") {
+		t.Error("Expected a self-contained page without external resources")
+	}
+}
+
+func TestRenderHTMLAllReachable(t *testing.T) {
+	report := &Report{Results: []ProbeResult{{SourceNode: "node-1", TargetNode: "node-1", Reachable: true}}}
+
+	var buf bytes.Buffer
+	if err := RenderHTML(&buf, report); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if !strings.Contains(buf.String(), "All node pairs are reachable.") {
+		t.Error("Expected all reachable message")
+	}
+}
@@ -0,0 +1,324 @@
+package overlaytest
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+// Latency percentiles checked by SLOs
+const (
+	PercentileP50 = "p50"
+	PercentileP90 = "p90"
+	PercentileP99 = "p99"
+	PercentileMax = "max"
+)
+
+// Latency sampling limits, samples are sent every latencyInterval
+const (
+	maxLatencySamples = 1000
+	latencyInterval   = "0.2"
+	latencyWorkers    = 16
+)
+
+// LatencyBuckets are the upper bounds of the latency histogram, the last bucket is unbounded
+var LatencyBuckets = []time.Duration{
+	100 * time.Microsecond, 250 * time.Microsecond, 500 * time.Microsecond,
+	time.Millisecond, 2500 * time.Microsecond, 5 * time.Millisecond,
+	10 * time.Millisecond, 25 * time.Millisecond, 50 * time.Millisecond,
+	100 * time.Millisecond, 250 * time.Millisecond, 500 * time.Millisecond, time.Second,
+}
+
+// LatencyStats are the latency percentiles of the samples of a node pair
+type LatencyStats struct {
+	SourceNode string        `json:"sourceNode"`
+	TargetNode string        `json:"targetNode"`
+	Sent       int           `json:"sent"`
+	Received   int           `json:"received"`
+	P50        time.Duration `json:"p50,omitempty"`
+	P90        time.Duration `json:"p90,omitempty"`
+	P99        time.Duration `json:"p99,omitempty"`
+	Max        time.Duration `json:"max,omitempty"`
+	// Buckets counts the samples per LatencyBuckets bound, the last entry counts the slower samples
+	Buckets []int `json:"buckets,omitempty"`
+	// Violations lists the SLOs the pair missed, e.g. "p99 7.2ms > 5ms"
+	Violations []string `json:"violations,omitempty"`
+	Error      string   `json:"error,omitempty"`
+}
+
+// Percentile returns the named percentile of the stats
+func (s *LatencyStats) Percentile(name string) time.Duration {
+	switch name {
+	case PercentileP50:
+		return s.P50
+	case PercentileP90:
+		return s.P90
+	case PercentileP99:
+		return s.P99
+	}
+	return s.Max
+}
+
+// NewLatencyStats computes the percentiles and the histogram of the samples
+func NewLatencyStats(sent int, samples []time.Duration) LatencyStats {
+	stats := LatencyStats{Sent: sent, Received: len(samples)}
+	if len(samples) == 0 {
+		return stats
+	}
+	sorted := append([]time.Duration{}, samples...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	// nearest-rank percentile
+	rank := func(p float64) time.Duration {
+		return sorted[max(int(math.Ceil(p/100*float64(len(sorted))))-1, 0)]
+	}
+	stats.P50, stats.P90, stats.P99 = rank(50), rank(90), rank(99)
+	stats.Max = sorted[len(sorted)-1]
+
+	stats.Buckets = make([]int, len(LatencyBuckets)+1)
+	for _, sample := range sorted {
+		stats.Buckets[sort.Search(len(LatencyBuckets), func(i int) bool { return sample <= LatencyBuckets[i] })]++
+	}
+	return stats
+}
+
+// LatencySLO is a latency threshold of a percentile between two zones, "*" matches all zones
+type LatencySLO struct {
+	SourceZone string
+	TargetZone string
+	Percentile string
+	Threshold  time.Duration
+}
+
+// specificity ranks SLOs for exact zones above wildcards
+func (s LatencySLO) specificity() int {
+	n := 0
+	if s.SourceZone != "*" {
+		n++
+	}
+	if s.TargetZone != "*" {
+		n++
+	}
+	return n
+}
+
+func (s LatencySLO) matches(sourceZone, targetZone string) bool {
+	return (s.SourceZone == "*" || s.SourceZone == sourceZone) && (s.TargetZone == "*" || s.TargetZone == targetZone)
+}
+
+// ParseLatencySLOs parses comma separated SLOs SOURCE/TARGET[@PERCENTILE]=DURATION, e.g.
+// "*/*=10ms,eu-1a/eu-1a@p50=500us". The percentile defaults to p99.
+func ParseLatencySLOs(value string) ([]LatencySLO, error) {
+	var slos []LatencySLO
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		key, threshold, ok := strings.Cut(entry, "=")
+		zones, percentile, _ := strings.Cut(key, "@")
+		source, target, okZones := strings.Cut(zones, "/")
+		if !ok || !okZones || source == "" || target == "" {
+			return nil, fmt.Errorf("invalid latency SLO %q, expected SOURCE/TARGET[@PERCENTILE]=DURATION", entry)
+		}
+		slo := LatencySLO{SourceZone: source, TargetZone: target, Percentile: PercentileP99}
+		switch percentile {
+		case "":
+		case PercentileP50, PercentileP90, PercentileP99, PercentileMax:
+			slo.Percentile = percentile
+		default:
+			return nil, fmt.Errorf("invalid percentile %q in latency SLO %q, use p50, p90, p99 or max", percentile, entry)
+		}
+		d, err := time.ParseDuration(threshold)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid threshold in latency SLO %q", entry)
+		}
+		slo.Threshold = d
+		slos = append(slos, slo)
+	}
+	return slos, nil
+}
+
+// CheckLatencySLOs records the violated SLOs of every pair. For every percentile the most
+// specific SLO matching the zones of the pair applies.
+func CheckLatencySLOs(report *Report, stats []LatencyStats, slos []LatencySLO) {
+	for i := range stats {
+		s := &stats[i]
+		if s.Received == 0 {
+			continue
+		}
+		source, _ := report.Node(s.SourceNode)
+		target, _ := report.Node(s.TargetNode)
+
+		applied := map[string]LatencySLO{}
+		for _, slo := range slos {
+			if !slo.matches(source.Zone, target.Zone) {
+				continue
+			}
+			if current, ok := applied[slo.Percentile]; !ok || slo.specificity() > current.specificity() {
+				applied[slo.Percentile] = slo
+			}
+		}
+		for _, percentile := range []string{PercentileP50, PercentileP90, PercentileP99, PercentileMax} {
+			slo, ok := applied[percentile]
+			if ok && s.Percentile(percentile) > slo.Threshold {
+				s.Violations = append(s.Violations, fmt.Sprintf("%s %s > %s", percentile, formatRTT(s.Percentile(percentile)), slo.Threshold))
+			}
+		}
+	}
+}
+
+// CreateLatencyCommand pings all target IPs in parallel with the given number of samples.
+// Every reply line is prefixed with the target IP, invalid IPs are skipped. The pings share
+// stdout, so every line is written on its own by echo; a buffering filter like sed would
+// flush blocks ending in the middle of a line.
+func CreateLatencyCommand(targetIPs []string, samples int) []string {
+	var script strings.Builder
+	for _, ip := range targetIPs {
+		if !ValidatePodIP(ip) {
+			continue
+		}
+		fmt.Fprintf(&script, "(ping -c %d -i %s %s 2>&1 | while IFS= read -r line; do echo \"%s $line\"; done) & ", samples, latencyInterval, ip, ip)
+	}
+	script.WriteString("wait")
+	return []string{"sh", "-c", script.String()}
+}
+
+// pingReplyRegexp matches a complete reply line of busybox or iputils ping prefixed with the target IP
+var pingReplyRegexp = regexp.MustCompile(`^(\S+) \d+ bytes from (\S+): (?:icmp_)?seq=\d+ ttl=\d+ time=([0-9.]+) ms$`)
+
+// ParseLatencyOutput returns the reply times per target IP of a latency command.
+// Lines of one target mixed into the line of another one are skipped.
+func ParseLatencyOutput(output string) map[string][]time.Duration {
+	samples := map[string][]time.Duration{}
+	for _, line := range strings.Split(output, "\n") {
+		match := pingReplyRegexp.FindStringSubmatch(strings.TrimSpace(line))
+		if match == nil || match[1] != match[2] || !ValidatePodIP(match[1]) {
+			continue
+		}
+		ms, err := strconv.ParseFloat(match[3], 64)
+		if err != nil {
+			continue
+		}
+		samples[match[1]] = append(samples[match[1]], time.Duration(ms*float64(time.Millisecond)))
+	}
+	return samples
+}
+
+// MeasureLatency sends samples pings from every test pod to all other test pods of the report,
+// with one exec per source pod
+func MeasureLatency(ctx context.Context, clientset kubernetes.Interface, config *rest.Config, namespace string, report *Report, samples int) []LatencyStats {
+	return measureLatency(ctx, report, samples, func(ctx context.Context, pod string, cmd []string) (string, error) {
+		return ExecInPod(ctx, clientset, config, namespace, pod, cmd)
+	})
+}
+
+func measureLatency(ctx context.Context, report *Report, samples int, exec func(ctx context.Context, pod string, cmd []string) (string, error)) []LatencyStats {
+	var sources []NodeInfo
+	for _, node := range report.Nodes {
+		if node.PodName != "" {
+			sources = append(sources, node)
+		}
+	}
+
+	perSource := make([][]LatencyStats, len(sources))
+	sem := make(chan struct{}, latencyWorkers)
+	var wg sync.WaitGroup
+	for i, source := range sources {
+		var targets []NodeInfo
+		var targetIPs []string
+		for _, target := range report.Nodes {
+			if target.Name != source.Name && ValidatePodIP(target.PodIP) {
+				targets = append(targets, target)
+				targetIPs = append(targetIPs, target.PodIP)
+			}
+		}
+
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			output, err := exec(ctx, source.PodName, CreateLatencyCommand(targetIPs, samples))
+			replies := ParseLatencyOutput(output)
+			for _, target := range targets {
+				stats := NewLatencyStats(samples, replies[target.PodIP])
+				stats.SourceNode, stats.TargetNode = source.Name, target.Name
+				if err != nil && stats.Received == 0 {
+					stats.Error = err.Error()
+				}
+				perSource[i] = append(perSource[i], stats)
+			}
+		}()
+	}
+	wg.Wait()
+
+	var all []LatencyStats
+	for _, stats := range perSource {
+		all = append(all, stats...)
+	}
+	return all
+}
+
+// PrintLatency writes the percentiles of every pair, the SLO violations and a histogram of all samples
+func PrintLatency(w io.Writer, stats []LatencyStats) {
+	if len(stats) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "\nLatency of %d node pairs:\n", len(stats))
+	fmt.Fprintf(w, "  %-40s %9s %9s %9s %9s %6s\n", "PAIR", "P50", "P90", "P99", "MAX", "LOSS")
+	total := make([]int, len(LatencyBuckets)+1)
+	violations := 0
+	for _, s := range stats {
+		pair := s.SourceNode + " → " + s.TargetNode
+		if s.Received == 0 {
+			fmt.Fprintf(w, "! %-40s no replies %s\n", pair, s.Error)
+			continue
+		}
+		marker := " "
+		if len(s.Violations) > 0 {
+			marker = "!"
+			violations++
+		}
+		fmt.Fprintf(w, "%s %-40s %9s %9s %9s %9s %5d%%", marker, pair, formatRTT(s.P50), formatRTT(s.P90), formatRTT(s.P99), formatRTT(s.Max), (s.Sent-s.Received)*100/max(s.Sent, 1))
+		if len(s.Violations) > 0 {
+			fmt.Fprintf(w, "  SLO: %s", strings.Join(s.Violations, ", "))
+		}
+		fmt.Fprintln(w)
+		for i, count := range s.Buckets {
+			total[i] += count
+		}
+	}
+	if violations > 0 {
+		fmt.Fprintf(w, "%d node pairs violate the latency SLOs\n", violations)
+	}
+
+	samples := 0
+	for _, count := range total {
+		samples = max(samples, count)
+	}
+	if samples == 0 {
+		return
+	}
+	fmt.Fprintf(w, "\nLatency histogram of all samples:\n")
+	for i, count := range total {
+		if count == 0 {
+			continue
+		}
+		bound := "> " + LatencyBuckets[len(LatencyBuckets)-1].String()
+		if i < len(LatencyBuckets) {
+			bound = "≤ " + LatencyBuckets[i].String()
+		}
+		fmt.Fprintf(w, "  %-9s %-40s %d\n", bound, strings.Repeat("█", max(count*40/samples, 1)), count)
+	}
+}
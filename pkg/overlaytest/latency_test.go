@@ -0,0 +1,212 @@
+package overlaytest
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewLatencyStats(t *testing.T) {
+	var samples []time.Duration
+	for i := 100; i >= 1; i-- {
+		samples = append(samples, time.Duration(i)*100*time.Microsecond)
+	}
+	stats := NewLatencyStats(110, samples)
+
+	if stats.Sent != 110 || stats.Received != 100 {
+		t.Errorf("Expected 100 of 110 samples, got %d of %d", stats.Received, stats.Sent)
+	}
+	expected := map[string]time.Duration{
+		PercentileP50: 5 * time.Millisecond,
+		PercentileP90: 9 * time.Millisecond,
+		PercentileP99: 9900 * time.Microsecond,
+		PercentileMax: 10 * time.Millisecond,
+	}
+	for percentile, d := range expected {
+		if got := stats.Percentile(percentile); got != d {
+			t.Errorf("Expected %s %s, got %s", percentile, d, got)
+		}
+	}
+
+	// 100µs, 200µs | 300µs..500µs | 600µs..1ms | 1.1ms..2.5ms | 2.6ms..5ms | 5.1ms..10ms
+	buckets := []int{1, 1, 3, 5, 15, 25, 50, 0, 0, 0, 0, 0, 0, 0}
+	if !reflect.DeepEqual(stats.Buckets, buckets) {
+		t.Errorf("Expected buckets %v, got %v", buckets, stats.Buckets)
+	}
+}
+
+func TestNewLatencyStatsWithoutSamples(t *testing.T) {
+	stats := NewLatencyStats(10, nil)
+	if stats.Received != 0 || stats.P50 != 0 || stats.Buckets != nil {
+		t.Errorf("Expected empty stats, got %+v", stats)
+	}
+}
+
+func TestParseLatencySLOs(t *testing.T) {
+	slos, err := ParseLatencySLOs("*/*=10ms, eu-1a/eu-1a@p50=500us,eu-1a/*@max=50ms")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := []LatencySLO{
+		{SourceZone: "*", TargetZone: "*", Percentile: PercentileP99, Threshold: 10 * time.Millisecond},
+		{SourceZone: "eu-1a", TargetZone: "eu-1a", Percentile: PercentileP50, Threshold: 500 * time.Microsecond},
+		{SourceZone: "eu-1a", TargetZone: "*", Percentile: PercentileMax, Threshold: 50 * time.Millisecond},
+	}
+	if !reflect.DeepEqual(slos, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, slos)
+	}
+
+	for _, invalid := range []string{"eu-1a=5ms", "a/b", "a/b@p95=5ms", "a/b=fast", "a/b=-1ms", "/b=1ms"} {
+		if _, err := ParseLatencySLOs(invalid); err == nil {
+			t.Errorf("Expected %q to be rejected", invalid)
+		}
+	}
+}
+
+func TestCheckLatencySLOs(t *testing.T) {
+	report := &Report{Nodes: []NodeInfo{
+		{Name: "node-1", Zone: "a"},
+		{Name: "node-2", Zone: "a"},
+		{Name: "node-3", Zone: "b"},
+	}}
+	stats := []LatencyStats{
+		{SourceNode: "node-1", TargetNode: "node-2", Received: 10, P50: time.Millisecond, P99: 3 * time.Millisecond},
+		{SourceNode: "node-1", TargetNode: "node-3", Received: 10, P50: time.Millisecond, P99: 3 * time.Millisecond},
+		{SourceNode: "node-3", TargetNode: "node-1", Sent: 10},
+	}
+	slos, err := ParseLatencySLOs("*/*=5ms,a/a=2ms,a/a@p50=500us")
+	if err != nil {
+		t.Fatal(err)
+	}
+	CheckLatencySLOs(report, stats, slos)
+
+	if expected := []string{"p50 1ms > 500µs", "p99 3ms > 2ms"}; !reflect.DeepEqual(stats[0].Violations, expected) {
+		t.Errorf("Expected the zone SLOs to apply within zone a, got %v", stats[0].Violations)
+	}
+	if stats[1].Violations != nil {
+		t.Errorf("Expected the default SLO to be met between zones, got %v", stats[1].Violations)
+	}
+	if stats[2].Violations != nil {
+		t.Errorf("Expected no violations without replies, got %v", stats[2].Violations)
+	}
+}
+
+func TestCreateLatencyCommand(t *testing.T) {
+	cmd := CreateLatencyCommand([]string{"10.244.1.5", "10.244.2.5; rm -rf /"}, 100)
+	expected := []string{"sh", "-c", "(ping -c 100 -i 0.2 10.244.1.5 2>&1 | while IFS= read -r line; do echo \"10.244.1.5 $line\"; done) & wait"}
+	if !reflect.DeepEqual(cmd, expected) {
+		t.Errorf("Expected %v, got %v", expected, cmd)
+	}
+}
+
+func TestParseLatencyOutput(t *testing.T) {
+	output := `10.244.1.5 PING 10.244.1.5 (10.244.1.5): 56 data bytes
+10.244.1.5 64 bytes from 10.244.1.5: seq=0 ttl=62 time=0.512 ms
+10.244.2.5 PING 10.244.2.5 (10.244.2.5) 56(84) bytes of data.
+10.244.2.5 64 bytes from 10.244.2.5: icmp_seq=1 ttl=62 time=1.25 ms
+10.244.1.5 64 bytes from 10.244.1.5: seq=1 ttl=62 time=0.488 ms
+10.244.2.5 rtt min/avg/max/mdev = 1.250/1.250/1.250/0.000 ms
+`
+	expected := map[string][]time.Duration{
+		"10.244.1.5": {512 * time.Microsecond, 488 * time.Microsecond},
+		"10.244.2.5": {1250 * time.Microsecond},
+	}
+	if samples := ParseLatencyOutput(output); !reflect.DeepEqual(samples, expected) {
+		t.Errorf("Expected %v, got %v", expected, samples)
+	}
+}
+
+func TestParseLatencyOutputInterleaved(t *testing.T) {
+	// Blocks of two targets flushed in the middle of a line
+	output := `10.244.1.5 64 bytes from 10.244.1.5: seq=0 ttl=62 time=0.512 ms
+10.244.1.5 64 bytes from 10.244.1.5: seq=1 ttl=62 ti10.244.2.5 64 bytes from 10.244.2.5: icmp_seq=1 ttl=62 time=1.25 ms
+10.244.2.5 64 bytes from 10.244.2.5: icmp_seq=2 ttl=62 time=1.31 ms
+10.244.2.5 64 bytes from 10.244.2.5: icmp_seq=3 ttl=62 time=1.2me=0.488 ms
+10.244.1.5 64 bytes from 10.244.1.5: seq=2 ttl=62 time=0.501 ms
+10.244.2.5 64 bytes from 10.244.2.5: icmp_seq=4 ttl=62 10.244.1.5 64 bytes from 10.244.1.5: seq=3 ttl=62 time=0.49 ms
+2001:db8::5 64 bytes from 2001:db8::5: icmp_seq=1 ttl=64 time=0.045 ms
+`
+	expected := map[string][]time.Duration{
+		"10.244.1.5":  {512 * time.Microsecond, 501 * time.Microsecond},
+		"10.244.2.5":  {1310 * time.Microsecond},
+		"2001:db8::5": {45 * time.Microsecond},
+	}
+	if samples := ParseLatencyOutput(output); !reflect.DeepEqual(samples, expected) {
+		t.Errorf("Expected %v, got %v", expected, samples)
+	}
+}
+
+func TestMeasureLatency(t *testing.T) {
+	report := &Report{Nodes: []NodeInfo{
+		{Name: "node-1", PodName: "pod-1", PodIP: "10.244.1.5"},
+		{Name: "node-2", PodName: "pod-2", PodIP: "10.244.2.5"},
+		{Name: "node-3", PodName: "pod-3", PodIP: "10.244.3.5"},
+	}}
+	exec := func(ctx context.Context, pod string, cmd []string) (string, error) {
+		switch pod {
+		case "pod-1":
+			return "10.244.2.5 64 bytes from 10.244.2.5: seq=0 ttl=62 time=0.5 ms\n" +
+				"10.244.3.5 64 bytes from 10.244.3.5: seq=0 ttl=62 time=0.7 ms\n", nil
+		case "pod-2":
+			return "10.244.1.5 64 bytes from 10.244.1.5: seq=0 ttl=62 time=0.6 ms\n", errors.New("command terminated with exit code 1")
+		}
+		return "", errors.New("exec failed")
+	}
+
+	stats := measureLatency(context.Background(), report, 1, exec)
+	if len(stats) != 6 {
+		t.Fatalf("Expected 6 pairs, got %d", len(stats))
+	}
+	byPair := map[string]LatencyStats{}
+	for _, s := range stats {
+		byPair[s.SourceNode+">"+s.TargetNode] = s
+	}
+	if s := byPair["node-1>node-3"]; s.Received != 1 || s.P50 != 700*time.Microsecond {
+		t.Errorf("Expected one 700µs sample from node-1 to node-3, got %+v", s)
+	}
+	if s := byPair["node-2>node-1"]; s.Received != 1 || s.Error != "" {
+		t.Errorf("Expected replies to hide the exit code, got %+v", s)
+	}
+	if s := byPair["node-2>node-3"]; s.Received != 0 || s.Error == "" {
+		t.Errorf("Expected the exec error without replies, got %+v", s)
+	}
+	if s := byPair["node-3>node-1"]; s.Error != "exec failed" {
+		t.Errorf("Expected the exec error, got %+v", s)
+	}
+}
+
+func TestPrintLatency(t *testing.T) {
+	stats := []LatencyStats{
+		NewLatencyStats(2, []time.Duration{300 * time.Microsecond, 400 * time.Microsecond}),
+		NewLatencyStats(2, nil),
+	}
+	stats[0].SourceNode, stats[0].TargetNode = "node-1", "node-2"
+	stats[0].Violations = []string{"p99 400µs > 300µs"}
+	stats[1].SourceNode, stats[1].TargetNode, stats[1].Error = "node-2", "node-1", "exec failed"
+
+	var buf bytes.Buffer
+	PrintLatency(&buf, stats)
+	output := buf.String()
+	for _, expected := range []string{
+		"Latency of 2 node pairs",
+		"SLO: p99 400µs > 300µs",
+		"node-2 → node-1",
+		"no replies exec failed",
+		"1 node pairs violate the latency SLOs",
+		"≤ 500µs",
+	} {
+		if !strings.Contains(output, expected) {
+			t.Errorf("Expected %q in output:\n%s", expected, output)
+		}
+	}
+
+	buf.Reset()
+	PrintLatency(&buf, nil)
+	if buf.Len() != 0 {
+		t.Errorf("Expected no output without latency stats, got %q", buf.String())
+	}
+}
@@ -0,0 +1,153 @@
+package overlaytest
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Log formats
+const (
+	LogFormatText = "text"
+	LogFormatJSON = "json"
+)
+
+// ValidateLogFormat checks the log format, empty means text
+func ValidateLogFormat(format string) error {
+	switch format {
+	case "", LogFormatText, LogFormatJSON:
+		return nil
+	}
+	return fmt.Errorf("unsupported log format %q, use %s or %s", format, LogFormatText, LogFormatJSON)
+}
+
+// NewJSONLogger creates a logger writing one JSON record per line to w
+func NewJSONLogger(w io.Writer) *slog.Logger {
+	return slog.New(slog.NewJSONHandler(w, nil))
+}
+
+// LineLogger turns every line written to it into a log record with a fixed level,
+// e.g. to log the progress messages printed to stdout
+type LineLogger struct {
+	logger *slog.Logger
+	level  slog.Level
+
+	mu  sync.Mutex
+	buf []byte
+}
+
+// NewLineLogger creates a LineLogger logging with level
+func NewLineLogger(logger *slog.Logger, level slog.Level) *LineLogger {
+	return &LineLogger{logger: logger, level: level}
+}
+
+// Write logs all complete lines and keeps the rest until the next write or Flush
+func (l *LineLogger) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.buf = append(l.buf, p...)
+	for {
+		i := bytes.IndexByte(l.buf, '\n')
+		if i < 0 {
+			break
+		}
+		l.log(string(l.buf[:i]))
+		l.buf = l.buf[i+1:]
+	}
+	return len(p), nil
+}
+
+// Flush logs a pending incomplete line
+func (l *LineLogger) Flush() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.log(string(l.buf))
+	l.buf = nil
+}
+
+// log skips empty lines, which only separate sections in the text output
+func (l *LineLogger) log(line string) {
+	line = strings.TrimRight(line, " \r")
+	if strings.TrimSpace(line) == "" {
+		return
+	}
+	l.logger.Log(context.Background(), l.level, line)
+}
+
+// outputKey is the context key of the writers for progress messages and warnings
+type outputKey struct{}
+
+type output struct {
+	stdout, stderr io.Writer
+}
+
+// WithOutput returns a context whose progress messages go to stdout and warnings to stderr,
+// e.g. to tell apart the messages of clusters tested in parallel
+func WithOutput(ctx context.Context, stdout, stderr io.Writer) context.Context {
+	return context.WithValue(ctx, outputKey{}, output{stdout: stdout, stderr: stderr})
+}
+
+// Stdout returns the writer for progress messages of ctx, os.Stdout by default
+func Stdout(ctx context.Context) io.Writer {
+	if out, ok := ctx.Value(outputKey{}).(output); ok {
+		return out.stdout
+	}
+	return os.Stdout
+}
+
+// Stderr returns the writer for warnings of ctx, os.Stderr by default
+func Stderr(ctx context.Context) io.Writer {
+	if out, ok := ctx.Value(outputKey{}).(output); ok {
+		return out.stderr
+	}
+	return os.Stderr
+}
+
+// PrefixWriter writes every line with a prefix to w. Complete lines are written at once,
+// so the lines of prefix writers sharing w do not mix.
+type PrefixWriter struct {
+	w      io.Writer
+	prefix string
+
+	mu  sync.Mutex
+	buf []byte
+}
+
+// NewPrefixWriter creates a PrefixWriter writing to w
+func NewPrefixWriter(w io.Writer, prefix string) *PrefixWriter {
+	return &PrefixWriter{w: w, prefix: prefix}
+}
+
+// Write writes all complete lines and keeps the rest until the next write or Flush
+func (p *PrefixWriter) Write(b []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.buf = append(p.buf, b...)
+	for {
+		i := bytes.IndexByte(p.buf, '\n')
+		if i < 0 {
+			break
+		}
+		line := p.buf[:i+1]
+		p.buf = p.buf[i+1:]
+		if _, err := io.WriteString(p.w, p.prefix+string(line)); err != nil {
+			return len(b), err
+		}
+	}
+	return len(b), nil
+}
+
+// Flush writes a pending incomplete line
+func (p *PrefixWriter) Flush() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.buf) > 0 {
+		io.WriteString(p.w, p.prefix+string(p.buf)+"\n")
+		p.buf = nil
+	}
+}
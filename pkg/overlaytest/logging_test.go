@@ -0,0 +1,108 @@
+package overlaytest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"strings"
+	"testing"
+
+	core "k8s.io/api/core/v1"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestValidateLogFormat(t *testing.T) {
+	for _, format := range []string{"", LogFormatText, LogFormatJSON} {
+		if err := ValidateLogFormat(format); err != nil {
+			t.Errorf("Expected %q to be valid, got: %v", format, err)
+		}
+	}
+	if err := ValidateLogFormat("logfmt"); err == nil {
+		t.Error("Expected logfmt to be rejected")
+	}
+}
+
+func TestLineLogger(t *testing.T) {
+	var buf bytes.Buffer
+	lines := NewLineLogger(NewJSONLogger(&buf), slog.LevelWarn)
+
+	// Lines are split across writes, empty lines are dropped
+	lines.Write([]byte("skipping CNI detection: "))
+	lines.Write([]byte("forbidden\n\n  node-1 → node-2   \nincomplete"))
+	if strings.Contains(buf.String(), "incomplete") {
+		t.Error("Expected the incomplete line to be kept until Flush")
+	}
+	lines.Flush()
+
+	var records []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		record := map[string]any{}
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("Expected a JSON record, got %q: %v", line, err)
+		}
+		records = append(records, record)
+	}
+
+	expected := []string{"skipping CNI detection: forbidden", "  node-1 → node-2", "incomplete"}
+	if len(records) != len(expected) {
+		t.Fatalf("Expected %d records, got %d: %s", len(expected), len(records), buf.String())
+	}
+	for i, record := range records {
+		if record["msg"] != expected[i] || record["level"] != "WARN" || record["time"] == nil {
+			t.Errorf("Expected WARN record %q, got %v", expected[i], record)
+		}
+	}
+
+	buf.Reset()
+	lines.Flush()
+	if buf.Len() != 0 {
+		t.Errorf("Expected no record for an empty flush, got %s", buf.String())
+	}
+}
+
+func TestPrefixWriter(t *testing.T) {
+	var buf bytes.Buffer
+	a := NewPrefixWriter(&buf, "[a] ")
+	b := NewPrefixWriter(&buf, "[b] ")
+
+	// Partial lines of one writer are kept until they are complete
+	a.Write([]byte("  node-1 is not tested: "))
+	b.Write([]byte("all pods ready\nchecking "))
+	a.Write([]byte("NoPod\n"))
+	b.Write([]byte("pod network..."))
+	b.Flush()
+	a.Flush()
+
+	expected := "[b] all pods ready\n[a]   node-1 is not tested: NoPod\n[b] checking pod network...\n"
+	if buf.String() != expected {
+		t.Errorf("Expected %q, got %q", expected, buf.String())
+	}
+}
+
+func TestWithOutput(t *testing.T) {
+	ctx := context.Background()
+	if Stdout(ctx) != os.Stdout || Stderr(ctx) != os.Stderr {
+		t.Error("Expected stdout and stderr without output in the context")
+	}
+
+	var stdout, stderr bytes.Buffer
+	ctx = WithOutput(ctx, &stdout, &stderr)
+	if Stdout(ctx) != &stdout || Stderr(ctx) != &stderr {
+		t.Error("Expected the writers of the context")
+	}
+
+	// Progress messages of the package follow the context
+	pod := &core.Pod{
+		ObjectMeta: meta.ObjectMeta{Name: "overlaytest-a", Namespace: "test-namespace"},
+		Status:     core.PodStatus{PodIP: "10.244.0.1"},
+	}
+	if err := WaitForPodNetwork(ctx, fake.NewSimpleClientset(pod), "test-namespace", []core.Pod{*pod}); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if !strings.Contains(stdout.String(), "overlaytest-a ready 10.244.0.1") {
+		t.Errorf("Expected the progress messages in the context writer, got %q", stdout.String())
+	}
+}
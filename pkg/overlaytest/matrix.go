@@ -0,0 +1,202 @@
+package overlaytest
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Matrix cell symbols
+const (
+	MatrixReachable   = "✓"
+	MatrixUnreachable = "✗"
+	MatrixNoResult    = "·"
+)
+
+// matrix holds the probe results indexed by source and target node
+type matrix struct {
+	nodes   []string
+	results map[[2]string]ProbeResult
+}
+
+func newMatrix(report *Report) *matrix {
+	m := &matrix{results: map[[2]string]ProbeResult{}}
+	seen := map[string]bool{}
+	add := func(node string) {
+		if !seen[node] {
+			seen[node] = true
+			m.nodes = append(m.nodes, node)
+		}
+	}
+	for _, node := range report.Nodes {
+		add(node.Name)
+	}
+	for _, result := range report.Results {
+		add(result.SourceNode)
+		add(result.TargetNode)
+		m.results[[2]string{result.SourceNode, result.TargetNode}] = result
+	}
+	return m
+}
+
+// cell returns the symbol of a node pair, or the RTT in milliseconds with latency
+func (m *matrix) cell(source, target string, latency bool) string {
+	result, ok := m.results[[2]string{source, target}]
+	switch {
+	case !ok:
+		return MatrixNoResult
+	case !result.Reachable:
+		return MatrixUnreachable
+	case latency && result.RTT > 0:
+		return strconv.FormatFloat(float64(result.RTT)/float64(time.Millisecond), 'f', 1, 64)
+	default:
+		return MatrixReachable
+	}
+}
+
+// outgoing counts the reachable and probed targets of a source node
+func (m *matrix) outgoing(source string) (int, int) {
+	ok, total := 0, 0
+	for _, target := range m.nodes {
+		if result, found := m.results[[2]string{source, target}]; found {
+			total++
+			if result.Reachable {
+				ok++
+			}
+		}
+	}
+	return ok, total
+}
+
+// incoming counts the sources reaching a target node and the probing sources
+func (m *matrix) incoming(target string) (int, int) {
+	ok, total := 0, 0
+	for _, source := range m.nodes {
+		if result, found := m.results[[2]string{source, target}]; found {
+			total++
+			if result.Reachable {
+				ok++
+			}
+		}
+	}
+	return ok, total
+}
+
+// RenderMatrix writes the connectivity matrix of the report with sources as rows and targets as columns.
+// Cells show the RTT in milliseconds if the grid fits into width, otherwise only ✓ and ✗.
+// Clusters too wide for a grid get one summary line per node. Width 0 means unlimited.
+func RenderMatrix(w io.Writer, report *Report, width int) {
+	m := newMatrix(report)
+	if len(m.nodes) == 0 {
+		fmt.Fprintln(w, "no results")
+		return
+	}
+
+	for _, latency := range []bool{true, false} {
+		lines := m.grid(latency)
+		if width == 0 || maxLineWidth(lines) <= width {
+			for _, line := range lines {
+				fmt.Fprintln(w, line)
+			}
+			if latency {
+				fmt.Fprintf(w, "\nrows: source, columns: target, RTT in ms, %s unreachable\n", MatrixUnreachable)
+			} else {
+				fmt.Fprintf(w, "\nrows: source, columns: target, %s reachable, %s unreachable\n", MatrixReachable, MatrixUnreachable)
+			}
+			return
+		}
+	}
+	m.compact(w)
+}
+
+// grid renders the matrix table, columns are numbered to keep them narrow
+func (m *matrix) grid(latency bool) []string {
+	const summaryLabel = "reached by"
+	labels := make([]string, len(m.nodes))
+	labelWidth := len(summaryLabel)
+	cellWidth := len(strconv.Itoa(len(m.nodes)))
+	for i, node := range m.nodes {
+		labels[i] = fmt.Sprintf("%*d %s", len(strconv.Itoa(len(m.nodes))), i+1, node)
+		labelWidth = max(labelWidth, utf8.RuneCountInString(labels[i]))
+		for _, target := range m.nodes {
+			cellWidth = max(cellWidth, utf8.RuneCountInString(m.cell(node, target, latency)))
+		}
+	}
+
+	var lines []string
+	var sb strings.Builder
+
+	sb.WriteString(pad("", labelWidth))
+	for i := range m.nodes {
+		sb.WriteString(" " + padLeft(strconv.Itoa(i+1), cellWidth))
+	}
+	sb.WriteString("  reach")
+	lines = append(lines, sb.String())
+
+	for i, source := range m.nodes {
+		sb.Reset()
+		sb.WriteString(pad(labels[i], labelWidth))
+		for _, target := range m.nodes {
+			sb.WriteString(" " + padLeft(m.cell(source, target, latency), cellWidth))
+		}
+		ok, total := m.outgoing(source)
+		fmt.Fprintf(&sb, "  %d/%d", ok, total)
+		lines = append(lines, sb.String())
+	}
+
+	// Summary row with the number of sources reaching every target and the overall totals
+	sb.Reset()
+	sb.WriteString(pad(summaryLabel, labelWidth))
+	reachable, probes := 0, 0
+	for _, target := range m.nodes {
+		ok, total := m.incoming(target)
+		reachable += ok
+		probes += total
+		sb.WriteString(" " + padLeft(strconv.Itoa(ok), cellWidth))
+	}
+	fmt.Fprintf(&sb, "  %d/%d", reachable, probes)
+	lines = append(lines, sb.String())
+	return lines
+}
+
+// compact writes one line per source node with its reachability and unreachable targets
+func (m *matrix) compact(w io.Writer) {
+	nameWidth := 0
+	for _, node := range m.nodes {
+		nameWidth = max(nameWidth, utf8.RuneCountInString(node))
+	}
+	for _, source := range m.nodes {
+		ok, total := m.outgoing(source)
+		inOK, inTotal := m.incoming(source)
+		line := fmt.Sprintf("%s  reaches %d/%d, reached by %d/%d", pad(source, nameWidth), ok, total, inOK, inTotal)
+		var unreachable []string
+		for _, target := range m.nodes {
+			if result, found := m.results[[2]string{source, target}]; found && !result.Reachable {
+				unreachable = append(unreachable, target)
+			}
+		}
+		if len(unreachable) > 0 {
+			line += "  " + MatrixUnreachable + " " + joinNodes(unreachable)
+		}
+		fmt.Fprintln(w, line)
+	}
+}
+
+func maxLineWidth(lines []string) int {
+	width := 0
+	for _, line := range lines {
+		width = max(width, utf8.RuneCountInString(line))
+	}
+	return width
+}
+
+func pad(s string, width int) string {
+	return s + strings.Repeat(" ", max(0, width-utf8.RuneCountInString(s)))
+}
+
+func padLeft(s string, width int) string {
+	return strings.Repeat(" ", max(0, width-utf8.RuneCountInString(s))) + s
+}
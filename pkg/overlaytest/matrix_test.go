@@ -0,0 +1,96 @@
+package overlaytest
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+func TestRenderMatrix(t *testing.T) {
+	report := testReport()
+	report.Results[0].RTT = 400 * time.Microsecond
+	report.Results[2].RTT = 1250 * time.Microsecond
+
+	var buf bytes.Buffer
+	RenderMatrix(&buf, report, 0)
+	output := buf.String()
+
+	expected := []string{
+		"             1   2  reach",
+		"1 node-1   0.4   ✗  1/2",
+		"2 node-2   1.2   ✓  2/2",
+		"reached by   2   1  3/4",
+	}
+	lines := strings.Split(output, "\n")
+	for i, line := range expected {
+		if lines[i] != line {
+			t.Errorf("Line %d: expected %q, got %q", i, line, lines[i])
+		}
+	}
+	if !strings.Contains(output, "RTT in ms") {
+		t.Errorf("Expected latency legend, got:\n%s", output)
+	}
+}
+
+func TestRenderMatrixWidth(t *testing.T) {
+	report := testReport()
+	report.Results[0].RTT = 400 * time.Microsecond
+
+	t.Run("Symbols when latency does not fit", func(t *testing.T) {
+		var buf bytes.Buffer
+		RenderMatrix(&buf, report, 22)
+		output := buf.String()
+		if !strings.Contains(output, "1 node-1   ✓ ✗  1/2") {
+			t.Errorf("Expected symbol grid, got:\n%s", output)
+		}
+		for _, line := range strings.Split(strings.TrimSpace(output), "\n") {
+			if utf8.RuneCountInString(line) > 22 && !strings.HasPrefix(line, "rows:") {
+				t.Errorf("Line exceeds width: %q", line)
+			}
+		}
+	})
+
+	t.Run("Compact when the grid does not fit", func(t *testing.T) {
+		var buf bytes.Buffer
+		RenderMatrix(&buf, report, 10)
+		output := buf.String()
+		if !strings.Contains(output, "node-1  reaches 1/2, reached by 2/2  ✗ node-2") {
+			t.Errorf("Expected compact format, got:\n%s", output)
+		}
+	})
+}
+
+func TestRenderMatrixLarge(t *testing.T) {
+	report := &Report{}
+	for i := 0; i < 12; i++ {
+		for j := 0; j < 12; j++ {
+			report.Results = append(report.Results, ProbeResult{
+				SourceNode: fmt.Sprintf("node-%02d", i),
+				TargetNode: fmt.Sprintf("node-%02d", j),
+				Reachable:  i != 3,
+			})
+		}
+	}
+
+	var buf bytes.Buffer
+	RenderMatrix(&buf, report, 80)
+	lines := strings.Split(buf.String(), "\n")
+	// header, 12 rows, summary
+	if !strings.HasPrefix(lines[13], "reached by") || !strings.HasSuffix(lines[13], "132/144") {
+		t.Errorf("Expected summary row, got %q", lines[13])
+	}
+	if !strings.HasSuffix(lines[4], "0/12") {
+		t.Errorf("Expected node-03 to reach nothing, got %q", lines[4])
+	}
+}
+
+func TestRenderMatrixEmpty(t *testing.T) {
+	var buf bytes.Buffer
+	RenderMatrix(&buf, &Report{}, 80)
+	if buf.String() != "no results\n" {
+		t.Errorf("Expected no results, got %q", buf.String())
+	}
+}
@@ -0,0 +1,129 @@
+package overlaytest
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// pairLabels are the labels attached to all per node pair metrics
+var pairLabels = []string{"source_node", "target_node", "source_zone", "target_zone"}
+
+// Metrics holds the Prometheus collectors exposed in monitor mode
+type Metrics struct {
+	Reachable   *prometheus.GaugeVec
+	RTT         *prometheus.HistogramVec
+	Errors      *prometheus.CounterVec
+	RunDuration prometheus.Gauge
+	LastRun     prometheus.Gauge
+	Throughput  *prometheus.GaugeVec
+}
+
+// NewMetrics creates the overlaytest collectors and registers them with reg
+func NewMetrics(reg prometheus.Registerer) *Metrics {
+	m := &Metrics{
+		Reachable: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "overlaytest_probe_reachable",
+			Help: "Whether the target node was reachable from the source node in the last run (1) or not (0).",
+		}, pairLabels),
+		RTT: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "overlaytest_probe_rtt_seconds",
+			Help:    "Round-trip time of successful probes between node pairs.",
+			Buckets: []float64{.0001, .00025, .0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1},
+		}, pairLabels),
+		Errors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "overlaytest_probe_errors_total",
+			Help: "Number of failed probes between node pairs by error class.",
+		}, append(append([]string{}, pairLabels...), "class")),
+		RunDuration: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "overlaytest_run_duration_seconds",
+			Help: "Duration of the last complete test run.",
+		}),
+		LastRun: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "overlaytest_last_run_timestamp_seconds",
+			Help: "Unix timestamp of the last complete test run.",
+		}),
+		Throughput: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "overlaytest_throughput_bits_per_second",
+			Help: "Bandwidth of the node pairs sampled in the last run.",
+		}, pairLabels),
+	}
+	reg.MustRegister(m.Reachable, m.RTT, m.Errors, m.RunDuration, m.LastRun, m.Throughput)
+	return m
+}
+
+// Observe updates the metrics from a test report
+func (m *Metrics) Observe(report *Report) {
+	// Drop pairs of nodes which left the cluster since the last run
+	m.Reachable.Reset()
+
+	for _, result := range report.Results {
+		source, _ := report.Node(result.SourceNode)
+		target, _ := report.Node(result.TargetNode)
+		labels := prometheus.Labels{
+			"source_node": result.SourceNode,
+			"target_node": result.TargetNode,
+			"source_zone": source.Zone,
+			"target_zone": target.Zone,
+		}
+
+		if result.Reachable {
+			m.Reachable.With(labels).Set(1)
+			if result.RTT > 0 {
+				m.RTT.With(labels).Observe(result.RTT.Seconds())
+			}
+			continue
+		}
+
+		m.Reachable.With(labels).Set(0)
+		labels["class"] = result.ErrorClass
+		m.Errors.With(labels).Inc()
+	}
+
+	// Sampled pairs change between runs
+	m.Throughput.Reset()
+	for _, result := range report.Throughput {
+		if result.Error != "" {
+			continue
+		}
+		source, _ := report.Node(result.SourceNode)
+		target, _ := report.Node(result.TargetNode)
+		m.Throughput.With(prometheus.Labels{
+			"source_node": result.SourceNode,
+			"target_node": result.TargetNode,
+			"source_zone": source.Zone,
+			"target_zone": target.Zone,
+		}).Set(result.Mbps * 1e6)
+	}
+
+	m.RunDuration.Set(report.Duration.Seconds())
+	m.LastRun.Set(float64(report.StartTime.Add(report.Duration).Unix()))
+}
+
+// ServeMetrics serves the /metrics endpoint on addr until ctx is cancelled
+func ServeMetrics(ctx context.Context, addr string, gatherer prometheus.Gatherer) error {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(gatherer, promhttp.HandlerOpts{}))
+
+	server := &http.Server{
+		Addr:              addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
+
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
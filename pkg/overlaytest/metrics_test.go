@@ -0,0 +1,117 @@
+package overlaytest
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestMetricsObserve(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	metrics := NewMetrics(registry)
+
+	report := testReport()
+	report.StartTime = time.Unix(1700000000, 0)
+	report.Duration = 3 * time.Second
+	report.Results[0].RTT = 500 * time.Microsecond
+	report.Throughput = []ThroughputResult{
+		{SourceNode: "node-1", TargetNode: "node-2", Mbps: 940},
+		{SourceNode: "node-2", TargetNode: "node-1", Error: "connection refused"},
+	}
+
+	metrics.Observe(report)
+
+	t.Run("Reachability gauges", func(t *testing.T) {
+		if count := testutil.CollectAndCount(metrics.Reachable); count != 4 {
+			t.Errorf("Expected 4 reachability series, got %d", count)
+		}
+		failed := metrics.Reachable.WithLabelValues("node-1", "node-2", "zone-a", "zone-b")
+		if value := testutil.ToFloat64(failed); value != 0 {
+			t.Errorf("Expected node-1 -> node-2 to be 0, got %f", value)
+		}
+		ok := metrics.Reachable.WithLabelValues("node-2", "node-1", "zone-b", "zone-a")
+		if value := testutil.ToFloat64(ok); value != 1 {
+			t.Errorf("Expected node-2 -> node-1 to be 1, got %f", value)
+		}
+	})
+
+	t.Run("Error counter", func(t *testing.T) {
+		counter := metrics.Errors.WithLabelValues("node-1", "node-2", "zone-a", "zone-b", ErrorClassUnreachable)
+		if value := testutil.ToFloat64(counter); value != 1 {
+			t.Errorf("Expected 1 unreachable error, got %f", value)
+		}
+	})
+
+	t.Run("RTT histogram", func(t *testing.T) {
+		// Only results with a measured RTT are observed
+		if count := testutil.CollectAndCount(metrics.RTT); count != 1 {
+			t.Errorf("Expected 1 RTT series, got %d", count)
+		}
+	})
+
+	t.Run("Throughput gauges", func(t *testing.T) {
+		// Failed measurements are left out
+		if count := testutil.CollectAndCount(metrics.Throughput); count != 1 {
+			t.Errorf("Expected 1 throughput series, got %d", count)
+		}
+		gauge := metrics.Throughput.WithLabelValues("node-1", "node-2", "zone-a", "zone-b")
+		if value := testutil.ToFloat64(gauge); value != 940e6 {
+			t.Errorf("Expected 940e6 bits per second, got %f", value)
+		}
+	})
+
+	t.Run("Run duration", func(t *testing.T) {
+		if value := testutil.ToFloat64(metrics.RunDuration); value != 3 {
+			t.Errorf("Expected run duration 3, got %f", value)
+		}
+		if value := testutil.ToFloat64(metrics.LastRun); value != 1700000003 {
+			t.Errorf("Expected last run timestamp 1700000003, got %f", value)
+		}
+	})
+
+	t.Run("Removed nodes are dropped", func(t *testing.T) {
+		metrics.Observe(&Report{Results: report.Results[:1], Nodes: report.Nodes})
+		if count := testutil.CollectAndCount(metrics.Reachable); count != 1 {
+			t.Errorf("Expected 1 reachability series after reset, got %d", count)
+		}
+	})
+}
+
+func TestMetricsExposition(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	metrics := NewMetrics(registry)
+	metrics.Observe(testReport())
+
+	expected := `
+# HELP overlaytest_probe_errors_total Number of failed probes between node pairs by error class.
+# TYPE overlaytest_probe_errors_total counter
+overlaytest_probe_errors_total{class="unreachable",source_node="node-1",source_zone="zone-a",target_node="node-2",target_zone="zone-b"} 1
+`
+	if err := testutil.GatherAndCompare(registry, strings.NewReader(expected), "overlaytest_probe_errors_total"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestServeMetrics(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// A cancelled context shuts the server down without error
+	done := make(chan error, 1)
+	go func() {
+		done <- ServeMetrics(ctx, "127.0.0.1:0", prometheus.NewRegistry())
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Expected no error, got: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("Expected server to shut down")
+	}
+}
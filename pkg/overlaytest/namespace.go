@@ -0,0 +1,130 @@
+package overlaytest
+
+import (
+	"context"
+	"fmt"
+
+	core "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Labels of namespaces created by overlaytest
+const (
+	ManagedByLabel = "app.kubernetes.io/managed-by"
+	ManagedByValue = "overlaytest"
+
+	PodSecurityEnforceLabel = "pod-security.kubernetes.io/enforce"
+	PodSecurityWarnLabel    = "pod-security.kubernetes.io/warn"
+	PodSecurityAuditLabel   = "pod-security.kubernetes.io/audit"
+)
+
+// systemNamespaces are never created or deleted by overlaytest
+var systemNamespaces = map[string]bool{
+	"default":         true,
+	"kube-system":     true,
+	"kube-public":     true,
+	"kube-node-lease": true,
+}
+
+// PodSecurityLevel returns the Pod Security Standards level the test pods of a security mode need
+func PodSecurityLevel(mode string) string {
+	switch mode {
+	case SecurityModeBaseline:
+		return "baseline"
+	case SecurityModeRestricted:
+		return "restricted"
+	default:
+		return "privileged"
+	}
+}
+
+// CreateNamespaceSpec creates the specification of a dedicated test namespace
+func CreateNamespaceSpec(name, securityMode string) *core.Namespace {
+	return &core.Namespace{
+		ObjectMeta: meta.ObjectMeta{
+			Name:   name,
+			Labels: namespaceLabels(securityMode),
+		},
+	}
+}
+
+func namespaceLabels(securityMode string) map[string]string {
+	level := PodSecurityLevel(securityMode)
+	return map[string]string{
+		ManagedByLabel:          ManagedByValue,
+		PodSecurityEnforceLabel: level,
+		PodSecurityWarnLabel:    level,
+		PodSecurityAuditLabel:   level,
+	}
+}
+
+// IsManagedNamespace reports whether the namespace was created by overlaytest
+func IsManagedNamespace(namespace *core.Namespace) bool {
+	return namespace.Labels[ManagedByLabel] == ManagedByValue
+}
+
+// EnsureNamespace creates the dedicated test namespace with the Pod Security labels of the security mode.
+// Namespaces created by overlaytest get their labels updated, other namespaces are used as they are.
+func EnsureNamespace(ctx context.Context, clientset kubernetes.Interface, name, securityMode string) error {
+	if systemNamespaces[name] {
+		return fmt.Errorf("refusing to manage system namespace %s", name)
+	}
+	namespaces := clientset.CoreV1().Namespaces()
+
+	current, err := namespaces.Get(ctx, name, meta.GetOptions{})
+	if errors.IsNotFound(err) {
+		if _, err := namespaces.Create(ctx, CreateNamespaceSpec(name, securityMode), meta.CreateOptions{}); err != nil {
+			return fmt.Errorf("error creating namespace: %w", err)
+		}
+		fmt.Fprintf(Stdout(ctx), "Created namespace %q.\n", name)
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("error getting namespace: %w", err)
+	}
+
+	if current.DeletionTimestamp != nil {
+		return fmt.Errorf("namespace %s is being deleted, please run again later", name)
+	}
+	if !IsManagedNamespace(current) {
+		fmt.Fprintf(Stdout(ctx), "namespace %s exists and is not managed by overlaytest, using it as it is\n", name)
+		return nil
+	}
+
+	changed := false
+	for key, value := range namespaceLabels(securityMode) {
+		if current.Labels[key] != value {
+			current.Labels[key] = value
+			changed = true
+		}
+	}
+	if changed {
+		if _, err := namespaces.Update(ctx, current, meta.UpdateOptions{}); err != nil {
+			return fmt.Errorf("error updating namespace labels: %w", err)
+		}
+	}
+	return nil
+}
+
+// DeleteNamespace deletes a namespace created by overlaytest and refuses to delete any other namespace
+func DeleteNamespace(ctx context.Context, clientset kubernetes.Interface, name string) error {
+	if systemNamespaces[name] {
+		return fmt.Errorf("refusing to delete system namespace %s", name)
+	}
+	namespace, err := clientset.CoreV1().Namespaces().Get(ctx, name, meta.GetOptions{})
+	if errors.IsNotFound(err) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("error getting namespace: %w", err)
+	}
+	if !IsManagedNamespace(namespace) {
+		return fmt.Errorf("refusing to delete namespace %s: not created by overlaytest (missing label %s=%s)", name, ManagedByLabel, ManagedByValue)
+	}
+
+	if err := clientset.CoreV1().Namespaces().Delete(ctx, name, meta.DeleteOptions{}); err != nil && !errors.IsNotFound(err) {
+		return fmt.Errorf("error deleting namespace: %w", err)
+	}
+	fmt.Fprintf(Stdout(ctx), "Deleted namespace %q.\n", name)
+	return nil
+}
@@ -0,0 +1,163 @@
+package overlaytest
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	core "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestPodSecurityLevel(t *testing.T) {
+	tests := map[string]string{
+		"":                     "privileged",
+		SecurityModePrivileged: "privileged",
+		SecurityModeNetRaw:     "privileged",
+		SecurityModeBaseline:   "baseline",
+		SecurityModeRestricted: "restricted",
+	}
+	for mode, expected := range tests {
+		if level := PodSecurityLevel(mode); level != expected {
+			t.Errorf("Expected level %s for mode %q, got %s", expected, mode, level)
+		}
+	}
+}
+
+func TestEnsureNamespace(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Creates labeled namespace", func(t *testing.T) {
+		clientset := fake.NewSimpleClientset()
+		if err := EnsureNamespace(ctx, clientset, "overlaytest", SecurityModeRestricted); err != nil {
+			t.Fatalf("Expected no error, got: %v", err)
+		}
+		namespace, err := clientset.CoreV1().Namespaces().Get(ctx, "overlaytest", meta.GetOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !IsManagedNamespace(namespace) {
+			t.Errorf("Expected managed-by label, got %v", namespace.Labels)
+		}
+		if namespace.Labels[PodSecurityEnforceLabel] != "restricted" {
+			t.Errorf("Expected enforce label restricted, got %v", namespace.Labels)
+		}
+	})
+
+	t.Run("Updates labels of managed namespace", func(t *testing.T) {
+		clientset := fake.NewSimpleClientset(CreateNamespaceSpec("overlaytest", SecurityModePrivileged))
+		if err := EnsureNamespace(ctx, clientset, "overlaytest", SecurityModeBaseline); err != nil {
+			t.Fatalf("Expected no error, got: %v", err)
+		}
+		namespace, _ := clientset.CoreV1().Namespaces().Get(ctx, "overlaytest", meta.GetOptions{})
+		if namespace.Labels[PodSecurityEnforceLabel] != "baseline" {
+			t.Errorf("Expected enforce label baseline, got %v", namespace.Labels)
+		}
+	})
+
+	t.Run("Leaves foreign namespace alone", func(t *testing.T) {
+		foreign := &core.Namespace{ObjectMeta: meta.ObjectMeta{Name: "tenant", Labels: map[string]string{"team": "a"}}}
+		clientset := fake.NewSimpleClientset(foreign)
+		if err := EnsureNamespace(ctx, clientset, "tenant", SecurityModeRestricted); err != nil {
+			t.Fatalf("Expected no error, got: %v", err)
+		}
+		namespace, _ := clientset.CoreV1().Namespaces().Get(ctx, "tenant", meta.GetOptions{})
+		if len(namespace.Labels) != 1 {
+			t.Errorf("Expected labels to be unchanged, got %v", namespace.Labels)
+		}
+	})
+
+	t.Run("Terminating namespace", func(t *testing.T) {
+		namespace := CreateNamespaceSpec("overlaytest", "")
+		now := meta.Now()
+		namespace.DeletionTimestamp = &now
+		clientset := fake.NewSimpleClientset(namespace)
+		if err := EnsureNamespace(ctx, clientset, "overlaytest", ""); err == nil {
+			t.Error("Expected error for terminating namespace")
+		}
+	})
+
+	t.Run("System namespace", func(t *testing.T) {
+		if err := EnsureNamespace(ctx, fake.NewSimpleClientset(), "kube-system", ""); err == nil {
+			t.Error("Expected error for system namespace")
+		}
+	})
+}
+
+func TestDeleteNamespace(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Deletes managed namespace", func(t *testing.T) {
+		clientset := fake.NewSimpleClientset(CreateNamespaceSpec("overlaytest", ""))
+		if err := DeleteNamespace(ctx, clientset, "overlaytest"); err != nil {
+			t.Fatalf("Expected no error, got: %v", err)
+		}
+		if _, err := clientset.CoreV1().Namespaces().Get(ctx, "overlaytest", meta.GetOptions{}); !errors.IsNotFound(err) {
+			t.Errorf("Expected namespace to be deleted, got: %v", err)
+		}
+	})
+
+	t.Run("Refuses foreign namespace", func(t *testing.T) {
+		clientset := fake.NewSimpleClientset(&core.Namespace{ObjectMeta: meta.ObjectMeta{Name: "tenant"}})
+		err := DeleteNamespace(ctx, clientset, "tenant")
+		if err == nil || !strings.Contains(err.Error(), "refusing") {
+			t.Fatalf("Expected refusal, got: %v", err)
+		}
+		if _, err := clientset.CoreV1().Namespaces().Get(ctx, "tenant", meta.GetOptions{}); err != nil {
+			t.Errorf("Expected namespace to be kept, got: %v", err)
+		}
+	})
+
+	t.Run("Missing namespace", func(t *testing.T) {
+		if err := DeleteNamespace(ctx, fake.NewSimpleClientset(), "overlaytest"); err != nil {
+			t.Errorf("Expected no error, got: %v", err)
+		}
+	})
+}
+
+func TestCreateOrReuseDaemonSetNamespaceLifecycle(t *testing.T) {
+	ctx := context.Background()
+	clientset := fake.NewSimpleClientset()
+	config := DefaultConfig()
+	config.Namespace = "overlaytest"
+	config.CreateNamespace = true
+	config.SecurityMode = SecurityModeRestricted
+
+	if err := CreateOrReuseDaemonSet(ctx, clientset, config, false); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if _, err := clientset.CoreV1().Namespaces().Get(ctx, "overlaytest", meta.GetOptions{}); err != nil {
+		t.Fatalf("Expected namespace to be created, got: %v", err)
+	}
+
+	// The second run cleans up, including the namespace
+	if err := CreateOrReuseDaemonSet(ctx, clientset, config, false); err == nil {
+		t.Fatal("Expected error asking to run again")
+	}
+	if _, err := clientset.CoreV1().Namespaces().Get(ctx, "overlaytest", meta.GetOptions{}); !errors.IsNotFound(err) {
+		t.Errorf("Expected namespace to be deleted, got: %v", err)
+	}
+}
+
+func TestCleanupKeepsForeignNamespace(t *testing.T) {
+	ctx := context.Background()
+	clientset := fake.NewSimpleClientset(&core.Namespace{ObjectMeta: meta.ObjectMeta{Name: "tenant"}})
+	config := DefaultConfig()
+	config.Namespace = "tenant"
+	config.CreateNamespace = true
+
+	if err := CreateOrReuseDaemonSet(ctx, clientset, config, false); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if err := Cleanup(ctx, clientset, config); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if _, err := clientset.CoreV1().Namespaces().Get(ctx, "tenant", meta.GetOptions{}); err != nil {
+		t.Errorf("Expected namespace to be kept, got: %v", err)
+	}
+	if _, err := clientset.AppsV1().DaemonSets("tenant").Get(ctx, config.AppName, meta.GetOptions{}); !errors.IsNotFound(err) {
+		t.Errorf("Expected daemonset to be deleted, got: %v", err)
+	}
+}
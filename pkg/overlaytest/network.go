@@ -1,17 +1,22 @@
 package overlaytest
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"net"
-	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
 
 	core "k8s.io/api/core/v1"
-	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/kubernetes/scheme"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/remotecommand"
+	utilexec "k8s.io/client-go/util/exec"
 )
 
 // CreatePingCommand creates a ping command for the target IP
@@ -28,47 +33,208 @@ func ValidatePodIP(podIP string) bool {
 	return net.ParseIP(podIP) != nil
 }
 
-// RunNetworkTest executes network overlay tests between all pods
-func RunNetworkTest(ctx context.Context, clientset kubernetes.Interface, config *rest.Config, namespace string) error {
-	// Refresh pod object list
-	pods, err := clientset.CoreV1().Pods(namespace).List(ctx, meta.ListOptions{LabelSelector: "app=overlaytest"})
+// CreatePingProbeCommand creates a ping command for the target IP which keeps
+// the summary output, so the round-trip time can be parsed from it
+func CreatePingProbeCommand(targetIP string) []string {
+	return []string{"ping", "-c", "2", "-q", targetIP}
+}
+
+var pingSummaryRegexp = regexp.MustCompile(`(?:rtt|round-trip) min/avg/max(?:/mdev)? = ([0-9.]+)/([0-9.]+)/([0-9.]+)`)
+
+// ParsePingRTT extracts the average round-trip time from the ping summary line.
+// Both iputils and busybox output formats are supported.
+func ParsePingRTT(output string) (time.Duration, bool) {
+	match := pingSummaryRegexp.FindStringSubmatch(output)
+	if match == nil {
+		return 0, false
+	}
+	avg, err := strconv.ParseFloat(match[2], 64)
 	if err != nil {
-		return err
-	}
-
-	for _, upod := range pods.Items {
-		for _, pod := range pods.Items {
-			cmd := CreatePingCommand(upod.Status.PodIP)
-			req := clientset.CoreV1().RESTClient().Post().
-				Resource("pods").
-				Name(pod.ObjectMeta.Name).
-				Namespace(namespace).
-				SubResource("exec").
-				VersionedParams(&core.PodExecOptions{
-					Command: cmd,
-					Stdin:   true,
-					Stdout:  true,
-					Stderr:  true,
-				}, scheme.ParameterCodec)
-
-			exec, err := remotecommand.NewSPDYExecutor(config, "POST", req.URL())
-			if err != nil {
-				fmt.Printf("error while creating Executor: %v\n", err)
-				continue
-			}
+		return 0, false
+	}
+	return time.Duration(avg * float64(time.Millisecond)), true
+}
+
+// ClassifyProbeError maps an exec error to one of the probe error classes
+func ClassifyProbeError(err error) string {
+	var exitErr utilexec.ExitError
+	if errors.As(err, &exitErr) {
+		// ping exits with 1 when no reply was received
+		if exitErr.ExitStatus() == 1 {
+			return ErrorClassUnreachable
+		}
+		return ErrorClassProbe
+	}
+	return ErrorClassExec
+}
+
+// ExecInPod runs a command in the given pod and returns its standard output
+func ExecInPod(ctx context.Context, clientset kubernetes.Interface, config *rest.Config, namespace, podName string, cmd []string) (string, error) {
+	req := clientset.CoreV1().RESTClient().Post().
+		Resource("pods").
+		Name(podName).
+		Namespace(namespace).
+		SubResource("exec").
+		VersionedParams(&core.PodExecOptions{
+			Command: cmd,
+			Stdout:  true,
+			Stderr:  true,
+		}, scheme.ParameterCodec)
+
+	exec, err := remotecommand.NewSPDYExecutor(config, "POST", req.URL())
+	if err != nil {
+		return "", fmt.Errorf("error while creating Executor: %w", err)
+	}
+
+	var stdout, stderr bytes.Buffer
+	err = exec.StreamWithContext(ctx, remotecommand.StreamOptions{
+		Stdout: &stdout,
+		Stderr: &stderr,
+		Tty:    false,
+	})
+	return stdout.String(), err
+}
+
+// ProbePod pings the target pod from the source pod
+func ProbePod(ctx context.Context, clientset kubernetes.Interface, config *rest.Config, namespace string, source, target core.Pod) ProbeResult {
+	result := ProbeResult{
+		SourceNode: source.Spec.NodeName,
+		TargetNode: target.Spec.NodeName,
+		TargetIP:   target.Status.PodIP,
+	}
+
+	output, err := ExecInPod(ctx, clientset, config, namespace, source.ObjectMeta.Name, CreatePingProbeCommand(target.Status.PodIP))
+	if err != nil {
+		result.ErrorClass = ClassifyProbeError(err)
+		result.Error = err.Error()
+		return result
+	}
+
+	result.Reachable = true
+	if rtt, ok := ParsePingRTT(output); ok {
+		result.RTT = rtt
+	}
+	return result
+}
+
+// RunNetworkTest probes all pairs of the selected test pods of the config, batched with config.Batch
+func RunNetworkTest(ctx context.Context, clientset kubernetes.Interface, restConfig *rest.Config, config *Config) (*Report, error) {
+	pods, err := SelectTestPods(ctx, clientset, config)
+	if err != nil {
+		return nil, err
+	}
+	return ProbePods(ctx, clientset, restConfig, config.Namespace, pods, config.Batch), nil
+}
 
-			err = exec.StreamWithContext(ctx, remotecommand.StreamOptions{
-				Stdin:  os.Stdin,
-				Stdout: os.Stdout,
-				Stderr: os.Stderr,
-				Tty:    false,
-			})
-			if err != nil {
-				fmt.Printf("%s can NOT reach %s\n", upod.Spec.NodeName, pod.Spec.NodeName)
-			} else {
-				fmt.Printf("%s can reach %s\n", upod.Spec.NodeName, pod.Spec.NodeName)
+// ProbePods probes all pairs of the given pods, with one exec per pair or one exec per source pod (batch)
+func ProbePods(ctx context.Context, clientset kubernetes.Interface, config *rest.Config, namespace string, pods []core.Pod, batch bool) *Report {
+	report := &Report{
+		StartTime: time.Now(),
+		Nodes:     GetNodeInfo(ctx, clientset, pods),
+		Results:   []ProbeResult{},
+	}
+
+	for _, source := range pods {
+		if batch {
+			report.Results = append(report.Results, BatchProbePod(ctx, clientset, config, namespace, source, pods)...)
+			continue
+		}
+		for _, target := range pods {
+			report.Results = append(report.Results, ProbePod(ctx, clientset, config, namespace, source, target))
+		}
+	}
+	report.Duration = time.Since(report.StartTime)
+	return report
+}
+
+// CreateBatchPingCommand creates a single command pinging all target IPs in parallel.
+// Every target produces one line "<ip> <exit code> <last line of ping output>".
+// Invalid IPs are skipped as they would end up in a shell command.
+func CreateBatchPingCommand(targetIPs []string) []string {
+	var script strings.Builder
+	for _, ip := range targetIPs {
+		if !ValidatePodIP(ip) {
+			continue
+		}
+		fmt.Fprintf(&script, "(out=$(%s 2>&1); echo \"%s $? $(echo \"$out\" | tail -n 1)\") & ", strings.Join(CreatePingProbeCommand(ip), " "), ip)
+	}
+	script.WriteString("wait")
+	return []string{"sh", "-c", script.String()}
+}
+
+// BatchLine is the parsed result of one target of a batch ping
+type BatchLine struct {
+	ExitCode int
+	Summary  string
+}
+
+// ParseBatchOutput parses the output of a batch ping command keyed by target IP
+func ParseBatchOutput(output string) map[string]BatchLine {
+	lines := make(map[string]BatchLine)
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.SplitN(strings.TrimSpace(line), " ", 3)
+		if len(fields) < 2 || !ValidatePodIP(fields[0]) {
+			continue
+		}
+		code, err := strconv.Atoi(fields[1])
+		if err != nil {
+			continue
+		}
+		parsed := BatchLine{ExitCode: code}
+		if len(fields) == 3 {
+			parsed.Summary = fields[2]
+		}
+		lines[fields[0]] = parsed
+	}
+	return lines
+}
+
+// BatchProbePod pings all target pods from the source pod with a single exec
+func BatchProbePod(ctx context.Context, clientset kubernetes.Interface, config *rest.Config, namespace string, source core.Pod, targets []core.Pod) []ProbeResult {
+	targetIPs := make([]string, 0, len(targets))
+	for _, target := range targets {
+		targetIPs = append(targetIPs, target.Status.PodIP)
+	}
+
+	output, execErr := ExecInPod(ctx, clientset, config, namespace, source.ObjectMeta.Name, CreateBatchPingCommand(targetIPs))
+	lines := ParseBatchOutput(output)
+
+	results := make([]ProbeResult, 0, len(targets))
+	for _, target := range targets {
+		result := ProbeResult{
+			SourceNode: source.Spec.NodeName,
+			TargetNode: target.Spec.NodeName,
+			TargetIP:   target.Status.PodIP,
+		}
+
+		line, ok := lines[target.Status.PodIP]
+		switch {
+		case !ok && execErr != nil:
+			result.ErrorClass = ErrorClassExec
+			result.Error = execErr.Error()
+		case !ok:
+			result.ErrorClass = ErrorClassExec
+			result.Error = "no result for target"
+		case line.ExitCode != 0:
+			err := utilexec.CodeExitError{Err: fmt.Errorf("ping exited with code %d: %s", line.ExitCode, line.Summary), Code: line.ExitCode}
+			result.ErrorClass = ClassifyProbeError(err)
+			result.Error = err.Error()
+		default:
+			result.Reachable = true
+			if rtt, ok := ParsePingRTT(line.Summary); ok {
+				result.RTT = rtt
 			}
 		}
+		results = append(results, result)
+	}
+	return results
+}
+
+// RunBatchNetworkTest probes all pairs of the selected test pods of the config with one exec per source pod
+func RunBatchNetworkTest(ctx context.Context, clientset kubernetes.Interface, restConfig *rest.Config, config *Config) (*Report, error) {
+	pods, err := SelectTestPods(ctx, clientset, config)
+	if err != nil {
+		return nil, err
 	}
-	return nil
+	return ProbePods(ctx, clientset, restConfig, config.Namespace, pods, true), nil
 }
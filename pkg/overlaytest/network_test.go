@@ -2,10 +2,15 @@ package overlaytest
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"strings"
 	"testing"
+	"time"
 
 	"k8s.io/client-go/kubernetes/fake"
 	"k8s.io/client-go/rest"
+	utilexec "k8s.io/client-go/util/exec"
 )
 
 func TestCreatePingCommand(t *testing.T) {
@@ -205,7 +210,7 @@ func TestCreatePingCommandEdgeCases(t *testing.T) {
 
 func TestRunNetworkTest(t *testing.T) {
 	ctx := context.Background()
-	namespace := "test-namespace"
+	config := &Config{Namespace: "test-namespace", AppName: "overlaytest"}
 
 	t.Run("No pods in namespace", func(t *testing.T) {
 		clientset := fake.NewSimpleClientset()
@@ -214,10 +219,13 @@ func TestRunNetworkTest(t *testing.T) {
 			Host: "https://localhost:6443",
 		}
 
-		err := RunNetworkTest(ctx, clientset, restConfig, namespace)
+		report, err := RunNetworkTest(ctx, clientset, restConfig, config)
 		if err != nil {
 			t.Errorf("Expected no error with empty pod list, got: %v", err)
 		}
+		if report == nil || len(report.Results) != 0 {
+			t.Errorf("Expected empty report, got: %v", report)
+		}
 	})
 
 	t.Run("List pods error handling", func(t *testing.T) {
@@ -227,7 +235,7 @@ func TestRunNetworkTest(t *testing.T) {
 		restConfig := &rest.Config{Host: "https://localhost:6443"}
 
 		// Should handle empty pod list gracefully
-		err := RunNetworkTest(ctx, clientset, restConfig, namespace)
+		_, err := RunNetworkTest(ctx, clientset, restConfig, config)
 		// No error expected with empty pod list
 		if err != nil {
 			t.Errorf("Unexpected error: %v", err)
@@ -409,3 +417,158 @@ func containsHelper(s, substr string) bool {
 	}
 	return false
 }
+
+func TestParsePingRTT(t *testing.T) {
+	tests := []struct {
+		name     string
+		output   string
+		expected time.Duration
+		ok       bool
+	}{
+		{
+			name:     "iputils summary",
+			output:   "--- 10.244.0.1 ping statistics ---\n2 packets transmitted, 2 received, 0% packet loss, time 1001ms\nrtt min/avg/max/mdev = 0.041/0.500/0.959/0.459 ms\n",
+			expected: 500 * time.Microsecond,
+			ok:       true,
+		},
+		{
+			name:     "busybox summary",
+			output:   "2 packets transmitted, 2 packets received, 0% packet loss\nround-trip min/avg/max = 1.000/2.000/3.000 ms\n",
+			expected: 2 * time.Millisecond,
+			ok:       true,
+		},
+		{
+			name:   "No summary",
+			output: "2 packets transmitted, 0 received, 100% packet loss, time 1001ms\n",
+			ok:     false,
+		},
+		{
+			name:   "Empty output",
+			output: "",
+			ok:     false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rtt, ok := ParsePingRTT(tt.output)
+			if ok != tt.ok {
+				t.Fatalf("Expected ok %t, got %t", tt.ok, ok)
+			}
+			if rtt != tt.expected {
+				t.Errorf("Expected RTT %s, got %s", tt.expected, rtt)
+			}
+		})
+	}
+}
+
+func TestClassifyProbeError(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		expected string
+	}{
+		{
+			name:     "No reply",
+			err:      utilexec.CodeExitError{Err: errors.New("command terminated with exit code 1"), Code: 1},
+			expected: ErrorClassUnreachable,
+		},
+		{
+			name:     "Ping error",
+			err:      utilexec.CodeExitError{Err: errors.New("command terminated with exit code 2"), Code: 2},
+			expected: ErrorClassProbe,
+		},
+		{
+			name:     "Wrapped exit error",
+			err:      fmt.Errorf("probe: %w", utilexec.CodeExitError{Err: errors.New("exit 1"), Code: 1}),
+			expected: ErrorClassUnreachable,
+		},
+		{
+			name:     "Transport error",
+			err:      errors.New("error dialing backend"),
+			expected: ErrorClassExec,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if class := ClassifyProbeError(tt.err); class != tt.expected {
+				t.Errorf("Expected class %s, got %s", tt.expected, class)
+			}
+		})
+	}
+}
+
+func TestCreatePingProbeCommand(t *testing.T) {
+	cmd := CreatePingProbeCommand("10.244.0.1")
+	expected := []string{"ping", "-c", "2", "-q", "10.244.0.1"}
+
+	if len(cmd) != len(expected) {
+		t.Fatalf("Expected command %v, got %v", expected, cmd)
+	}
+	for i := range expected {
+		if cmd[i] != expected[i] {
+			t.Errorf("Expected command part %d to be %s, got %s", i, expected[i], cmd[i])
+		}
+	}
+}
+
+func TestCreateBatchPingCommand(t *testing.T) {
+	cmd := CreateBatchPingCommand([]string{"10.244.0.1", "10.244.0.1; rm -rf /", "2001:db8::1"})
+
+	if len(cmd) != 3 || cmd[0] != "sh" || cmd[1] != "-c" {
+		t.Fatalf("Expected shell command, got %v", cmd)
+	}
+	if !strings.Contains(cmd[2], "ping -c 2 -q 10.244.0.1 2>&1") {
+		t.Errorf("Expected ping of 10.244.0.1, got %s", cmd[2])
+	}
+	if !strings.Contains(cmd[2], "ping -c 2 -q 2001:db8::1 2>&1") {
+		t.Errorf("Expected ping of 2001:db8::1, got %s", cmd[2])
+	}
+	if strings.Contains(cmd[2], "rm -rf") {
+		t.Errorf("Expected invalid IP to be skipped, got %s", cmd[2])
+	}
+	if !strings.HasSuffix(cmd[2], "wait") {
+		t.Errorf("Expected command to wait for all pings, got %s", cmd[2])
+	}
+}
+
+func TestParseBatchOutput(t *testing.T) {
+	output := "10.244.1.1 1 2 packets transmitted, 0 received, 100% packet loss, time 1001ms\n" +
+		"10.244.0.1 0 rtt min/avg/max/mdev = 0.041/0.500/0.959/0.459 ms\n" +
+		"garbage line\n" +
+		"10.244.2.1 x\n" +
+		"2001:db8::1 2\n"
+
+	lines := ParseBatchOutput(output)
+
+	if len(lines) != 3 {
+		t.Fatalf("Expected 3 parsed lines, got %d: %v", len(lines), lines)
+	}
+	if lines["10.244.0.1"].ExitCode != 0 {
+		t.Errorf("Expected exit code 0, got %d", lines["10.244.0.1"].ExitCode)
+	}
+	if rtt, ok := ParsePingRTT(lines["10.244.0.1"].Summary); !ok || rtt != 500*time.Microsecond {
+		t.Errorf("Expected RTT 500µs from summary, got %s", rtt)
+	}
+	if lines["10.244.1.1"].ExitCode != 1 {
+		t.Errorf("Expected exit code 1, got %d", lines["10.244.1.1"].ExitCode)
+	}
+	if lines["2001:db8::1"].ExitCode != 2 || lines["2001:db8::1"].Summary != "" {
+		t.Errorf("Expected exit code 2 without summary, got %+v", lines["2001:db8::1"])
+	}
+}
+
+func TestRunBatchNetworkTest(t *testing.T) {
+	ctx := context.Background()
+	clientset := fake.NewSimpleClientset()
+	restConfig := &rest.Config{Host: "https://localhost:6443"}
+
+	report, err := RunBatchNetworkTest(ctx, clientset, restConfig, &Config{Namespace: "test-namespace", AppName: "overlaytest"})
+	if err != nil {
+		t.Errorf("Expected no error with empty pod list, got: %v", err)
+	}
+	if report == nil || len(report.Results) != 0 {
+		t.Errorf("Expected empty report, got: %v", report)
+	}
+}
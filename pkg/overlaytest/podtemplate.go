@@ -0,0 +1,126 @@
+package overlaytest
+
+import (
+	"encoding/json"
+	"fmt"
+
+	apps "k8s.io/api/apps/v1"
+	core "k8s.io/api/core/v1"
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/strategicpatch"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"sigs.k8s.io/yaml"
+)
+
+// PodTemplateOverrides customizes the pod template of the test DaemonSet
+type PodTemplateOverrides struct {
+	// Labels and Annotations are added to the pods, the app label can not be changed
+	Labels      map[string]string `json:"labels,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+	// NodeSelector restricts the nodes the pods are scheduled on
+	NodeSelector map[string]string `json:"nodeSelector,omitempty"`
+	// Tolerations replace the default toleration of all taints
+	Tolerations []core.Toleration `json:"tolerations,omitempty"`
+	// ImagePullSecrets are the names of secrets in the test namespace
+	ImagePullSecrets  []string `json:"imagePullSecrets,omitempty"`
+	PriorityClassName string   `json:"priorityClassName,omitempty"`
+	// Resources replace the default requests and limits of the test container
+	Resources *core.ResourceRequirements `json:"resources,omitempty"`
+}
+
+// Apply sets the overrides on the pod template of the DaemonSet
+func (o *PodTemplateOverrides) Apply(daemonset *apps.DaemonSet) {
+	template := &daemonset.Spec.Template
+
+	for key, value := range o.Labels {
+		if _, ok := daemonset.Spec.Selector.MatchLabels[key]; ok {
+			continue
+		}
+		if template.Labels == nil {
+			template.Labels = map[string]string{}
+		}
+		template.Labels[key] = value
+	}
+	for key, value := range o.Annotations {
+		if template.Annotations == nil {
+			template.Annotations = map[string]string{}
+		}
+		template.Annotations[key] = value
+	}
+	if len(o.NodeSelector) > 0 {
+		template.Spec.NodeSelector = o.NodeSelector
+	}
+	if o.Tolerations != nil {
+		template.Spec.Tolerations = o.Tolerations
+	}
+	for _, secret := range o.ImagePullSecrets {
+		template.Spec.ImagePullSecrets = append(template.Spec.ImagePullSecrets, core.LocalObjectReference{Name: secret})
+	}
+	if o.PriorityClassName != "" {
+		template.Spec.PriorityClassName = o.PriorityClassName
+	}
+	if o.Resources != nil {
+		template.Spec.Containers[0].Resources = *o.Resources
+	}
+}
+
+// Validate checks the overrides for invalid names
+func (o *PodTemplateOverrides) Validate() []error {
+	var errs []error
+	if _, ok := o.Labels["app"]; ok {
+		errs = append(errs, fmt.Errorf("pod template label \"app\" is reserved for the DaemonSet selector"))
+	}
+	for _, secret := range o.ImagePullSecrets {
+		for _, msg := range validation.IsDNS1123Subdomain(secret) {
+			errs = append(errs, fmt.Errorf("image pull secret %q: %s", secret, msg))
+		}
+	}
+	if o.PriorityClassName != "" {
+		for _, msg := range validation.IsDNS1123Subdomain(o.PriorityClassName) {
+			errs = append(errs, fmt.Errorf("priority class %q: %s", o.PriorityClassName, msg))
+		}
+	}
+	return errs
+}
+
+// PatchDaemonSet applies a strategic merge patch in YAML or JSON to the DaemonSet.
+// The patch must keep the selector and the pod labels matching it.
+func PatchDaemonSet(daemonset *apps.DaemonSet, patch string) (*apps.DaemonSet, error) {
+	patchJSON, err := yaml.YAMLToJSON([]byte(patch))
+	if err != nil {
+		return nil, fmt.Errorf("invalid daemonset patch: %w", err)
+	}
+	original, err := json.Marshal(daemonset)
+	if err != nil {
+		return nil, err
+	}
+	patched, err := strategicpatch.StrategicMergePatch(original, patchJSON, apps.DaemonSet{})
+	if err != nil {
+		return nil, fmt.Errorf("error applying daemonset patch: %w", err)
+	}
+
+	result := &apps.DaemonSet{}
+	if err := json.Unmarshal(patched, result); err != nil {
+		return nil, fmt.Errorf("error applying daemonset patch: %w", err)
+	}
+	if !apiequality.Semantic.DeepEqual(result.Spec.Selector, daemonset.Spec.Selector) {
+		return nil, fmt.Errorf("daemonset patch must not change the selector")
+	}
+	if !labels.SelectorFromSet(daemonset.Spec.Selector.MatchLabels).Matches(labels.Set(result.Spec.Template.Labels)) {
+		return nil, fmt.Errorf("daemonset patch must not change the app label")
+	}
+	if len(result.Spec.Template.Spec.Containers) == 0 {
+		return nil, fmt.Errorf("daemonset patch removed the test container")
+	}
+	return result, nil
+}
+
+// CustomizeDaemonSet applies the pod template overrides and the daemonset patch of the config
+func CustomizeDaemonSet(daemonset *apps.DaemonSet, config *Config) (*apps.DaemonSet, error) {
+	config.PodTemplate.Apply(daemonset)
+	if config.DaemonSetPatch == "" {
+		return daemonset, nil
+	}
+	return PatchDaemonSet(daemonset, config.DaemonSetPatch)
+}
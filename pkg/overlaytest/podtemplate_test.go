@@ -0,0 +1,158 @@
+package overlaytest
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	core "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestPodTemplateOverridesApply(t *testing.T) {
+	daemonset := CreateDaemonSetSpec("test-ns", "overlaytest", "test-image")
+	overrides := PodTemplateOverrides{
+		Labels:            map[string]string{"team": "network", "app": "other"},
+		Annotations:       map[string]string{"policy/owner": "network"},
+		NodeSelector:      map[string]string{"kubernetes.io/os": "linux"},
+		Tolerations:       []core.Toleration{{Key: "dedicated", Operator: core.TolerationOpEqual, Value: "net", Effect: core.TaintEffectNoSchedule}},
+		ImagePullSecrets:  []string{"registry"},
+		PriorityClassName: "system-node-critical",
+		Resources: &core.ResourceRequirements{
+			Requests: core.ResourceList{core.ResourceCPU: resource.MustParse("10m")},
+		},
+	}
+	overrides.Apply(daemonset)
+
+	template := daemonset.Spec.Template
+	if template.Labels["team"] != "network" {
+		t.Errorf("Expected team label, got %v", template.Labels)
+	}
+	if template.Labels["app"] != "overlaytest" {
+		t.Errorf("Expected app label to be kept, got %s", template.Labels["app"])
+	}
+	if template.Annotations["policy/owner"] != "network" {
+		t.Errorf("Expected annotation, got %v", template.Annotations)
+	}
+	if template.Spec.NodeSelector["kubernetes.io/os"] != "linux" {
+		t.Errorf("Expected node selector, got %v", template.Spec.NodeSelector)
+	}
+	if !reflect.DeepEqual(template.Spec.Tolerations, overrides.Tolerations) {
+		t.Errorf("Expected tolerations %v, got %v", overrides.Tolerations, template.Spec.Tolerations)
+	}
+	if len(template.Spec.ImagePullSecrets) != 1 || template.Spec.ImagePullSecrets[0].Name != "registry" {
+		t.Errorf("Expected image pull secret, got %v", template.Spec.ImagePullSecrets)
+	}
+	if template.Spec.PriorityClassName != "system-node-critical" {
+		t.Errorf("Expected priority class, got %s", template.Spec.PriorityClassName)
+	}
+	if _, ok := template.Spec.Containers[0].Resources.Limits[core.ResourceMemory]; ok {
+		t.Error("Expected resources to be replaced")
+	}
+}
+
+func TestPodTemplateOverridesEmpty(t *testing.T) {
+	daemonset := CreateDaemonSetSpec("test-ns", "overlaytest", "test-image")
+	(&PodTemplateOverrides{}).Apply(daemonset)
+
+	if !reflect.DeepEqual(daemonset, CreateDaemonSetSpec("test-ns", "overlaytest", "test-image")) {
+		t.Error("Expected empty overrides to keep the spec unchanged")
+	}
+}
+
+func TestPodTemplateOverridesValidate(t *testing.T) {
+	overrides := PodTemplateOverrides{
+		Labels:            map[string]string{"app": "other"},
+		ImagePullSecrets:  []string{"Registry_Secret"},
+		PriorityClassName: "High",
+	}
+	if errs := overrides.Validate(); len(errs) != 3 {
+		t.Errorf("Expected 3 errors, got %v", errs)
+	}
+	if errs := (&PodTemplateOverrides{ImagePullSecrets: []string{"registry"}}).Validate(); len(errs) != 0 {
+		t.Errorf("Expected no errors, got %v", errs)
+	}
+}
+
+func TestPatchDaemonSet(t *testing.T) {
+	daemonset := CreateDaemonSetSpec("test-ns", "overlaytest", "test-image")
+
+	t.Run("Strategic merge of containers", func(t *testing.T) {
+		patch := `
+spec:
+  template:
+    metadata:
+      labels:
+        policy: required
+    spec:
+      hostNetwork: false
+      containers:
+      - name: overlaytest
+        env:
+        - name: HTTP_PROXY
+          value: http://proxy:3128
+`
+		patched, err := PatchDaemonSet(daemonset, patch)
+		if err != nil {
+			t.Fatalf("Expected no error, got: %v", err)
+		}
+		container := patched.Spec.Template.Spec.Containers[0]
+		if container.Image != "test-image" {
+			t.Errorf("Expected container to be merged by name, got image %q", container.Image)
+		}
+		if len(container.Env) != 1 || container.Env[0].Name != "HTTP_PROXY" {
+			t.Errorf("Expected env from patch, got %v", container.Env)
+		}
+		if patched.Spec.Template.Labels["policy"] != "required" || patched.Spec.Template.Labels["app"] != "overlaytest" {
+			t.Errorf("Expected merged labels, got %v", patched.Spec.Template.Labels)
+		}
+	})
+
+	errorTests := []struct {
+		name  string
+		patch string
+	}{
+		{"Invalid YAML", "spec: ["},
+		{"Changed app label", `{"spec":{"template":{"metadata":{"labels":{"app":"other"}}}}}`},
+		{"Added selector label", `{"spec":{"selector":{"matchLabels":{"tier":"net"}},"template":{"metadata":{"labels":{"tier":"net"}}}}}`},
+		{"Added selector expression", `{"spec":{"selector":{"matchExpressions":[{"key":"app","operator":"Exists"}]}}}`},
+		{"Removed container", `{"spec":{"template":{"spec":{"containers":[{"name":"overlaytest","$patch":"delete"}]}}}}`},
+	}
+	for _, tt := range errorTests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := PatchDaemonSet(daemonset, tt.patch); err == nil {
+				t.Error("Expected error")
+			}
+		})
+	}
+}
+
+func TestCreateOrReuseDaemonSetCustomized(t *testing.T) {
+	clientset := fake.NewSimpleClientset()
+	config := DefaultConfig()
+	config.Namespace = "test-ns"
+	config.PodTemplate.ImagePullSecrets = []string{"registry"}
+	config.DaemonSetPatch = "spec:\n  template:\n    spec:\n      priorityClassName: overlay\n"
+
+	if err := CreateOrReuseDaemonSet(context.Background(), clientset, config, false); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	daemonset, err := clientset.AppsV1().DaemonSets("test-ns").Get(context.Background(), config.AppName, meta.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if daemonset.Spec.Template.Spec.PriorityClassName != "overlay" {
+		t.Errorf("Expected patched priority class, got %q", daemonset.Spec.Template.Spec.PriorityClassName)
+	}
+	if len(daemonset.Spec.Template.Spec.ImagePullSecrets) != 1 {
+		t.Errorf("Expected image pull secret, got %v", daemonset.Spec.Template.Spec.ImagePullSecrets)
+	}
+
+	config.DaemonSetPatch = "spec: ["
+	if err := config.Validate(); err == nil || !strings.Contains(err.Error(), "patch") {
+		t.Errorf("Expected patch error from Validate, got: %v", err)
+	}
+}
@@ -0,0 +1,232 @@
+package overlaytest
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+
+	authorization "k8s.io/api/authorization/v1"
+	rbac "k8s.io/api/rbac/v1"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"sigs.k8s.io/yaml"
+)
+
+// Permission is a verb on a resource needed by a test run
+type Permission struct {
+	Group       string
+	Resource    string
+	Subresource string
+	Verb        string
+	// Namespace is empty for cluster scoped resources
+	Namespace string
+}
+
+// String describes the permission like "create pods/exec in namespace kube-system"
+func (p Permission) String() string {
+	resource := p.Resource
+	if p.Subresource != "" {
+		resource += "/" + p.Subresource
+	}
+	if p.Group != "" {
+		resource += "." + p.Group
+	}
+	if p.Namespace == "" {
+		return fmt.Sprintf("%s %s (cluster scope)", p.Verb, resource)
+	}
+	return fmt.Sprintf("%s %s in namespace %s", p.Verb, resource, p.Namespace)
+}
+
+// RequiredPermissions returns the permissions a test run with the config needs
+func RequiredPermissions(config *Config) []Permission {
+	ns := config.Namespace
+	var permissions []Permission
+	add := func(group, resource, subresource, namespace string, verbs ...string) {
+		for _, verb := range verbs {
+			permission := Permission{Group: group, Resource: resource, Subresource: subresource, Verb: verb, Namespace: namespace}
+			if !slices.Contains(permissions, permission) {
+				permissions = append(permissions, permission)
+			}
+		}
+	}
+
+	if config.Reuse {
+		add("apps", "daemonsets", "", ns, "get")
+	} else {
+		add("apps", "daemonsets", "", ns, "create", "delete", "get")
+	}
+	add("", "pods", "", ns, "list", "get")
+	if config.Agent {
+		add("", "pods", "proxy", ns, "get")
+		if !config.Reuse {
+			add("", "services", "", ns, "create", "delete")
+		}
+	}
+	if !config.Agent || config.Traceroute != "" || config.LatencySamples > 0 {
+		add("", "pods", "exec", ns, "create")
+	}
+	// The node coverage check lists all nodes matching the node selector
+	add("", "nodes", "", "", "get", "list")
+	if !config.SkipCNI {
+		// The CNI agents run in kube-system or the namespace of a CNI operator
+		add("apps", "daemonsets", "", "", "list")
+		add("", "pods", "", "", "list")
+		add("", "configmaps", "", meta.NamespaceSystem, "get")
+	}
+	if config.DiagnosticsDir != "" && !config.Monitor {
+		// The bundle holds the events, the addresses and routes in the test pods and the CNI agent logs
+		add("", "events", "", ns, "list")
+		add("", "pods", "exec", ns, "create")
+		if !config.SkipCNI {
+			add("", "pods", "", "", "get")
+			add("", "pods", "log", "", "get")
+		}
+	}
+	if config.Events {
+		// Events of nodes are recorded in the default namespace
+		add("", "events", "", ns, "create", "patch")
+		if ns != meta.NamespaceDefault {
+			add("", "events", "", meta.NamespaceDefault, "create", "patch")
+		}
+	}
+	if config.CreateNamespace && !config.Reuse {
+		add("", "namespaces", "", "", "get", "create", "update", "delete")
+	}
+	if config.HistoryConfigMap {
+		add("", "configmaps", "", ns, "get", "create", "update")
+	}
+	return permissions
+}
+
+// DiagnosticsPermissions returns the permissions of RequiredPermissions which only the diagnostics
+// bundle needs. A run lacking them skips the bundle.
+func DiagnosticsPermissions(config *Config) []Permission {
+	withoutBundle := *config
+	withoutBundle.DiagnosticsDir = ""
+	base := RequiredPermissions(&withoutBundle)
+	return slices.DeleteFunc(RequiredPermissions(config), func(permission Permission) bool {
+		return slices.Contains(base, permission)
+	})
+}
+
+// CheckPermissions asks the API server with a SelfSubjectAccessReview for every permission
+// and returns the permissions which are not granted
+func CheckPermissions(ctx context.Context, clientset kubernetes.Interface, permissions []Permission) ([]Permission, error) {
+	var missing []Permission
+	for _, permission := range permissions {
+		review := &authorization.SelfSubjectAccessReview{
+			Spec: authorization.SelfSubjectAccessReviewSpec{
+				ResourceAttributes: &authorization.ResourceAttributes{
+					Namespace:   permission.Namespace,
+					Verb:        permission.Verb,
+					Group:       permission.Group,
+					Resource:    permission.Resource,
+					Subresource: permission.Subresource,
+				},
+			},
+		}
+		result, err := clientset.AuthorizationV1().SelfSubjectAccessReviews().Create(ctx, review, meta.CreateOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("error checking permission to %s: %w", permission, err)
+		}
+		if !result.Status.Allowed {
+			missing = append(missing, permission)
+		}
+	}
+	return missing, nil
+}
+
+// RBACManifest renders a ClusterRole for the cluster scoped permissions and a Role per namespace
+// for the namespaced permissions. Bindings to the user or ServiceAccount are left to the caller.
+func RBACManifest(name string, permissions []Permission) ([]byte, error) {
+	clusterRole, roles := rbacRoles(name, permissions)
+	var objects []any
+	if clusterRole != nil {
+		objects = append(objects, clusterRole)
+	}
+	for _, role := range roles {
+		objects = append(objects, role)
+	}
+	return marshalManifest(objects)
+}
+
+// rbacRoles returns the ClusterRole of the cluster scoped permissions, nil if there are none,
+// and a Role per namespace sorted by namespace
+func rbacRoles(name string, permissions []Permission) (*rbac.ClusterRole, []*rbac.Role) {
+	byNamespace := map[string][]Permission{}
+	for _, permission := range permissions {
+		byNamespace[permission.Namespace] = append(byNamespace[permission.Namespace], permission)
+	}
+
+	var clusterRole *rbac.ClusterRole
+	var roles []*rbac.Role
+	for _, namespace := range sortedKeys(byNamespace) {
+		rules := policyRules(byNamespace[namespace])
+		if namespace == "" {
+			clusterRole = &rbac.ClusterRole{
+				TypeMeta:   meta.TypeMeta{APIVersion: "rbac.authorization.k8s.io/v1", Kind: "ClusterRole"},
+				ObjectMeta: meta.ObjectMeta{Name: name},
+				Rules:      rules,
+			}
+			continue
+		}
+		roles = append(roles, &rbac.Role{
+			TypeMeta:   meta.TypeMeta{APIVersion: "rbac.authorization.k8s.io/v1", Kind: "Role"},
+			ObjectMeta: meta.ObjectMeta{Name: name, Namespace: namespace},
+			Rules:      rules,
+		})
+	}
+	return clusterRole, roles
+}
+
+// marshalManifest renders the objects as multi-document YAML
+func marshalManifest(objects []any) ([]byte, error) {
+	var buf bytes.Buffer
+	for i, object := range objects {
+		data, err := yaml.Marshal(object)
+		if err != nil {
+			return nil, err
+		}
+		if i > 0 {
+			buf.WriteString("---\n")
+		}
+		buf.Write(data)
+	}
+	return buf.Bytes(), nil
+}
+
+// policyRules merges the verbs of every resource into one rule
+func policyRules(permissions []Permission) []rbac.PolicyRule {
+	type key struct{ group, resource string }
+	verbs := map[key][]string{}
+	var keys []key
+	for _, permission := range permissions {
+		resource := permission.Resource
+		if permission.Subresource != "" {
+			resource += "/" + permission.Subresource
+		}
+		k := key{permission.Group, resource}
+		if _, ok := verbs[k]; !ok {
+			keys = append(keys, k)
+		}
+		verbs[k] = append(verbs[k], permission.Verb)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].group != keys[j].group {
+			return keys[i].group < keys[j].group
+		}
+		return keys[i].resource < keys[j].resource
+	})
+
+	rules := make([]rbac.PolicyRule, 0, len(keys))
+	for _, k := range keys {
+		rules = append(rules, rbac.PolicyRule{
+			APIGroups: []string{k.group},
+			Resources: []string{k.resource},
+			Verbs:     verbs[k],
+		})
+	}
+	return rules
+}
@@ -0,0 +1,221 @@
+package overlaytest
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+
+	authorization "k8s.io/api/authorization/v1"
+	rbac "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+	"sigs.k8s.io/yaml"
+)
+
+func hasPermission(permissions []Permission, resource, subresource, verb string) bool {
+	for _, permission := range permissions {
+		if permission.Resource == resource && permission.Subresource == subresource && permission.Verb == verb {
+			return true
+		}
+	}
+	return false
+}
+
+func TestRequiredPermissions(t *testing.T) {
+	t.Run("Exec mode", func(t *testing.T) {
+		permissions := RequiredPermissions(DefaultConfig())
+		if !hasPermission(permissions, "pods", "exec", "create") {
+			t.Error("Expected pods/exec create")
+		}
+		if !hasPermission(permissions, "daemonsets", "", "delete") {
+			t.Error("Expected daemonsets delete")
+		}
+		if hasPermission(permissions, "services", "", "create") || hasPermission(permissions, "events", "", "create") {
+			t.Error("Expected no services or events permissions")
+		}
+	})
+
+	t.Run("Default config checks node coverage", func(t *testing.T) {
+		config := DefaultConfig()
+		if config.NodeSelector != "" {
+			t.Fatalf("Expected no node selector by default, got %q", config.NodeSelector)
+		}
+		permissions := RequiredPermissions(config)
+		for _, verb := range []string{"get", "list"} {
+			if !hasPermission(permissions, "nodes", "", verb) {
+				t.Errorf("Expected %s nodes", verb)
+			}
+		}
+		if !hasPermission(permissions, "daemonsets", "", "get") {
+			t.Error("Expected daemonsets get")
+		}
+	})
+
+	t.Run("Agent mode with events and namespace", func(t *testing.T) {
+		config := DefaultConfig()
+		config.Namespace = "overlaytest"
+		config.Agent = true
+		config.Events = true
+		config.CreateNamespace = true
+		// The diagnostics bundle execs into the test pods
+		config.DiagnosticsDir = ""
+		permissions := RequiredPermissions(config)
+
+		for _, expected := range []struct{ resource, subresource, verb string }{
+			{"pods", "proxy", "get"},
+			{"services", "", "create"},
+			{"events", "", "patch"},
+			{"namespaces", "", "delete"},
+		} {
+			if !hasPermission(permissions, expected.resource, expected.subresource, expected.verb) {
+				t.Errorf("Expected %s %s/%s", expected.verb, expected.resource, expected.subresource)
+			}
+		}
+		if hasPermission(permissions, "pods", "exec", "create") {
+			t.Error("Expected no pods/exec in agent mode")
+		}
+	})
+
+	t.Run("CNI detection", func(t *testing.T) {
+		config := DefaultConfig()
+		permissions := RequiredPermissions(config)
+		for _, permission := range []Permission{
+			{Group: "apps", Resource: "daemonsets", Verb: "list"},
+			{Resource: "pods", Verb: "list"},
+			{Resource: "configmaps", Verb: "get", Namespace: "kube-system"},
+		} {
+			if !slices.Contains(permissions, permission) {
+				t.Errorf("Expected %s", permission)
+			}
+		}
+
+		config.SkipCNI = true
+		for _, permission := range RequiredPermissions(config) {
+			if permission.Namespace == "" && permission.Resource != "nodes" {
+				t.Errorf("Expected no cluster wide %s with skip-cni", permission)
+			}
+		}
+	})
+
+	t.Run("Diagnostics bundle", func(t *testing.T) {
+		config := DefaultConfig()
+		config.Agent = true
+		config.DiagnosticsDir = ""
+		if hasPermission(RequiredPermissions(config), "events", "", "list") {
+			t.Error("Expected no events list without diagnostics dir")
+		}
+		if permissions := DiagnosticsPermissions(config); len(permissions) != 0 {
+			t.Errorf("Expected no diagnostics permissions without diagnostics dir, got %v", permissions)
+		}
+
+		config.DiagnosticsDir = "bundles"
+		permissions := RequiredPermissions(config)
+		for _, permission := range []Permission{
+			{Resource: "events", Verb: "list", Namespace: "kube-system"},
+			{Resource: "pods", Subresource: "exec", Verb: "create", Namespace: "kube-system"},
+			{Resource: "pods", Verb: "get"},
+			{Resource: "pods", Subresource: "log", Verb: "get"},
+		} {
+			if !slices.Contains(permissions, permission) {
+				t.Errorf("Expected %s", permission)
+			}
+		}
+
+		// Exec mode needs pods/exec anyway, it is listed once
+		config.Agent = false
+		count := 0
+		for _, permission := range RequiredPermissions(config) {
+			if permission.Subresource == "exec" {
+				count++
+			}
+		}
+		if count != 1 {
+			t.Errorf("Expected pods/exec once, got %d", count)
+		}
+
+		// The probes need pods/exec as well, only the bundle is skipped without the others
+		diagnostics := DiagnosticsPermissions(config)
+		if len(diagnostics) != 3 || slices.ContainsFunc(diagnostics, func(p Permission) bool { return p.Subresource == "exec" }) {
+			t.Errorf("Expected events list, pods get and pods/log get, got %v", diagnostics)
+		}
+	})
+
+	t.Run("Reuse", func(t *testing.T) {
+		config := DefaultConfig()
+		config.Reuse = true
+		if hasPermission(RequiredPermissions(config), "daemonsets", "", "create") {
+			t.Error("Expected no daemonsets create when reusing")
+		}
+	})
+}
+
+func TestPermissionString(t *testing.T) {
+	tests := []struct {
+		permission Permission
+		expected   string
+	}{
+		{Permission{Resource: "pods", Subresource: "exec", Verb: "create", Namespace: "ns"}, "create pods/exec in namespace ns"},
+		{Permission{Group: "apps", Resource: "daemonsets", Verb: "get", Namespace: "ns"}, "get daemonsets.apps in namespace ns"},
+		{Permission{Resource: "nodes", Verb: "get"}, "get nodes (cluster scope)"},
+	}
+	for _, tt := range tests {
+		if s := tt.permission.String(); s != tt.expected {
+			t.Errorf("Expected %q, got %q", tt.expected, s)
+		}
+	}
+}
+
+func TestCheckPermissions(t *testing.T) {
+	clientset := fake.NewSimpleClientset()
+	clientset.PrependReactor("create", "selfsubjectaccessreviews", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		review := action.(k8stesting.CreateAction).GetObject().(*authorization.SelfSubjectAccessReview)
+		attributes := review.Spec.ResourceAttributes
+		review.Status.Allowed = !(attributes.Resource == "pods" && attributes.Subresource == "exec")
+		return true, review, nil
+	})
+
+	missing, err := CheckPermissions(context.Background(), clientset, RequiredPermissions(DefaultConfig()))
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if len(missing) != 1 || missing[0].Subresource != "exec" {
+		t.Errorf("Expected only pods/exec to be missing, got %v", missing)
+	}
+}
+
+func TestRBACManifest(t *testing.T) {
+	config := DefaultConfig()
+	config.Events = true
+	manifest, err := RBACManifest("overlaytest", RequiredPermissions(config))
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	documents := strings.Split(string(manifest), "---\n")
+	if len(documents) != 3 {
+		t.Fatalf("Expected ClusterRole and two Roles, got %d documents:\n%s", len(documents), manifest)
+	}
+
+	var clusterRole rbac.ClusterRole
+	if err := yaml.Unmarshal([]byte(documents[0]), &clusterRole); err != nil {
+		t.Fatal(err)
+	}
+	if clusterRole.Kind != "ClusterRole" || clusterRole.Rules[0].Resources[0] != "nodes" {
+		t.Errorf("Expected ClusterRole for nodes, got %+v", clusterRole)
+	}
+
+	var role rbac.Role
+	if err := yaml.Unmarshal([]byte(documents[2]), &role); err != nil {
+		t.Fatal(err)
+	}
+	if role.Kind != "Role" || role.Namespace != "kube-system" {
+		t.Errorf("Expected Role in kube-system, got %+v", role.ObjectMeta)
+	}
+	for _, rule := range role.Rules {
+		if rule.Resources[0] == "daemonsets" && (rule.APIGroups[0] != "apps" || len(rule.Verbs) != 3) {
+			t.Errorf("Expected merged daemonsets rule, got %+v", rule)
+		}
+	}
+}
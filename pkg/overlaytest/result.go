@@ -0,0 +1,183 @@
+package overlaytest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	core "k8s.io/api/core/v1"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Node topology labels used to annotate results
+const (
+	ZoneLabel   = "topology.kubernetes.io/zone"
+	RegionLabel = "topology.kubernetes.io/region"
+)
+
+// Probe error classes
+const (
+	ErrorClassUnreachable = "unreachable" // probe ran but got no reply
+	ErrorClassProbe       = "probe"       // probe command failed for another reason
+	ErrorClassExec        = "exec"        // probe could not be executed in the pod
+)
+
+// NodeInfo describes a node taking part in the test
+type NodeInfo struct {
+	Name    string            `json:"name"`
+	PodName string            `json:"podName"`
+	PodIP   string            `json:"podIP"`
+	Zone    string            `json:"zone,omitempty"`
+	Region  string            `json:"region,omitempty"`
+	Labels  map[string]string `json:"labels,omitempty"`
+}
+
+// ProbeResult holds the outcome of a single probe from a source to a target node
+type ProbeResult struct {
+	SourceNode string        `json:"sourceNode"`
+	TargetNode string        `json:"targetNode"`
+	TargetIP   string        `json:"targetIP"`
+	Reachable  bool          `json:"reachable"`
+	RTT        time.Duration `json:"rtt,omitempty"`
+	ErrorClass string        `json:"errorClass,omitempty"`
+	Error      string        `json:"error,omitempty"`
+	// Hops is the traceroute of a failed probe
+	Hops []TracerouteHop `json:"hops,omitempty"`
+}
+
+// ReportMetadata describes the cluster and the settings of a test run
+type ReportMetadata struct {
+	Version           string `json:"version,omitempty"`
+	Cluster           string `json:"cluster,omitempty"`
+	KubernetesVersion string `json:"kubernetesVersion,omitempty"`
+	Namespace         string `json:"namespace,omitempty"`
+	Mode              string `json:"mode,omitempty"`
+	NodePoolLabel     string `json:"nodePoolLabel,omitempty"`
+	// CNI is the detected CNI plugin, nil if unknown
+	CNI *CNIInfo `json:"cni,omitempty"`
+}
+
+// Report holds the results of a complete network test run
+type Report struct {
+	Metadata  ReportMetadata `json:"metadata,omitempty"`
+	StartTime time.Time      `json:"startTime"`
+	Duration  time.Duration  `json:"duration"`
+	Nodes     []NodeInfo     `json:"nodes"`
+	Results   []ProbeResult  `json:"results"`
+	// Uncovered are the nodes which were not tested
+	Uncovered []UncoveredNode `json:"uncovered,omitempty"`
+	// CNIAgents is the state of the CNI agent pods on nodes with failed probes
+	CNIAgents []CNIAgentStatus `json:"cniAgents,omitempty"`
+	// Throughput are the bandwidth measurements of sampled node pairs
+	Throughput []ThroughputResult `json:"throughput,omitempty"`
+	// Latency are the latency percentiles of every node pair
+	Latency []LatencyStats `json:"latency,omitempty"`
+}
+
+// Node returns the NodeInfo for the named node
+func (r *Report) Node(name string) (NodeInfo, bool) {
+	for _, node := range r.Nodes {
+		if node.Name == name {
+			return node, true
+		}
+	}
+	return NodeInfo{}, false
+}
+
+// Failures returns all results where the target was not reachable
+func (r *Report) Failures() []ProbeResult {
+	var failures []ProbeResult
+	for _, result := range r.Results {
+		if !result.Reachable {
+			failures = append(failures, result)
+		}
+	}
+	return failures
+}
+
+// SuccessPercent returns the percentage of successful probes, rounded down
+func (r *Report) SuccessPercent() int {
+	if len(r.Results) == 0 {
+		return 0
+	}
+	return (len(r.Results) - len(r.Failures())) * 100 / len(r.Results)
+}
+
+// GetNodeInfo builds the NodeInfo list for the given test pods.
+// Node labels are looked up on a best effort basis, missing nodes only lack topology data.
+func GetNodeInfo(ctx context.Context, clientset kubernetes.Interface, pods []core.Pod) []NodeInfo {
+	nodes := make([]NodeInfo, 0, len(pods))
+	for _, pod := range pods {
+		info := NodeInfo{
+			Name:    pod.Spec.NodeName,
+			PodName: pod.ObjectMeta.Name,
+			PodIP:   pod.Status.PodIP,
+		}
+		if node, err := clientset.CoreV1().Nodes().Get(ctx, pod.Spec.NodeName, meta.GetOptions{}); err == nil {
+			info.Labels = node.ObjectMeta.Labels
+			info.Zone = node.ObjectMeta.Labels[ZoneLabel]
+			info.Region = node.ObjectMeta.Labels[RegionLabel]
+		}
+		nodes = append(nodes, info)
+	}
+	return nodes
+}
+
+// PrintResults writes one line per probe result
+func PrintResults(w io.Writer, report *Report) {
+	for _, result := range report.Results {
+		if result.Reachable {
+			fmt.Fprintf(w, "%s can reach %s\n", result.SourceNode, result.TargetNode)
+		} else {
+			fmt.Fprintf(w, "%s can NOT reach %s\n", result.SourceNode, result.TargetNode)
+			if len(result.Hops) > 0 {
+				fmt.Fprintf(w, "  traceroute: %s\n  %s\n", formatHops(result.Hops), TraceStop(result))
+			}
+		}
+	}
+}
+
+// NewReportMetadata describes the cluster behind the clients and the mode of the config.
+// The Kubernetes version is left empty if the discovery fails.
+func NewReportMetadata(clientset kubernetes.Interface, host string, config *Config) ReportMetadata {
+	metadata := ReportMetadata{
+		Version:       GetVersion(),
+		Cluster:       host,
+		Namespace:     config.Namespace,
+		Mode:          ModeExec,
+		NodePoolLabel: config.NodePoolLabel,
+	}
+	if config.Agent {
+		metadata.Mode = ModeAgent
+	} else if config.Batch {
+		metadata.Mode = ModeBatch
+	}
+	if version, err := clientset.Discovery().ServerVersion(); err == nil {
+		metadata.KubernetesVersion = version.GitVersion
+	}
+	return metadata
+}
+
+// WriteReportJSON writes the report as indented JSON
+func WriteReportJSON(w io.Writer, report *Report) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(report)
+}
+
+// LoadReport reads a report saved with WriteReportJSON
+func LoadReport(path string) (*Report, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading report: %w", err)
+	}
+	report := &Report{}
+	if err := json.Unmarshal(data, report); err != nil {
+		return nil, fmt.Errorf("error parsing report %s: %w", path, err)
+	}
+	return report, nil
+}
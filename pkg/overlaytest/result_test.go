@@ -0,0 +1,174 @@
+package overlaytest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	core "k8s.io/api/core/v1"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func testReport() *Report {
+	return &Report{
+		Nodes: []NodeInfo{
+			{Name: "node-1", PodName: "overlaytest-a", PodIP: "10.244.0.1", Zone: "zone-a"},
+			{Name: "node-2", PodName: "overlaytest-b", PodIP: "10.244.1.1", Zone: "zone-b"},
+		},
+		Results: []ProbeResult{
+			{SourceNode: "node-1", TargetNode: "node-1", TargetIP: "10.244.0.1", Reachable: true},
+			{SourceNode: "node-1", TargetNode: "node-2", TargetIP: "10.244.1.1", ErrorClass: ErrorClassUnreachable},
+			{SourceNode: "node-2", TargetNode: "node-1", TargetIP: "10.244.0.1", Reachable: true},
+			{SourceNode: "node-2", TargetNode: "node-2", TargetIP: "10.244.1.1", Reachable: true},
+		},
+	}
+}
+
+func TestReportNode(t *testing.T) {
+	report := testReport()
+
+	node, ok := report.Node("node-2")
+	if !ok {
+		t.Fatal("Expected node-2 to be found")
+	}
+	if node.Zone != "zone-b" {
+		t.Errorf("Expected zone zone-b, got %s", node.Zone)
+	}
+
+	if _, ok := report.Node("node-3"); ok {
+		t.Error("Expected node-3 not to be found")
+	}
+}
+
+func TestReportFailures(t *testing.T) {
+	failures := testReport().Failures()
+
+	if len(failures) != 1 {
+		t.Fatalf("Expected 1 failure, got %d", len(failures))
+	}
+	if failures[0].SourceNode != "node-1" || failures[0].TargetNode != "node-2" {
+		t.Errorf("Unexpected failure %+v", failures[0])
+	}
+}
+
+func TestPrintResults(t *testing.T) {
+	var buf bytes.Buffer
+	PrintResults(&buf, testReport())
+
+	expected := "node-1 can reach node-1\n" +
+		"node-1 can NOT reach node-2\n" +
+		"node-2 can reach node-1\n" +
+		"node-2 can reach node-2\n"
+	if buf.String() != expected {
+		t.Errorf("Expected output:\n%s\ngot:\n%s", expected, buf.String())
+	}
+}
+
+func TestGetNodeInfo(t *testing.T) {
+	ctx := context.Background()
+
+	node := &core.Node{
+		ObjectMeta: meta.ObjectMeta{
+			Name: "node-1",
+			Labels: map[string]string{
+				ZoneLabel:   "zone-a",
+				RegionLabel: "region-1",
+			},
+		},
+	}
+	pods := []core.Pod{
+		{
+			ObjectMeta: meta.ObjectMeta{Name: "overlaytest-a"},
+			Spec:       core.PodSpec{NodeName: "node-1"},
+			Status:     core.PodStatus{PodIP: "10.244.0.1"},
+		},
+		{
+			ObjectMeta: meta.ObjectMeta{Name: "overlaytest-b"},
+			Spec:       core.PodSpec{NodeName: "missing-node"},
+			Status:     core.PodStatus{PodIP: "10.244.1.1"},
+		},
+	}
+
+	clientset := fake.NewSimpleClientset(node)
+	nodes := GetNodeInfo(ctx, clientset, pods)
+
+	if len(nodes) != 2 {
+		t.Fatalf("Expected 2 nodes, got %d", len(nodes))
+	}
+	if nodes[0].Zone != "zone-a" || nodes[0].Region != "region-1" {
+		t.Errorf("Expected topology of node-1 to be set, got %+v", nodes[0])
+	}
+	if nodes[0].PodName != "overlaytest-a" || nodes[0].PodIP != "10.244.0.1" {
+		t.Errorf("Expected pod details of node-1 to be set, got %+v", nodes[0])
+	}
+	if nodes[1].Name != "missing-node" || nodes[1].Zone != "" {
+		t.Errorf("Expected missing node without topology, got %+v", nodes[1])
+	}
+}
+
+func TestWriteReportJSON(t *testing.T) {
+	report := testReport()
+	var buf bytes.Buffer
+	if err := WriteReportJSON(&buf, report); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	var decoded Report
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil {
+		t.Fatalf("Expected valid JSON, got: %v", err)
+	}
+	if !reflect.DeepEqual(decoded.Results, report.Results) {
+		t.Errorf("Expected %+v, got %+v", report.Results, decoded.Results)
+	}
+}
+
+func TestLoadReport(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "result.json")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	report := testReport()
+	report.Metadata.Version = "1.2.3"
+	if err := WriteReportJSON(f, report); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	loaded, err := LoadReport(path)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if !reflect.DeepEqual(loaded.Results, report.Results) || loaded.Metadata.Version != "1.2.3" {
+		t.Errorf("Expected %+v, got %+v", report, loaded)
+	}
+
+	if err := os.WriteFile(path, []byte("not json"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadReport(path); err == nil {
+		t.Error("Expected error for invalid JSON")
+	}
+	if _, err := LoadReport(filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Error("Expected error for missing file")
+	}
+}
+
+func TestNewReportMetadata(t *testing.T) {
+	clientset := fake.NewSimpleClientset()
+	config := DefaultConfig()
+	config.Agent = true
+
+	metadata := NewReportMetadata(clientset, "https://api.example.com", config)
+	if metadata.Mode != ModeAgent || metadata.Cluster != "https://api.example.com" || metadata.Namespace != "kube-system" {
+		t.Errorf("Unexpected metadata %+v", metadata)
+	}
+	if metadata.Version != GetVersion() {
+		t.Errorf("Expected version %s, got %s", GetVersion(), metadata.Version)
+	}
+}
@@ -0,0 +1,86 @@
+package overlaytest
+
+import (
+	"fmt"
+
+	apps "k8s.io/api/apps/v1"
+	core "k8s.io/api/core/v1"
+)
+
+// Security modes of the test pods
+const (
+	// SecurityModePrivileged runs privileged containers, this works with any image and container runtime
+	SecurityModePrivileged = "privileged"
+	// SecurityModeNetRaw drops all capabilities except NET_RAW, for policies which only reject privileged pods.
+	// NET_RAW is not part of the Pod Security "baseline" profile. The capability is not effective for the
+	// non-root user of the image, so ping uses unprivileged ICMP sockets like in the baseline mode.
+	SecurityModeNetRaw = "netraw"
+	// SecurityModeBaseline adds no capabilities and pings with unprivileged ICMP sockets,
+	// passing the Pod Security "baseline" profile
+	SecurityModeBaseline = "baseline"
+	// SecurityModeRestricted drops all capabilities and pings with unprivileged ICMP sockets,
+	// passing the Pod Security "restricted" profile
+	SecurityModeRestricted = "restricted"
+)
+
+// pingGroupRangeSysctl allows unprivileged ICMP echo sockets for all groups
+var pingGroupRangeSysctl = core.Sysctl{Name: "net.ipv4.ping_group_range", Value: "0 2147483647"}
+
+// ValidateSecurityMode checks for a known security mode, empty means privileged
+func ValidateSecurityMode(mode string) error {
+	switch mode {
+	case "", SecurityModePrivileged, SecurityModeNetRaw, SecurityModeBaseline, SecurityModeRestricted:
+		return nil
+	}
+	return fmt.Errorf("unsupported security mode %q", mode)
+}
+
+// ApplySecurityMode sets the security context of the test pods for the security mode
+func ApplySecurityMode(daemonset *apps.DaemonSet, mode string) {
+	if mode == "" || mode == SecurityModePrivileged {
+		return
+	}
+
+	noEscalation := false
+	podSpec := &daemonset.Spec.Template.Spec
+	for i := range podSpec.Containers {
+		securityContext := podSpec.Containers[i].SecurityContext
+		if securityContext == nil {
+			securityContext = &core.SecurityContext{}
+			podSpec.Containers[i].SecurityContext = securityContext
+		}
+		securityContext.Privileged = nil
+		securityContext.AllowPrivilegeEscalation = &noEscalation
+
+		switch mode {
+		case SecurityModeNetRaw:
+			securityContext.Capabilities = &core.Capabilities{
+				Drop: []core.Capability{"ALL"},
+				Add:  []core.Capability{"NET_RAW"},
+			}
+		case SecurityModeRestricted:
+			nonRoot := true
+			securityContext.RunAsNonRoot = &nonRoot
+			securityContext.Capabilities = &core.Capabilities{Drop: []core.Capability{"ALL"}}
+		}
+	}
+
+	// Without privileges the non-root user pings with unprivileged ICMP sockets
+	if podSpec.SecurityContext == nil {
+		podSpec.SecurityContext = &core.PodSecurityContext{}
+	}
+	podSpec.SecurityContext.Sysctls = append(podSpec.SecurityContext.Sysctls, pingGroupRangeSysctl)
+}
+
+// ApplyTracerouteUser runs the test containers as root. traceroute opens raw sockets, the capabilities
+// of a privileged container are only effective for root and not for the non-root user of the image.
+func ApplyTracerouteUser(daemonset *apps.DaemonSet) {
+	root := int64(0)
+	for i := range daemonset.Spec.Template.Spec.Containers {
+		container := &daemonset.Spec.Template.Spec.Containers[i]
+		if container.SecurityContext == nil {
+			container.SecurityContext = &core.SecurityContext{}
+		}
+		container.SecurityContext.RunAsUser = &root
+	}
+}
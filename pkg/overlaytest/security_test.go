@@ -0,0 +1,177 @@
+package overlaytest
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"testing"
+
+	apps "k8s.io/api/apps/v1"
+	core "k8s.io/api/core/v1"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/pod-security-admission/api"
+	"k8s.io/pod-security-admission/policy"
+)
+
+// checkPodSecurity evaluates the pod template against a Pod Security Standards level
+func checkPodSecurity(t *testing.T, daemonset *apps.DaemonSet, level api.Level) policy.AggregateCheckResult {
+	t.Helper()
+	evaluator, err := policy.NewEvaluator(policy.DefaultChecks(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := daemonset.Spec.Template
+	results := evaluator.EvaluatePod(api.LevelVersion{Level: level, Version: api.LatestVersion()}, &template.ObjectMeta, &template.Spec)
+	return policy.AggregateCheckResults(results)
+}
+
+func TestApplySecurityMode(t *testing.T) {
+	tests := []struct {
+		name       string
+		mode       string
+		agent      bool
+		level      api.Level
+		allowed    bool
+		capability string
+	}{
+		{name: "Privileged fails baseline", mode: SecurityModePrivileged, level: api.LevelBaseline, allowed: false},
+		{name: "NetRaw fails baseline", mode: SecurityModeNetRaw, level: api.LevelBaseline, allowed: false, capability: "NET_RAW"},
+		{name: "Baseline passes baseline", mode: SecurityModeBaseline, level: api.LevelBaseline, allowed: true},
+		{name: "Baseline fails restricted", mode: SecurityModeBaseline, level: api.LevelRestricted, allowed: false},
+		{name: "Restricted passes restricted", mode: SecurityModeRestricted, level: api.LevelRestricted, allowed: true},
+		{name: "Restricted agent passes restricted", mode: SecurityModeRestricted, agent: true, level: api.LevelRestricted, allowed: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			daemonset := CreateDaemonSetSpec("test-ns", "overlaytest", "test-image")
+			if tt.agent {
+				daemonset = CreateAgentDaemonSetSpec("test-ns", "overlaytest", "test-image")
+			}
+			ApplySecurityMode(daemonset, tt.mode)
+
+			result := checkPodSecurity(t, daemonset, tt.level)
+			if result.Allowed != tt.allowed {
+				t.Errorf("Expected allowed=%v for %s, got %v: %s", tt.allowed, tt.level, result.Allowed, result.ForbiddenDetail())
+			}
+
+			securityContext := daemonset.Spec.Template.Spec.Containers[0].SecurityContext
+			if tt.capability != "" {
+				if securityContext.Capabilities == nil || len(securityContext.Capabilities.Add) != 1 || string(securityContext.Capabilities.Add[0]) != tt.capability {
+					t.Errorf("Expected capability %s, got %v", tt.capability, securityContext.Capabilities)
+				}
+			}
+		})
+	}
+}
+
+func TestApplySecurityModeRestrictedSysctl(t *testing.T) {
+	daemonset := CreateDaemonSetSpec("test-ns", "overlaytest", "test-image")
+	ApplySecurityMode(daemonset, SecurityModeRestricted)
+
+	sysctls := daemonset.Spec.Template.Spec.SecurityContext.Sysctls
+	if len(sysctls) != 1 || sysctls[0].Name != "net.ipv4.ping_group_range" {
+		t.Errorf("Expected ping_group_range sysctl, got %v", sysctls)
+	}
+	securityContext := daemonset.Spec.Template.Spec.Containers[0].SecurityContext
+	if securityContext.Privileged != nil || *securityContext.AllowPrivilegeEscalation || !*securityContext.RunAsNonRoot {
+		t.Errorf("Expected unprivileged non-root container, got %+v", securityContext)
+	}
+}
+
+// pingsUnprivileged tells if the group of the test container may open ICMP echo sockets
+func pingsUnprivileged(daemonset *apps.DaemonSet) bool {
+	spec := daemonset.Spec.Template.Spec
+	group := spec.Containers[0].SecurityContext.RunAsGroup
+	if spec.SecurityContext == nil || group == nil {
+		return false
+	}
+	for _, sysctl := range spec.SecurityContext.Sysctls {
+		var low, high int64
+		if sysctl.Name != "net.ipv4.ping_group_range" {
+			continue
+		}
+		if _, err := fmt.Sscanf(sysctl.Value, "%d %d", &low, &high); err == nil && low <= *group && *group <= high {
+			return true
+		}
+	}
+	return false
+}
+
+func TestApplySecurityModePing(t *testing.T) {
+	for _, mode := range []string{SecurityModeNetRaw, SecurityModeBaseline, SecurityModeRestricted} {
+		t.Run(mode, func(t *testing.T) {
+			daemonset := CreateDaemonSetSpec("test-ns", "overlaytest", "test-image")
+			ApplySecurityMode(daemonset, mode)
+
+			// NET_RAW is no help without privilege escalation for the non-root user
+			securityContext := daemonset.Spec.Template.Spec.Containers[0].SecurityContext
+			if *securityContext.RunAsUser == 0 || *securityContext.AllowPrivilegeEscalation {
+				t.Fatalf("Expected non-root container without privilege escalation, got %+v", securityContext)
+			}
+			if !pingsUnprivileged(daemonset) {
+				t.Errorf("Expected ping_group_range to include the container group, got %+v", daemonset.Spec.Template.Spec.SecurityContext)
+			}
+		})
+	}
+}
+
+func TestValidateSecurityMode(t *testing.T) {
+	for _, mode := range []string{"", SecurityModePrivileged, SecurityModeNetRaw, SecurityModeBaseline, SecurityModeRestricted} {
+		if err := ValidateSecurityMode(mode); err != nil {
+			t.Errorf("Expected %q to be valid, got: %v", mode, err)
+		}
+	}
+	if err := ValidateSecurityMode("root"); err == nil {
+		t.Error("Expected error for unknown mode")
+	}
+}
+
+// opensRawSockets tells if the processes of the container have effective raw socket capabilities
+func opensRawSockets(container core.Container) bool {
+	securityContext := container.SecurityContext
+	if securityContext == nil || securityContext.RunAsUser == nil || *securityContext.RunAsUser != 0 {
+		return false
+	}
+	if securityContext.Privileged != nil && *securityContext.Privileged {
+		return true
+	}
+	return securityContext.Capabilities != nil && slices.Contains(securityContext.Capabilities.Add, "NET_RAW")
+}
+
+func TestTracerouteUser(t *testing.T) {
+	ctx := context.Background()
+	for _, agent := range []bool{false, true} {
+		t.Run(fmt.Sprintf("Agent %v", agent), func(t *testing.T) {
+			config := DefaultConfig()
+			config.Namespace = "test-namespace"
+			config.Agent = agent
+			clientset := fake.NewSimpleClientset()
+			if err := CreateOrReuseDaemonSet(ctx, clientset, config, false); err != nil {
+				t.Fatalf("Expected no error, got: %v", err)
+			}
+			daemonset, err := clientset.AppsV1().DaemonSets(config.Namespace).Get(ctx, config.AppName, meta.GetOptions{})
+			if err != nil {
+				t.Fatalf("Expected the daemonset, got: %v", err)
+			}
+			if opensRawSockets(daemonset.Spec.Template.Spec.Containers[0]) {
+				t.Error("Expected the non-root user without traceroute")
+			}
+
+			config.Traceroute = TracerouteUDP
+			if err := Cleanup(ctx, clientset, config); err != nil {
+				t.Fatalf("Expected no error, got: %v", err)
+			}
+			if err := CreateOrReuseDaemonSet(ctx, clientset, config, false); err != nil {
+				t.Fatalf("Expected no error, got: %v", err)
+			}
+			daemonset, err = clientset.AppsV1().DaemonSets(config.Namespace).Get(ctx, config.AppName, meta.GetOptions{})
+			if err != nil {
+				t.Fatalf("Expected the daemonset, got: %v", err)
+			}
+			if !opensRawSockets(daemonset.Spec.Template.Spec.Containers[0]) {
+				t.Errorf("Expected traceroute to open raw sockets, got security context %+v", daemonset.Spec.Template.Spec.Containers[0].SecurityContext)
+			}
+		})
+	}
+}
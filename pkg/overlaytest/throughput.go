@@ -0,0 +1,265 @@
+package overlaytest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"k8s.io/client-go/kubernetes"
+)
+
+// Throughput sampling modes
+const (
+	ThroughputAll    = "all"    // every node pair, heavy on large clusters
+	ThroughputRandom = "random" // a number of random node pairs
+	ThroughputZone   = "zone"   // one random node pair per zone pair
+)
+
+// maxThroughputDuration limits a single stream requested from an agent
+const maxThroughputDuration = time.Minute
+
+// ThroughputResult is the bandwidth of a stream from the source to the target agent
+type ThroughputResult struct {
+	SourceNode string        `json:"sourceNode"`
+	TargetNode string        `json:"targetNode"`
+	TargetIP   string        `json:"targetIP"`
+	Bytes      int64         `json:"bytes"`
+	Duration   time.Duration `json:"duration"`
+	Mbps       float64       `json:"mbps"`
+	Error      string        `json:"error,omitempty"`
+}
+
+// ThroughputPair is a node pair selected for a throughput measurement
+type ThroughputPair struct {
+	Source NodeInfo
+	Target NodeInfo
+}
+
+// ValidateThroughputMode checks the sampling mode, empty disables throughput measurements
+func ValidateThroughputMode(mode string) error {
+	switch mode {
+	case "", ThroughputAll, ThroughputRandom, ThroughputZone:
+		return nil
+	}
+	return fmt.Errorf("unsupported throughput mode %q, use %s, %s or %s", mode, ThroughputAll, ThroughputRandom, ThroughputZone)
+}
+
+// SelectThroughputPairs picks the node pairs to measure: all pairs, count random pairs or
+// one random pair per ordered zone pair, including pairs within a zone
+func SelectThroughputPairs(nodes []NodeInfo, mode string, count int, rng *rand.Rand) []ThroughputPair {
+	var all []ThroughputPair
+	for _, source := range nodes {
+		for _, target := range nodes {
+			if source.Name != target.Name && source.PodName != "" && target.PodIP != "" {
+				all = append(all, ThroughputPair{Source: source, Target: target})
+			}
+		}
+	}
+
+	switch mode {
+	case ThroughputAll:
+		return all
+	case ThroughputRandom:
+		rng.Shuffle(len(all), func(i, j int) { all[i], all[j] = all[j], all[i] })
+		return all[:min(count, len(all))]
+	case ThroughputZone:
+		byZones := map[[2]string][]ThroughputPair{}
+		for _, pair := range all {
+			key := [2]string{pair.Source.Zone, pair.Target.Zone}
+			byZones[key] = append(byZones[key], pair)
+		}
+		keys := make([][2]string, 0, len(byZones))
+		for key := range byZones {
+			keys = append(keys, key)
+		}
+		sort.Slice(keys, func(i, j int) bool {
+			return keys[i][0] < keys[j][0] || keys[i][0] == keys[j][0] && keys[i][1] < keys[j][1]
+		})
+		pairs := make([]ThroughputPair, 0, len(keys))
+		for _, key := range keys {
+			candidates := byZones[key]
+			pairs = append(pairs, candidates[rng.IntN(len(candidates))])
+		}
+		return pairs
+	}
+	return nil
+}
+
+// MeasureThroughput asks the agent of every source to stream to the target agent for duration.
+// Pairs are measured one after another, so the streams do not compete for bandwidth.
+func MeasureThroughput(ctx context.Context, clientset kubernetes.Interface, namespace string, pairs []ThroughputPair, duration time.Duration) []ThroughputResult {
+	results := make([]ThroughputResult, 0, len(pairs))
+	for _, pair := range pairs {
+		result := ThroughputResult{SourceNode: pair.Source.Name, TargetNode: pair.Target.Name, TargetIP: pair.Target.PodIP}
+
+		raw, err := clientset.CoreV1().Pods(namespace).
+			ProxyGet("http", pair.Source.PodName, strconv.Itoa(DefaultAgentPort), "/throughput", map[string]string{
+				"target":   pair.Target.PodIP,
+				"duration": duration.String(),
+			}).DoRaw(ctx)
+		if err == nil {
+			err = json.Unmarshal(raw, &result)
+		}
+		if err != nil {
+			result.Error = err.Error()
+		}
+		// The agent only knows IPs
+		result.SourceNode, result.TargetNode = pair.Source.Name, pair.Target.Name
+		results = append(results, result)
+	}
+	return results
+}
+
+// zeroReader returns zeros until the deadline
+type zeroReader struct {
+	deadline time.Time
+}
+
+func (r *zeroReader) Read(p []byte) (int, error) {
+	if time.Now().After(r.deadline) {
+		return 0, io.EOF
+	}
+	clear(p)
+	return len(p), nil
+}
+
+// sinkResponse is the response of the agent /sink endpoint
+type sinkResponse struct {
+	Bytes int64 `json:"bytes"`
+}
+
+// StreamTo sends zeros to the sink of the target agent for duration and returns the bandwidth
+// of the bytes the target received
+func (a *Agent) StreamTo(ctx context.Context, targetIP string, duration time.Duration) ThroughputResult {
+	result := ThroughputResult{SourceNode: a.config.NodeName, TargetIP: targetIP}
+	if !ValidatePodIP(targetIP) {
+		result.Error = fmt.Sprintf("invalid target IP %q", targetIP)
+		return result
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, duration+30*time.Second)
+	defer cancel()
+	start := time.Now()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, a.sinkURL(targetIP), &zeroReader{deadline: start.Add(duration)})
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	resp, err := a.client.Do(req)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	defer resp.Body.Close()
+
+	var sink sinkResponse
+	if resp.StatusCode != http.StatusOK {
+		result.Error = fmt.Sprintf("sink returned %s", resp.Status)
+		return result
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&sink); err != nil {
+		result.Error = fmt.Sprintf("invalid sink response: %v", err)
+		return result
+	}
+
+	result.Duration = time.Since(start)
+	result.Bytes = sink.Bytes
+	result.Mbps = float64(sink.Bytes) * 8 / result.Duration.Seconds() / 1e6
+	return result
+}
+
+func (a *Agent) defaultSinkURL(targetIP string) string {
+	return "http://" + net.JoinHostPort(targetIP, strconv.Itoa(a.config.Port)) + "/sink"
+}
+
+// handleSink discards the request body of a peer and returns its size
+func (a *Agent) handleSink(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	host, _, _ := net.SplitHostPort(r.RemoteAddr)
+	if !a.checkPeer(r.Context(), w, host) {
+		return
+	}
+	if !a.sink.TryLock() {
+		http.Error(w, "a stream is already being received", http.StatusTooManyRequests)
+		return
+	}
+	defer a.sink.Unlock()
+	// Not every ResponseWriter supports deadlines, e.g. in tests
+	_ = http.NewResponseController(w).SetReadDeadline(time.Now().Add(maxThroughputDuration + 30*time.Second))
+
+	n, err := io.Copy(io.Discard, r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(sinkResponse{Bytes: n})
+}
+
+// handleThroughput streams to the target peer of the request and returns the ThroughputResult
+func (a *Agent) handleThroughput(w http.ResponseWriter, r *http.Request) {
+	duration, err := time.ParseDuration(r.URL.Query().Get("duration"))
+	if err != nil || duration <= 0 || duration > maxThroughputDuration {
+		http.Error(w, fmt.Sprintf("duration must be between 0 and %s", maxThroughputDuration), http.StatusBadRequest)
+		return
+	}
+	target := r.URL.Query().Get("target")
+	if !a.checkPeer(r.Context(), w, target) {
+		return
+	}
+	if !a.stream.TryLock() {
+		http.Error(w, "a stream is already running", http.StatusTooManyRequests)
+		return
+	}
+	defer a.stream.Unlock()
+
+	result := a.StreamTo(r.Context(), target, duration)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// checkPeer rejects the request unless the IP is an agent of the peer service, so the
+// endpoints can not be used to send or receive data outside of the test
+func (a *Agent) checkPeer(ctx context.Context, w http.ResponseWriter, ip string) bool {
+	ok, err := a.isPeer(ctx, ip)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return false
+	}
+	if !ok {
+		http.Error(w, fmt.Sprintf("%s is not an agent peer", ip), http.StatusForbidden)
+	}
+	return ok
+}
+
+// PrintThroughput writes the bandwidth of every measured pair and the slowest pair
+func PrintThroughput(w io.Writer, results []ThroughputResult) {
+	if len(results) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "\nThroughput of %d node pairs:\n", len(results))
+	var slowest *ThroughputResult
+	for i, result := range results {
+		if result.Error != "" {
+			fmt.Fprintf(w, "  ! %s → %s: %s\n", result.SourceNode, result.TargetNode, result.Error)
+			continue
+		}
+		fmt.Fprintf(w, "    %s → %s: %.1f Mbit/s\n", result.SourceNode, result.TargetNode, result.Mbps)
+		if slowest == nil || result.Mbps < slowest.Mbps {
+			slowest = &results[i]
+		}
+	}
+	if slowest != nil && len(results) > 1 {
+		fmt.Fprintf(w, "  slowest: %s → %s with %.1f Mbit/s\n", slowest.SourceNode, slowest.TargetNode, slowest.Mbps)
+	}
+}
@@ -0,0 +1,231 @@
+package overlaytest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"math/rand/v2"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	core "k8s.io/api/core/v1"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	restclient "k8s.io/client-go/rest"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func throughputNodes() []NodeInfo {
+	return []NodeInfo{
+		{Name: "node-1", PodName: "overlaytest-1", PodIP: "10.244.1.1", Zone: "zone-a"},
+		{Name: "node-2", PodName: "overlaytest-2", PodIP: "10.244.2.1", Zone: "zone-a"},
+		{Name: "node-3", PodName: "overlaytest-3", PodIP: "10.244.3.1", Zone: "zone-b"},
+		{Name: "node-4", PodName: "overlaytest-4", PodIP: "10.244.4.1", Zone: "zone-b"},
+	}
+}
+
+func TestSelectThroughputPairs(t *testing.T) {
+	rng := rand.New(rand.NewPCG(1, 2))
+	nodes := throughputNodes()
+
+	if pairs := SelectThroughputPairs(nodes, ThroughputAll, 0, rng); len(pairs) != 12 {
+		t.Errorf("Expected all 12 pairs, got %d", len(pairs))
+	}
+
+	random := SelectThroughputPairs(nodes, ThroughputRandom, 5, rng)
+	if len(random) != 5 {
+		t.Errorf("Expected 5 random pairs, got %d", len(random))
+	}
+	seen := map[[2]string]bool{}
+	for _, pair := range random {
+		key := [2]string{pair.Source.Name, pair.Target.Name}
+		if pair.Source.Name == pair.Target.Name || seen[key] {
+			t.Errorf("Expected distinct pairs of different nodes, got %v", key)
+		}
+		seen[key] = true
+	}
+	if pairs := SelectThroughputPairs(nodes, ThroughputRandom, 50, rng); len(pairs) != 12 {
+		t.Errorf("Expected at most all 12 pairs, got %d", len(pairs))
+	}
+
+	zones := SelectThroughputPairs(nodes, ThroughputZone, 0, rng)
+	var got []string
+	for _, pair := range zones {
+		got = append(got, pair.Source.Zone+"→"+pair.Target.Zone)
+	}
+	if strings.Join(got, " ") != "zone-a→zone-a zone-a→zone-b zone-b→zone-a zone-b→zone-b" {
+		t.Errorf("Expected one pair per zone pair, got %v", got)
+	}
+
+	// Nodes without test pod can not take part
+	nodes[0].PodName, nodes[0].PodIP = "", ""
+	if pairs := SelectThroughputPairs(nodes, ThroughputAll, 0, rng); len(pairs) != 6 {
+		t.Errorf("Expected 6 pairs without node-1, got %d", len(pairs))
+	}
+}
+
+func TestValidateThroughputMode(t *testing.T) {
+	for _, mode := range []string{"", ThroughputAll, ThroughputRandom, ThroughputZone} {
+		if err := ValidateThroughputMode(mode); err != nil {
+			t.Errorf("Expected %q to be valid, got: %v", mode, err)
+		}
+	}
+	if err := ValidateThroughputMode("mesh"); err == nil {
+		t.Error("Expected mesh to be rejected")
+	}
+}
+
+func TestAgentStreamTo(t *testing.T) {
+	// The test server sees the stream coming from localhost
+	target := httptest.NewServer(testAgent([]string{"127.0.0.1"}, "").Handler())
+	defer target.Close()
+
+	agent := testAgent(nil, "")
+	agent.sinkURL = func(targetIP string) string { return target.URL + "/sink" }
+
+	result := agent.StreamTo(context.Background(), "10.244.1.1", 100*time.Millisecond)
+	if result.Error != "" {
+		t.Fatalf("Expected no error, got %s", result.Error)
+	}
+	if result.Bytes == 0 || result.Mbps <= 0 || result.Duration < 100*time.Millisecond {
+		t.Errorf("Expected bytes streamed for at least 100ms, got %+v", result)
+	}
+	if result.SourceNode != "node-1" || result.TargetIP != "10.244.1.1" {
+		t.Errorf("Unexpected pair %s → %s", result.SourceNode, result.TargetIP)
+	}
+
+	if result := agent.StreamTo(context.Background(), "10.244.1.1; rm -rf /", time.Second); result.Error == "" {
+		t.Error("Expected invalid target IP to be rejected")
+	}
+}
+
+func TestAgentThroughputHandler(t *testing.T) {
+	target := httptest.NewServer(testAgent([]string{"127.0.0.1"}, "").Handler())
+	defer target.Close()
+	agent := testAgent([]string{"10.244.0.1", "10.244.1.1"}, "")
+	agent.sinkURL = func(targetIP string) string { return target.URL + "/sink" }
+	handler := agent.Handler()
+
+	tests := []struct {
+		name   string
+		url    string
+		status int
+	}{
+		{"Stream", "/throughput?target=10.244.1.1&duration=50ms", http.StatusOK},
+		{"Missing duration", "/throughput?target=10.244.1.1", http.StatusBadRequest},
+		{"Too long", "/throughput?target=10.244.1.1&duration=1h", http.StatusBadRequest},
+		{"Not a peer", "/throughput?target=10.96.0.1&duration=50ms", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.url, nil))
+			if rec.Code != tt.status {
+				t.Fatalf("Expected status %d, got %d: %s", tt.status, rec.Code, rec.Body.String())
+			}
+			if tt.status != http.StatusOK {
+				return
+			}
+			var result ThroughputResult
+			if err := json.Unmarshal(rec.Body.Bytes(), &result); err != nil || result.Bytes == 0 {
+				t.Errorf("Expected a throughput result, got %s (%v)", rec.Body.String(), err)
+			}
+		})
+	}
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/sink", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected GET /sink to be rejected, got %d", rec.Code)
+	}
+
+	// httptest requests come from 192.0.2.1, which is no agent
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/sink", strings.NewReader("data")))
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("Expected upload of a non-peer to be rejected, got %d", rec.Code)
+	}
+	sink := httptest.NewRequest(http.MethodPost, "/sink", strings.NewReader("data"))
+	sink.RemoteAddr = "10.244.1.1:40000"
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, sink)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"bytes":4`) {
+		t.Errorf("Expected upload of a peer to be counted, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestAgentThroughputConcurrent(t *testing.T) {
+	agent := testAgent([]string{"10.244.0.1", "10.244.1.1"}, "")
+	handler := agent.Handler()
+
+	// A running stream in each direction
+	agent.stream.Lock()
+	agent.sink.Lock()
+	defer agent.stream.Unlock()
+	defer agent.sink.Unlock()
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/throughput?target=10.244.1.1&duration=50ms", nil))
+	if rec.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected a second stream to be rejected, got %d", rec.Code)
+	}
+
+	sink := httptest.NewRequest(http.MethodPost, "/sink", strings.NewReader("data"))
+	sink.RemoteAddr = "10.244.1.1:40000"
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, sink)
+	if rec.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected a second upload to be rejected, got %d", rec.Code)
+	}
+}
+
+func TestMeasureThroughput(t *testing.T) {
+	nodes := throughputNodes()
+	pod := &core.Pod{ObjectMeta: meta.ObjectMeta{Name: "overlaytest-1", Namespace: "test"}}
+	clientset := fake.NewSimpleClientset(pod)
+	var requests []map[string]string
+	clientset.PrependProxyReactor("pods", func(action k8stesting.Action) (bool, restclient.ResponseWrapper, error) {
+		proxy := action.(k8stesting.ProxyGetAction)
+		requests = append(requests, proxy.GetParams())
+		if proxy.GetPath() != "/throughput" {
+			t.Errorf("Expected /throughput, got %s", proxy.GetPath())
+		}
+		if proxy.GetName() == "overlaytest-3" {
+			return true, fakeProxyResponse{err: errors.New("proxy error")}, nil
+		}
+		body, _ := json.Marshal(ThroughputResult{TargetIP: proxy.GetParams()["target"], Bytes: 1e6, Duration: time.Second, Mbps: 8})
+		return true, fakeProxyResponse{body: body}, nil
+	})
+
+	pairs := []ThroughputPair{{Source: nodes[0], Target: nodes[1]}, {Source: nodes[2], Target: nodes[3]}}
+	results := MeasureThroughput(context.Background(), clientset, "test", pairs, 3*time.Second)
+
+	if len(requests) != 2 || requests[0]["target"] != "10.244.2.1" || requests[0]["duration"] != "3s" {
+		t.Errorf("Expected a stream request per pair, got %v", requests)
+	}
+	if len(results) != 2 {
+		t.Fatalf("Expected 2 results, got %d", len(results))
+	}
+	if results[0].SourceNode != "node-1" || results[0].TargetNode != "node-2" || results[0].Mbps != 8 {
+		t.Errorf("Unexpected result %+v", results[0])
+	}
+	if results[1].Error == "" || results[1].SourceNode != "node-3" {
+		t.Errorf("Expected an error for node-3, got %+v", results[1])
+	}
+
+	var buf bytes.Buffer
+	PrintThroughput(&buf, results)
+	for _, expected := range []string{
+		"Throughput of 2 node pairs:",
+		"node-1 → node-2: 8.0 Mbit/s",
+		"! node-3 → node-4: ",
+	} {
+		if !strings.Contains(buf.String(), expected) {
+			t.Errorf("Expected output to contain %q, got:\n%s", expected, buf.String())
+		}
+	}
+}
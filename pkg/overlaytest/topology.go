@@ -0,0 +1,192 @@
+package overlaytest
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"time"
+)
+
+// Topology levels results are grouped by
+const (
+	TopologyZone     = "zone"
+	TopologyRegion   = "region"
+	TopologyNodePool = "node-pool"
+)
+
+// topologyUnknown is the group of nodes without the topology label
+const topologyUnknown = "<none>"
+
+// knownNodePoolLabels are tried in order when no node pool label is configured
+var knownNodePoolLabels = []string{
+	"cloud.google.com/gke-nodepool",
+	"eks.amazonaws.com/nodegroup",
+	"kubernetes.azure.com/agentpool",
+	"karpenter.sh/nodepool",
+	"node.kubernetes.io/pool",
+}
+
+// TopologyStats are the probe counts and the average RTT of a set of node pairs
+type TopologyStats struct {
+	Probes   int           `json:"probes"`
+	Failures int           `json:"failures"`
+	AvgRTT   time.Duration `json:"avgRTT,omitempty"`
+
+	rttSum   time.Duration
+	rttCount int
+}
+
+// SuccessPercent returns the percentage of successful probes, rounded down
+func (s *TopologyStats) SuccessPercent() int {
+	if s.Probes == 0 {
+		return 0
+	}
+	return (s.Probes - s.Failures) * 100 / s.Probes
+}
+
+func (s *TopologyStats) add(result ProbeResult) {
+	s.Probes++
+	if !result.Reachable {
+		s.Failures++
+	} else if result.RTT > 0 {
+		s.rttSum += result.RTT
+		s.rttCount++
+		s.AvgRTT = s.rttSum / time.Duration(s.rttCount)
+	}
+}
+
+// TopologyGroupPair are the probes from the nodes of one group to the nodes of another group
+type TopologyGroupPair struct {
+	Source string `json:"source"`
+	Target string `json:"target"`
+	TopologyStats
+}
+
+// Block reports whether all probes between the groups failed
+func (p *TopologyGroupPair) Block() bool {
+	return p.Probes > 0 && p.Failures == p.Probes
+}
+
+// TopologySummary groups the results of a report by one topology level
+type TopologySummary struct {
+	Level string `json:"level"`
+	Label string `json:"label"`
+	// Groups maps the label values to their node count
+	Groups map[string]int `json:"groups"`
+	// Intra are the probes within the same group, Cross the probes between groups
+	Intra TopologyStats       `json:"intra"`
+	Cross TopologyStats       `json:"cross"`
+	Pairs []TopologyGroupPair `json:"pairs"`
+}
+
+// TopologySummaries groups the results by zone, region and node pool.
+// Levels where all nodes share one group are left out. The node pool label is
+// detected from well-known cloud provider labels if nodePoolLabel is empty.
+func TopologySummaries(report *Report, nodePoolLabel string) []TopologySummary {
+	if nodePoolLabel == "" {
+		nodePoolLabel = detectNodePoolLabel(report)
+	}
+
+	var summaries []TopologySummary
+	for _, level := range []struct{ name, label string }{
+		{TopologyZone, ZoneLabel},
+		{TopologyRegion, RegionLabel},
+		{TopologyNodePool, nodePoolLabel},
+	} {
+		if level.label == "" {
+			continue
+		}
+		if summary := summarizeTopology(report, level.name, level.label); len(summary.Groups) > 1 {
+			summaries = append(summaries, summary)
+		}
+	}
+	return summaries
+}
+
+func detectNodePoolLabel(report *Report) string {
+	for _, label := range knownNodePoolLabels {
+		for _, node := range report.Nodes {
+			if node.Labels[label] != "" {
+				return label
+			}
+		}
+	}
+	return ""
+}
+
+func summarizeTopology(report *Report, level, label string) TopologySummary {
+	summary := TopologySummary{Level: level, Label: label, Groups: map[string]int{}}
+
+	groups := map[string]string{}
+	for _, node := range report.Nodes {
+		group := node.Labels[label]
+		// Reports of older versions only carry zone and region
+		switch {
+		case group != "":
+		case label == ZoneLabel:
+			group = node.Zone
+		case label == RegionLabel:
+			group = node.Region
+		}
+		if group == "" {
+			group = topologyUnknown
+		}
+		groups[node.Name] = group
+		summary.Groups[group]++
+	}
+	groupOf := func(node string) string {
+		if group, ok := groups[node]; ok {
+			return group
+		}
+		return topologyUnknown
+	}
+
+	pairs := map[[2]string]*TopologyGroupPair{}
+	for _, result := range report.Results {
+		source, target := groupOf(result.SourceNode), groupOf(result.TargetNode)
+		if source == target {
+			summary.Intra.add(result)
+		} else {
+			summary.Cross.add(result)
+		}
+		key := [2]string{source, target}
+		if pairs[key] == nil {
+			pairs[key] = &TopologyGroupPair{Source: source, Target: target}
+		}
+		pairs[key].add(result)
+	}
+
+	for _, pair := range pairs {
+		summary.Pairs = append(summary.Pairs, *pair)
+	}
+	sort.Slice(summary.Pairs, func(i, j int) bool {
+		a, b := summary.Pairs[i], summary.Pairs[j]
+		return a.Source < b.Source || a.Source == b.Source && a.Target < b.Target
+	})
+	return summary
+}
+
+// PrintTopology writes the intra and cross group success rates of every level and
+// the group pairs with failures, group pairs where all probes failed are highlighted
+func PrintTopology(w io.Writer, summaries []TopologySummary) {
+	for _, summary := range summaries {
+		fmt.Fprintf(w, "\nTopology by %s (%s, %d groups):\n", summary.Level, summary.Label, len(summary.Groups))
+		printTopologyStats(w, "intra-"+summary.Level, &summary.Intra)
+		printTopologyStats(w, "cross-"+summary.Level, &summary.Cross)
+		for _, pair := range summary.Pairs {
+			switch {
+			case pair.Block():
+				fmt.Fprintf(w, "  ! %s → %s: all %d probes failed\n", pair.Source, pair.Target, pair.Probes)
+			case pair.Failures > 0:
+				fmt.Fprintf(w, "    %s → %s: %d of %d probes failed\n", pair.Source, pair.Target, pair.Failures, pair.Probes)
+			}
+		}
+	}
+}
+
+func printTopologyStats(w io.Writer, name string, stats *TopologyStats) {
+	if stats.Probes == 0 {
+		return
+	}
+	fmt.Fprintf(w, "  %s: %d%% of %d probes succeeded, average RTT %s\n", name, stats.SuccessPercent(), stats.Probes, formatRTT(stats.AvgRTT))
+}
@@ -0,0 +1,142 @@
+package overlaytest
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+// topologyReport has two zones of two nodes in one region, zone-a cannot reach zone-b
+func topologyReport() *Report {
+	node := func(name, zone, pool string) NodeInfo {
+		return NodeInfo{Name: name, Zone: zone, Region: "eu", Labels: map[string]string{
+			ZoneLabel:                       zone,
+			RegionLabel:                     "eu",
+			"cloud.google.com/gke-nodepool": pool,
+			"pool":                          pool,
+		}}
+	}
+	report := &Report{Nodes: []NodeInfo{
+		node("node-1", "zone-a", "default"),
+		node("node-2", "zone-a", "gpu"),
+		node("node-3", "zone-b", "default"),
+		node("node-4", "zone-b", "gpu"),
+	}}
+	zones := map[string]string{"node-1": "zone-a", "node-2": "zone-a", "node-3": "zone-b", "node-4": "zone-b"}
+	for _, source := range report.Nodes {
+		for _, target := range report.Nodes {
+			if source.Name == target.Name {
+				continue
+			}
+			result := ProbeResult{SourceNode: source.Name, TargetNode: target.Name, Reachable: true, RTT: time.Millisecond}
+			if zones[source.Name] != zones[target.Name] {
+				result.RTT = 3 * time.Millisecond
+				if zones[source.Name] == "zone-a" {
+					result.Reachable, result.RTT = false, 0
+				}
+			}
+			report.Results = append(report.Results, result)
+		}
+	}
+	return report
+}
+
+func TestTopologySummaries(t *testing.T) {
+	summaries := TopologySummaries(topologyReport(), "")
+
+	// The region level is left out, all nodes share one region
+	if len(summaries) != 2 || summaries[0].Level != TopologyZone || summaries[1].Level != TopologyNodePool {
+		t.Fatalf("Expected zone and node pool summaries, got %+v", summaries)
+	}
+
+	zone := summaries[0]
+	if zone.Groups["zone-a"] != 2 || zone.Groups["zone-b"] != 2 {
+		t.Errorf("Expected 2 nodes per zone, got %v", zone.Groups)
+	}
+	if zone.Intra.Probes != 4 || zone.Intra.Failures != 0 || zone.Intra.AvgRTT != time.Millisecond {
+		t.Errorf("Expected 4 successful intra-zone probes with 1ms, got %+v", zone.Intra)
+	}
+	if zone.Cross.Probes != 8 || zone.Cross.Failures != 4 || zone.Cross.SuccessPercent() != 50 || zone.Cross.AvgRTT != 3*time.Millisecond {
+		t.Errorf("Expected half of 8 cross-zone probes failing with 3ms, got %+v", zone.Cross)
+	}
+
+	var blocks []string
+	for _, pair := range zone.Pairs {
+		if pair.Block() {
+			blocks = append(blocks, pair.Source+"→"+pair.Target)
+		}
+	}
+	if len(blocks) != 1 || blocks[0] != "zone-a→zone-b" {
+		t.Errorf("Expected zone-a→zone-b to fail as a block, got %v", blocks)
+	}
+
+	pool := summaries[1]
+	if pool.Label != "cloud.google.com/gke-nodepool" {
+		t.Errorf("Expected the GKE node pool label to be detected, got %q", pool.Label)
+	}
+	for _, pair := range pool.Pairs {
+		if pair.Block() {
+			t.Errorf("Expected no node pool pair to fail as a block, got %+v", pair)
+		}
+	}
+}
+
+func TestTopologySummariesNodePoolLabel(t *testing.T) {
+	tests := []struct {
+		name     string
+		label    string
+		expected string
+	}{
+		{"Configured label", "pool", "pool"},
+		{"Detected label", "", "cloud.google.com/gke-nodepool"},
+		{"Missing label", "missing", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			label := ""
+			for _, summary := range TopologySummaries(topologyReport(), tt.label) {
+				if summary.Level == TopologyNodePool {
+					label = summary.Label
+				}
+			}
+			if label != tt.expected {
+				t.Errorf("Expected node pool label %q, got %q", tt.expected, label)
+			}
+		})
+	}
+}
+
+func TestTopologySummariesWithoutLabels(t *testing.T) {
+	// Reports of older versions only carry the zone fields
+	report := testReport()
+	summaries := TopologySummaries(report, "")
+	if len(summaries) != 1 || summaries[0].Level != TopologyZone {
+		t.Fatalf("Expected a zone summary, got %+v", summaries)
+	}
+
+	report.Nodes = nil
+	if summaries := TopologySummaries(report, ""); len(summaries) != 0 {
+		t.Errorf("Expected no summaries without topology, got %+v", summaries)
+	}
+}
+
+func TestPrintTopology(t *testing.T) {
+	var buf bytes.Buffer
+	PrintTopology(&buf, TopologySummaries(topologyReport(), ""))
+	output := buf.String()
+	for _, expected := range []string{
+		"Topology by zone (topology.kubernetes.io/zone, 2 groups):",
+		"intra-zone: 100% of 4 probes succeeded, average RTT 1ms",
+		"cross-zone: 50% of 8 probes succeeded, average RTT 3ms",
+		"! zone-a → zone-b: all 4 probes failed",
+		"default → gpu: 1 of 4 probes failed",
+	} {
+		if !strings.Contains(output, expected) {
+			t.Errorf("Expected output to contain %q, got:\n%s", expected, output)
+		}
+	}
+	if strings.Contains(output, "zone-b → zone-a") {
+		t.Errorf("Expected only group pairs with failures, got:\n%s", output)
+	}
+}
@@ -0,0 +1,145 @@
+package overlaytest
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+// Traceroute modes
+const (
+	TracerouteICMP = "icmp"
+	TracerouteUDP  = "udp"
+)
+
+// Traceroute limits, a trace takes at most maxHops seconds
+const (
+	tracerouteMaxHops = 10
+	// maxTraceroutes limits the traced pairs of a run, a broken node fails a whole row and column
+	maxTraceroutes = 20
+)
+
+// TracerouteHop is one hop of a traceroute, IP is empty if the hop did not reply
+type TracerouteHop struct {
+	TTL int           `json:"ttl"`
+	IP  string        `json:"ip,omitempty"`
+	RTT time.Duration `json:"rtt,omitempty"`
+}
+
+// ValidateTracerouteMode checks the traceroute mode, empty disables traceroutes
+func ValidateTracerouteMode(mode string) error {
+	switch mode {
+	case "", TracerouteICMP, TracerouteUDP:
+		return nil
+	}
+	return fmt.Errorf("unsupported traceroute mode %q, use %s or %s", mode, TracerouteICMP, TracerouteUDP)
+}
+
+// CreateTracerouteCommand creates a numeric traceroute with one probe per hop
+func CreateTracerouteCommand(targetIP, mode string) []string {
+	cmd := []string{"traceroute", "-n", "-q", "1", "-w", "1", "-m", strconv.Itoa(tracerouteMaxHops)}
+	if mode == TracerouteICMP {
+		cmd = append(cmd, "-I")
+	}
+	return append(cmd, targetIP)
+}
+
+var tracerouteHopRegexp = regexp.MustCompile(`^\s*(\d+)\s+(?:(\*)|(\S+)\s+([0-9.]+) ms)`)
+
+// ParseTraceroute extracts the hops of a traceroute output, the header line is skipped.
+// Both iputils and busybox output formats are supported.
+func ParseTraceroute(output string) []TracerouteHop {
+	var hops []TracerouteHop
+	for _, line := range strings.Split(output, "\n") {
+		match := tracerouteHopRegexp.FindStringSubmatch(line)
+		if match == nil {
+			continue
+		}
+		hop := TracerouteHop{}
+		hop.TTL, _ = strconv.Atoi(match[1])
+		if match[2] == "" {
+			hop.IP = match[3]
+			if ms, err := strconv.ParseFloat(match[4], 64); err == nil {
+				hop.RTT = time.Duration(ms * float64(time.Millisecond))
+			}
+		}
+		hops = append(hops, hop)
+	}
+	return hops
+}
+
+// TraceStop describes where the packets of a traced pair stop: at the source node (hop 1),
+// at the destination or after the last hop which replied, e.g. in the tunnel
+func TraceStop(result ProbeResult) string {
+	last := -1
+	for i, hop := range result.Hops {
+		if hop.IP != "" {
+			last = i
+		}
+	}
+	switch {
+	case len(result.Hops) == 0:
+		return ""
+	case last < 0:
+		return "no hop replied, packets die in the source pod or node"
+	case result.Hops[last].IP == result.TargetIP:
+		return "the destination replied to the traceroute"
+	case result.Hops[last].TTL == 1:
+		return fmt.Sprintf("packets die at the source node after %s", result.Hops[last].IP)
+	default:
+		return fmt.Sprintf("packets die after hop %d %s, between the nodes or at the destination node", result.Hops[last].TTL, result.Hops[last].IP)
+	}
+}
+
+// TraceFailures runs a traceroute from the source pod to the target of every failed probe
+// and attaches the hops to the result. At most maxTraceroutes pairs are traced.
+func TraceFailures(ctx context.Context, clientset kubernetes.Interface, config *rest.Config, namespace string, report *Report, mode string) {
+	traceFailures(ctx, report, mode, func(ctx context.Context, pod string, cmd []string) (string, error) {
+		return ExecInPod(ctx, clientset, config, namespace, pod, cmd)
+	})
+}
+
+func traceFailures(ctx context.Context, report *Report, mode string, exec func(ctx context.Context, pod string, cmd []string) (string, error)) {
+	traced := 0
+	for i := range report.Results {
+		result := &report.Results[i]
+		if result.Reachable || !ValidatePodIP(result.TargetIP) {
+			continue
+		}
+		source, ok := report.Node(result.SourceNode)
+		if !ok || source.PodName == "" {
+			continue
+		}
+		if traced == maxTraceroutes {
+			fmt.Fprintf(Stdout(ctx), "traced %d failed pairs, skipping the others\n", maxTraceroutes)
+			return
+		}
+		traced++
+
+		// traceroute exits with 0 even if the target was not reached, the hops are kept on errors
+		output, err := exec(ctx, source.PodName, CreateTracerouteCommand(result.TargetIP, mode))
+		result.Hops = ParseTraceroute(output)
+		if err != nil && len(result.Hops) == 0 {
+			fmt.Fprintf(Stdout(ctx), "traceroute from %s to %s failed: %v\n", result.SourceNode, result.TargetNode, err)
+		}
+	}
+}
+
+// formatHops writes the hops as "1 10.244.0.1 0.1ms, 2 *"
+func formatHops(hops []TracerouteHop) string {
+	parts := make([]string, len(hops))
+	for i, hop := range hops {
+		if hop.IP == "" {
+			parts[i] = fmt.Sprintf("%d *", hop.TTL)
+		} else {
+			parts[i] = fmt.Sprintf("%d %s %s", hop.TTL, hop.IP, formatRTT(hop.RTT))
+		}
+	}
+	return strings.Join(parts, ", ")
+}
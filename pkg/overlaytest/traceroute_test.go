@@ -0,0 +1,156 @@
+package overlaytest
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCreateTracerouteCommand(t *testing.T) {
+	tests := []struct {
+		mode     string
+		expected []string
+	}{
+		{TracerouteICMP, []string{"traceroute", "-n", "-q", "1", "-w", "1", "-m", "10", "-I", "10.244.1.5"}},
+		{TracerouteUDP, []string{"traceroute", "-n", "-q", "1", "-w", "1", "-m", "10", "10.244.1.5"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			if cmd := CreateTracerouteCommand("10.244.1.5", tt.mode); !reflect.DeepEqual(cmd, tt.expected) {
+				t.Errorf("Expected %v, got %v", tt.expected, cmd)
+			}
+		})
+	}
+}
+
+func TestValidateTracerouteMode(t *testing.T) {
+	for _, mode := range []string{"", TracerouteICMP, TracerouteUDP} {
+		if err := ValidateTracerouteMode(mode); err != nil {
+			t.Errorf("Expected %q to be valid, got: %v", mode, err)
+		}
+	}
+	if err := ValidateTracerouteMode("tcp"); err == nil {
+		t.Error("Expected tcp to be rejected")
+	}
+}
+
+func TestParseTraceroute(t *testing.T) {
+	tests := []struct {
+		name     string
+		output   string
+		expected []TracerouteHop
+	}{
+		{
+			name: "Busybox",
+			output: `traceroute to 10.244.1.5 (10.244.1.5), 10 hops max, 46 byte packets
+ 1  10.244.0.1  0.052 ms
+ 2  10.244.1.0  0.611 ms
+ 3  *
+`,
+			expected: []TracerouteHop{
+				{TTL: 1, IP: "10.244.0.1", RTT: 52 * time.Microsecond},
+				{TTL: 2, IP: "10.244.1.0", RTT: 611 * time.Microsecond},
+				{TTL: 3},
+			},
+		},
+		{
+			name: "Iputils",
+			output: `traceroute to 10.244.1.5 (10.244.1.5), 10 hops max, 60 byte packets
+ 1  10.244.0.1  0.045 ms
+ 2  *
+10  *
+`,
+			expected: []TracerouteHop{
+				{TTL: 1, IP: "10.244.0.1", RTT: 45 * time.Microsecond},
+				{TTL: 2},
+				{TTL: 10},
+			},
+		},
+		{
+			name:     "No output",
+			output:   "traceroute: socket: Operation not permitted\n",
+			expected: nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if hops := ParseTraceroute(tt.output); !reflect.DeepEqual(hops, tt.expected) {
+				t.Errorf("Expected %+v, got %+v", tt.expected, hops)
+			}
+		})
+	}
+}
+
+func TestTraceStop(t *testing.T) {
+	tests := []struct {
+		name     string
+		hops     []TracerouteHop
+		expected string
+	}{
+		{"Not traced", nil, ""},
+		{"No reply", []TracerouteHop{{TTL: 1}, {TTL: 2}}, "no hop replied, packets die in the source pod or node"},
+		{"Source node", []TracerouteHop{{TTL: 1, IP: "10.244.0.1"}, {TTL: 2}}, "packets die at the source node after 10.244.0.1"},
+		{"Tunnel", []TracerouteHop{{TTL: 1, IP: "10.244.0.1"}, {TTL: 2, IP: "10.244.1.0"}, {TTL: 3}}, "packets die after hop 2 10.244.1.0, between the nodes or at the destination node"},
+		{"Destination", []TracerouteHop{{TTL: 1, IP: "10.244.0.1"}, {TTL: 2, IP: "10.244.1.5"}}, "the destination replied to the traceroute"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := ProbeResult{TargetIP: "10.244.1.5", Hops: tt.hops}
+			if stop := TraceStop(result); stop != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, stop)
+			}
+		})
+	}
+}
+
+func TestTraceFailures(t *testing.T) {
+	report := testReport()
+	var traced []string
+	traceFailures(context.Background(), report, TracerouteICMP, func(ctx context.Context, pod string, cmd []string) (string, error) {
+		traced = append(traced, pod+" "+cmd[len(cmd)-1])
+		return " 1  10.244.0.1  0.052 ms\n 2  *\n", errors.New("command terminated with exit code 1")
+	})
+
+	if !reflect.DeepEqual(traced, []string{"overlaytest-a 10.244.1.1"}) {
+		t.Errorf("Expected only the failed pair to be traced from the source pod, got %v", traced)
+	}
+	if hops := report.Results[1].Hops; len(hops) != 2 || hops[0].IP != "10.244.0.1" {
+		t.Errorf("Expected the hops to be attached to the failed result, got %+v", hops)
+	}
+	if report.Results[0].Hops != nil {
+		t.Errorf("Expected no hops on reachable pairs, got %+v", report.Results[0].Hops)
+	}
+
+	var buf bytes.Buffer
+	PrintResults(&buf, report)
+	for _, expected := range []string{
+		"node-1 can NOT reach node-2\n  traceroute: 1 10.244.0.1 52µs, 2 *\n  packets die at the source node after 10.244.0.1\n",
+	} {
+		if !strings.Contains(buf.String(), expected) {
+			t.Errorf("Expected output to contain %q, got:\n%s", expected, buf.String())
+		}
+	}
+}
+
+func TestTraceFailuresLimit(t *testing.T) {
+	report := meshReport(6, func(source, target int) bool { return source != target })
+	for i := range report.Nodes {
+		report.Nodes[i].PodName = "pod-" + report.Nodes[i].Name
+	}
+	for i := range report.Results {
+		report.Results[i].TargetIP = "10.244.0.1"
+	}
+
+	traced := 0
+	traceFailures(context.Background(), report, TracerouteUDP, func(ctx context.Context, pod string, cmd []string) (string, error) {
+		traced++
+		return "", nil
+	})
+	if traced != maxTraceroutes {
+		t.Errorf("Expected %d traceroutes, got %d", maxTraceroutes, traced)
+	}
+}